@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"agmd/pkg/generator"
+	"agmd/pkg/parser"
+	"agmd/pkg/registry"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkAllowMissing bool
+	checkSet          []string
+	checkJSON         bool
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report problems in directives.md without writing AGENTS.md",
+	Long: `Check directives.md and the registry items it includes for problems.
+
+Reports, with file, line and column:
+  - Malformed directives (':::include rule', ':::list' without a type)
+  - Unknown directives (':::inclde')
+  - :::list, :::new and :::if blocks that never reach :::end
+  - References missing from the registry
+  - Include cycles, missing parameters and unreadable :::file paths
+
+Output is compiler-style (file:line:col: severity: message [code]), or JSON
+with --json for editors and CI. Exits non-zero when any error is found.
+
+Examples:
+  agmd check                  # Check directives.md
+  agmd check --json           # Machine-readable diagnostics
+  agmd check --allow-missing  # Report missing references as warnings`,
+	Args: cobra.NoArgs,
+	RunE: runCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().BoolVar(&checkAllowMissing, "allow-missing", false, "Report unresolved references as warnings")
+	checkCmd.Flags().StringArrayVar(&checkSet, "set", nil, "Set a variable as key=value (repeatable)")
+	checkCmd.Flags().BoolVar(&checkJSON, "json", false, "Print diagnostics as JSON")
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(directivesMdFilename); err != nil {
+		return fmt.Errorf("directives.md not found\nRun 'agmd init' first")
+	}
+
+	vars, err := parseSetFlags(checkSet)
+	if err != nil {
+		return err
+	}
+
+	reg, err := registry.New()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	gen := generator.New(reg, nil)
+	gen.AllowMissing = checkAllowMissing
+	gen.Vars = vars
+
+	diags, err := gen.Check(directivesMdFilename)
+	if err != nil {
+		return err
+	}
+
+	errorCount := 0
+	for _, d := range diags {
+		if d.Severity == parser.SeverityError {
+			errorCount++
+		}
+	}
+
+	if checkJSON {
+		if diags == nil {
+			diags = []parser.Diagnostic{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diags); err != nil {
+			return err
+		}
+	} else {
+		printDiagnostics(diags, errorCount)
+	}
+
+	if errorCount > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("check failed with %d errors", errorCount)
+	}
+	return nil
+}
+
+// printDiagnostics prints diagnostics compiler-style followed by a summary
+func printDiagnostics(diags []parser.Diagnostic, errorCount int) {
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed, color.Bold).SprintFunc()
+	yellow := color.New(color.FgYellow, color.Bold).SprintFunc()
+
+	if len(diags) == 0 {
+		fmt.Printf("%s No problems found in %s\n", green("✓"), directivesMdFilename)
+		return
+	}
+
+	for _, d := range diags {
+		location := d.File
+		if d.Pos.Line > 0 {
+			location = fmt.Sprintf("%s:%d:%d", d.File, d.Pos.Line, d.Pos.Column)
+		}
+		severity := yellow(string(d.Severity))
+		if d.Severity == parser.SeverityError {
+			severity = red(string(d.Severity))
+		}
+		fmt.Printf("%s: %s: %s [%s]\n", location, severity, d.Message, d.Code)
+	}
+
+	fmt.Printf("\n%d errors, %d warnings\n", errorCount, len(diags)-errorCount)
+}
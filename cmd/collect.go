@@ -6,8 +6,10 @@ import (
 	"path/filepath"
 
 	"agmd/pkg/importer"
+	"agmd/pkg/pullback"
 	"agmd/pkg/registry"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +20,10 @@ var collectCmd = &cobra.Command{
 
 This command is for projects that already use agmd (have directives.md with :::include directives).
 It parses directives.md to find referenced items and extracts their content from AGENTS.md.
+When AGENTS.md was generated with 'agmd sync --provenance', items are read from
+their exact marked boundaries; otherwise they are located by their headings.
+Marked items that are already in the registry are collected with their own
+heading levels and {{placeholders}}, undoing the expansion like pull-back.
 
 Use this when:
 - You clone an agmd project and want its rules in your registry
@@ -119,6 +125,8 @@ func runCollect(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("registry not found at %s. Run 'agmd setup' first", reg.BasePath)
 	}
 
+	unexpandItems(items, string(agentsContent), directivesPath, reg)
+
 	// Collect items
 	fmt.Println("\n→ Collecting to local registry...")
 	collected := 0
@@ -195,9 +203,61 @@ func runCollect(cmd *cobra.Command, args []string) error {
 		fmt.Printf("  • Skipped: %d\n", skipped)
 	}
 
+	if collected+overwritten > 0 {
+		project := "project"
+		if cwd, err := os.Getwd(); err == nil {
+			project = filepath.Base(cwd)
+		}
+		autoCommit(reg, "Collect %d item(s) from %s", collected+overwritten, project)
+	}
+
 	return nil
 }
 
+// unexpandItems replaces the expanded content of items read from provenance
+// regions by the items as written in the registry, with their own heading
+// levels and {{placeholders}}, when the registry has them. directivesPath is
+// expanded again, with the settings of the last sync, to know what each
+// region looked like before any hand edits.
+func unexpandItems(items map[string][]importer.ImportedItem, agents, directivesPath string, reg *registry.Registry) {
+	yellow := color.New(color.FgYellow).SprintFunc()
+	settings, err := loadSyncSettings()
+	if err != nil {
+		fmt.Printf("%s %v\n", yellow("⚠"), err)
+		return
+	}
+	gen, err := syncGenerator(reg, settings)
+	if err != nil {
+		fmt.Printf("%s %v\n", yellow("⚠"), err)
+		return
+	}
+	gen.Provenance = true
+	gen.AllowMissing = true
+	expected, err := gen.ParseAndExpand(directivesPath)
+	if err != nil {
+		fmt.Printf("%s Items are collected as expanded: %v\n", yellow("⚠"), err)
+		return
+	}
+	originals, err := pullback.Unexpand(agents, expected, reg)
+	if err != nil {
+		fmt.Printf("%s Items are collected as expanded: %v\n", yellow("⚠"), err)
+		return
+	}
+
+	for _, list := range items {
+		for i, item := range list {
+			if item.Region == nil {
+				continue
+			}
+			if original, ok := originals[item.Region.Line]; ok {
+				list[i].Content = original
+			} else if len(item.Region.Params) > 0 {
+				fmt.Printf("%s %s:%s is collected with its parameters substituted (%s)\n", yellow("⚠"), item.Type, item.Name, item.Region.Directive())
+			}
+		}
+	}
+}
+
 // writeItemToRegistry writes an extracted item to the registry
 func writeItemToRegistry(reg *registry.Registry, item importer.ImportedItem) error {
 	// Determine target directory
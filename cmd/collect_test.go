@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectUnexpandsItems(t *testing.T) {
+	home, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	item := filepath.Join(home, ".agmd", "rule", "deploy.md")
+	if err := os.MkdirAll(filepath.Dir(item), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(item, []byte("---\nname: deploy\n---\n\n# Deploy\n\nDeploy to {{env}}.\n\n## Steps\n\nRun the pipeline.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	directives := "# Project\n\n## Operations\n\n:::include rule:deploy env=staging level=3\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync", "--provenance"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	agents := filepath.Join(project, agentsMdFilename)
+	expanded := readFile(t, agents)
+	if !strings.Contains(expanded, "### Deploy") || !strings.Contains(expanded, "Deploy to staging.") {
+		t.Fatalf("AGENTS.md should hold the shifted, substituted item:\n%s", expanded)
+	}
+	if err := os.WriteFile(agents, []byte(strings.Replace(expanded, "Run the pipeline.", "Run the pipeline twice.", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgmd(t, "collect", "--overwrite"); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	got := readFile(t, item)
+	for _, want := range []string{"\n# Deploy\n", "\n## Steps\n", "Deploy to {{env}}.", "Run the pipeline twice."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("collected item should contain %q:\n%s", want, got)
+		}
+	}
+}
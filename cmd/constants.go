@@ -1,7 +1,9 @@
 package cmd
 
+import "agmd/internal/config"
+
 // File name constants used across commands
 const (
-	directivesMdFilename = "directives.md" // Source file with directives
-	agentsMdFilename     = "AGENTS.md"     // Generated output for AI agents
+	directivesMdFilename = "directives.md"        // Source file with directives
+	agentsMdFilename     = config.AgentMdFilename // Generated output for AI agents, which tool files link to
 )
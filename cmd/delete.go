@@ -143,6 +143,8 @@ func runDelete(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	autoCommit(reg, "Delete %s:%s", itemType, name)
+
 	// Warning about directives.md
 	fmt.Printf("\n%s If this item is referenced in directives.md, remove or update the reference:\n", yellow("ℹ"))
 	fmt.Printf("  :::include %s:%s\n", itemType, name)
@@ -88,12 +88,15 @@ func runEdit(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load registry: %w", err)
 	}
 
-	// Build file path
-	filePath := filepath.Join(reg.BasePath, itemType, name+".md")
-
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("%s:%s not found at %s", itemType, name, filePath)
+	// Edit the file of the layer that wins the lookup
+	paths := reg.Which(itemType, name)
+	if len(paths) == 0 {
+		return fmt.Errorf("%s:%s not found at %s", itemType, name, filepath.Join(reg.BasePath, itemType, name+".md"))
+	}
+	filePath := paths[0]
+	if source := reg.SourceOf(filePath); source != "" {
+		_, plainType, _ := registry.SplitSource(itemType)
+		return fmt.Errorf("%s:%s comes from the read-only source %q\nOverride it in your registry with 'agmd new %s:%s'", itemType, name, source, plainType, name)
 	}
 
 	// Non-interactive edit
@@ -119,11 +122,16 @@ func runEdit(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to write file: %w", err)
 		}
 		fmt.Printf("%s Updated %s:%s\n", green("ok"), itemType, name)
+		autoCommitItem(reg, filePath, "Edit %s:%s", itemType, name)
 		return nil
 	}
 
 	fmt.Printf("%s Opening %s:%s...\n", blue("->"), itemType, name)
-	return openInEditor(filePath)
+	if err := openInEditor(filePath); err != nil {
+		return err
+	}
+	autoCommitItem(reg, filePath, "Edit %s:%s", itemType, name)
+	return nil
 }
 
 // extractFrontmatterString extracts frontmatter (including delimiters) from content
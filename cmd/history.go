@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history <type:name>",
+	Short: "Show the revisions of a registry item",
+	Long: `List the commits that changed a registry item, newest first.
+
+The registry must be a git repository ('agmd registry git init'). Renames
+made with 'agmd mv' are followed. Tasks (task:name) are looked up in the
+current project.
+
+Examples:
+  agmd history rule:typescript
+  agmd restore rule:typescript@a1b2c3d   # Bring back one of the revisions`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHistory,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <type:name@rev>",
+	Short: "Restore a registry item from an earlier revision",
+	Long: `Write the content a registry item had at a git revision back to the registry.
+
+The revision is anything git understands: a commit hash from
+'agmd history', HEAD~2, a tag or a branch. Items deleted since can be
+restored too. With auto-commit enabled the restore is committed.
+
+Examples:
+  agmd restore rule:typescript@a1b2c3d
+  agmd restore workflow:commit@HEAD~1`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
+
+// itemRelPath returns the path of an item relative to the registry root
+func itemRelPath(itemType, name string) (string, error) {
+	if itemType == "task" {
+		projectName, err := getProjectName()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join("task", projectName, name+".md"), nil
+	}
+	return filepath.Join(itemType, name+".md"), nil
+}
+
+// parseItemRef splits a type:name reference
+func parseItemRef(ref string) (itemType, name string, err error) {
+	itemType, name, ok := strings.Cut(ref, ":")
+	if !ok || itemType == "" || name == "" {
+		return "", "", fmt.Errorf("invalid format %q. Use 'type:name' (e.g., 'rule:typescript')", ref)
+	}
+	return strings.ToLower(itemType), name, nil
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	blue := color.New(color.FgBlue).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	itemType, name, err := parseItemRef(args[0])
+	if err != nil {
+		return err
+	}
+	_, repo, err := openRegistryRepo()
+	if err != nil {
+		return err
+	}
+	relPath, err := itemRelPath(itemType, name)
+	if err != nil {
+		return err
+	}
+
+	commits, err := repo.Log(relPath)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("%s:%s has no committed revisions", itemType, name)
+	}
+
+	fmt.Printf("%s %s:%s (%s)\n\n", blue("→"), itemType, name, filepath.ToSlash(relPath))
+	for _, commit := range commits {
+		fmt.Printf("  %s  %s  %s  %s\n", yellow(commit.Short), commit.Date.Format("2006-01-02 15:04"), commit.Subject, commit.Author)
+	}
+	fmt.Printf("\nRestore a revision with: agmd restore %s:%s@<rev>\n", itemType, name)
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+
+	ref, rev, ok := strings.Cut(args[0], "@")
+	if !ok || rev == "" {
+		return fmt.Errorf("missing revision. Use 'type:name@rev' (e.g., 'rule:typescript@HEAD~1')")
+	}
+	itemType, name, err := parseItemRef(ref)
+	if err != nil {
+		return err
+	}
+	reg, repo, err := openRegistryRepo()
+	if err != nil {
+		return err
+	}
+	relPath, err := itemRelPath(itemType, name)
+	if err != nil {
+		return err
+	}
+
+	content, err := repo.Show(rev, filepath.ToSlash(relPath))
+	if err != nil {
+		return fmt.Errorf("%s:%s not found at %s: %w", itemType, name, rev, err)
+	}
+
+	filePath := filepath.Join(reg.BasePath, relPath)
+	if current, err := os.ReadFile(filePath); err == nil && bytes.Equal(current, content) {
+		fmt.Printf("%s %s:%s already matches %s\n", green("✓"), itemType, name, rev)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filePath, err)
+	}
+
+	fmt.Printf("%s Restored %s:%s from %s\n", green("✓"), itemType, name, rev)
+	autoCommit(reg, "Restore %s:%s from %s", itemType, name, rev)
+	return nil
+}
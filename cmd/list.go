@@ -74,7 +74,7 @@ func runList(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	fmt.Printf("%s\n\n", cyan(reg.BasePath))
+	fmt.Printf("%s\n\n", cyan(strings.Join(reg.SearchPath(), ", ")))
 
 	for _, typeName := range types {
 		// Skip task type in general listing (it has its own subcommand)
@@ -83,7 +83,10 @@ func runList(cmd *cobra.Command, args []string) error {
 		}
 
 		items, err := reg.ListItems(typeName)
-		if err != nil || len(items) == 0 {
+		if err != nil {
+			fmt.Printf("%s %v\n", yellow("!"), err)
+		}
+		if len(items) == 0 {
 			continue
 		}
 
@@ -139,6 +139,8 @@ func runMv(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	autoCommit(reg, "Move %s:%s to %s:%s", sourceType, sourceName, destType, destName)
+
 	fmt.Println("\nNote: If this item is referenced in directives.md, update the reference:")
 	fmt.Printf("  Old: @%s:%s\n", sourceType, sourceName)
 	fmt.Printf("  New: @%s:%s\n", destType, destName)
@@ -136,11 +136,16 @@ description: ""
 	// Open editor unless --no-editor or content was provided
 	if newNoEditor || content != "" {
 		fmt.Printf("%s %s\n", blue("->"), filePath)
+		autoCommit(reg, "Add %s:%s", itemType, name)
 		return nil
 	}
 
 	fmt.Printf("%s Opening editor...\n", blue("->"))
-	return openInEditor(filePath)
+	if err := openInEditor(filePath); err != nil {
+		return err
+	}
+	autoCommit(reg, "Add %s:%s", itemType, name)
+	return nil
 }
 
 // isTerminal checks if a file is a terminal (not piped)
@@ -191,6 +196,7 @@ func createProfile(name string, reg *registry.Registry) error {
 	}
 
 	fmt.Printf("%s Created profile:%s\n", green("ok"), name)
+	autoCommit(reg, "Add profile:%s", name)
 	fmt.Printf("\n%s Use in new project: agmd init profile:%s\n", blue("->"), name)
 
 	return nil
@@ -288,6 +288,7 @@ description: ""
 	}
 
 	fmt.Printf("%s Created %s at %s\n", green("✓"), itemType, filePath)
+	autoCommit(reg, "Promote %s:%s from directives.md", itemType, name)
 
 	// Replace :::new block with :::include directive in directives.md
 	replacement := fmt.Sprintf(":::include %s:%s", itemType, name)
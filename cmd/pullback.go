@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"agmd/pkg/diff"
+	"agmd/pkg/generator"
+	"agmd/pkg/pullback"
+	"agmd/pkg/registry"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var pullBackCmd = &cobra.Command{
+	Use:   "pull-back",
+	Short: "Write hand edits in AGENTS.md back to the registry and directives.md",
+	Long: `Find hand edits in AGENTS.md and write them back to their source.
+
+AGENTS.md must have been generated with provenance markers
+('agmd sync --provenance' or provenance: true in directives.md), so each
+expanded item can be located exactly. The command:
+1. Expands directives.md again and compares it with AGENTS.md
+2. Shows a diff for each registry item whose text was edited
+3. On confirmation, writes the edited text to the item's file in the
+   registry layer it came from (e.g. ~/.agmd/<type>/<name>.md), keeping
+   its frontmatter
+4. Writes edits made outside any item back into directives.md
+
+Heading levels shifted during expansion are restored. Edits that cannot be
+mapped safely are reported and left alone: project files (:::file), section
+includes (#anchor), items changed in the registry since the last sync, and
+text produced from {{parameters}} or flatten.
+
+Run 'agmd sync' afterwards to regenerate AGENTS.md from the updated sources.
+
+Examples:
+  agmd pull-back             # Review and confirm each change
+  agmd pull-back --yes       # Write every change without asking`,
+	RunE: runPullBack,
+}
+
+var (
+	pullBackYes bool
+	pullBackSet []string
+)
+
+func init() {
+	rootCmd.AddCommand(pullBackCmd)
+	pullBackCmd.Flags().BoolVarP(&pullBackYes, "yes", "y", false, "Write all changes without confirmation")
+	pullBackCmd.Flags().StringArrayVar(&pullBackSet, "set", nil, "Set a variable as key=value, as passed to sync (repeatable)")
+}
+
+func runPullBack(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	if _, err := os.Stat(directivesMdFilename); err != nil {
+		return fmt.Errorf("directives.md not found\nRun 'agmd init' first")
+	}
+	agents, err := os.ReadFile(agentsMdFilename)
+	if err != nil {
+		return fmt.Errorf("failed to read AGENTS.md: %w", err)
+	}
+
+	vars, err := parseSetFlags(pullBackSet)
+	if err != nil {
+		return err
+	}
+
+	reg, err := registry.New()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+	if !reg.Exists() {
+		return fmt.Errorf("registry not found at %s\nRun 'agmd setup' first", reg.BasePath)
+	}
+
+	// Expand again to know what AGENTS.md looked like before the hand edits
+	fmt.Printf("%s Comparing AGENTS.md with directives.md and the registry...\n", blue("→"))
+	gen := generator.New(reg, nil)
+	gen.AllowMissing = true
+	gen.Vars = vars
+	gen.Provenance = true
+	expected, err := gen.ParseAndExpand(directivesMdFilename)
+	if err != nil {
+		return fmt.Errorf("failed to parse and expand directives.md: %w", err)
+	}
+
+	result, err := pullback.Plan(string(agents), expected, directivesMdFilename, reg)
+	if errors.Is(err, pullback.ErrNoProvenance) {
+		return fmt.Errorf("AGENTS.md has no provenance markers\nRun 'agmd sync --provenance' first, then edit AGENTS.md")
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, skip := range result.Skipped {
+		if skip.Line > 0 {
+			fmt.Printf("%s %s:%d: %s %s\n", yellow("⚠"), agentsMdFilename, skip.Line, skip.Ref, skip.Reason)
+		} else {
+			fmt.Printf("%s %s: %s\n", yellow("⚠"), skip.Ref, skip.Reason)
+		}
+	}
+
+	if len(result.Changes) == 0 {
+		fmt.Printf("%s No hand edits to pull back\n", green("✓"))
+		return nil
+	}
+
+	written := 0
+	for _, change := range result.Changes {
+		label := change.Path
+		if change.Ref != "" {
+			label = fmt.Sprintf("%s (%s)", change.Ref, change.Path)
+		}
+		fmt.Printf("\n%s %s\n", blue("→"), label)
+		fmt.Print(diff.Unified(change.Path, change.Path, change.Old, change.New, 3))
+
+		if !pullBackYes {
+			fmt.Print("\nWrite this change? (y/N): ")
+			var response string
+			fmt.Scanln(&response)
+			response = strings.ToLower(strings.TrimSpace(response))
+			if response != "y" && response != "yes" {
+				fmt.Println("Skipped.")
+				continue
+			}
+		}
+
+		if err := os.WriteFile(change.Path, []byte(change.New), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", change.Path, err)
+		}
+		written++
+		fmt.Printf("%s Updated %s\n", green("✓"), change.Path)
+	}
+
+	if written > 0 {
+		autoCommit(reg, "Pull back %d change(s) from %s", written, agentsMdFilename)
+		fmt.Printf("\n%s Pulled back %d change(s). Run 'agmd sync' to regenerate AGENTS.md.\n", green("✓"), written)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"agmd/pkg/git"
+	"agmd/pkg/registry"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Manage the registry directory itself",
+	Long: `Manage the registry directory itself (~/.agmd, or AGMD_HOME / --registry).
+
+Subcommands:
+  git         Version the registry with git`,
+}
+
+var registryGitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Version the registry with git",
+	Long: `Keep the registry in a git repository, to track the history of every
+item and share it between machines through a remote.
+
+These commands run the git installed on this machine inside the registry
+directory. When auto-commit is enabled (auto_commit = true in config.toml,
+or 'agmd registry git init --auto-commit'), every command that changes the
+registry commits with a message describing the change: new, edit, mv,
+delete, promote, collect, pull-back, restore and the task commands.
+
+Examples:
+  agmd registry git init --auto-commit                # Start tracking the registry
+  agmd registry git init --remote git@host:me/agmd    # ...with a remote to push to
+  agmd registry git status                            # Uncommitted changes
+  agmd registry git commit -m "Tweak rules"           # Commit by hand
+  agmd registry git push                              # Publish commits
+  agmd registry git pull                              # Fetch another machine's changes
+  agmd history rule:typescript                        # Revisions of one item`,
+}
+
+var registryGitInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Turn the registry into a git repository",
+	Long: `Initialize a git repository in the registry and commit its current content.
+
+A registry that is already inside a git working tree (e.g. a dotfiles
+repository) is left as it is; commits then only include the registry
+directory.`,
+	Args: cobra.NoArgs,
+	RunE: runRegistryGitInit,
+}
+
+var registryGitStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show uncommitted changes in the registry",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRegistryGit("status", "--short", "--branch", "--", ".")
+	},
+}
+
+var registryGitLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the registry's commits",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRegistryGit("log", "--oneline", "--decorate", fmt.Sprintf("--max-count=%d", registryGitLogLimit), "--", ".")
+	},
+}
+
+var registryGitCommitCmd = &cobra.Command{
+	Use:   "commit",
+	Short: "Commit every change in the registry",
+	Args:  cobra.NoArgs,
+	RunE:  runRegistryGitCommit,
+}
+
+var registryGitPushCmd = &cobra.Command{
+	Use:   "push [remote] [branch]",
+	Short: "Push registry commits to a remote",
+	Long: `Push registry commits. Without arguments the current branch is pushed to
+its upstream, or to origin (setting it as upstream) the first time.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: runRegistryGitPush,
+}
+
+var registryGitPullCmd = &cobra.Command{
+	Use:   "pull [remote] [branch]",
+	Short: "Pull registry commits from a remote",
+	Args:  cobra.MaximumNArgs(2),
+	RunE:  runRegistryGitPull,
+}
+
+var (
+	registryGitRemote     string
+	registryGitAutoCommit bool
+	registryGitMessage    string
+	registryGitLogLimit   int
+)
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+	registryCmd.AddCommand(registryGitCmd)
+	registryGitCmd.AddCommand(registryGitInitCmd)
+	registryGitCmd.AddCommand(registryGitStatusCmd)
+	registryGitCmd.AddCommand(registryGitLogCmd)
+	registryGitCmd.AddCommand(registryGitCommitCmd)
+	registryGitCmd.AddCommand(registryGitPushCmd)
+	registryGitCmd.AddCommand(registryGitPullCmd)
+
+	registryGitInitCmd.Flags().StringVar(&registryGitRemote, "remote", "", "Add this URL as the origin remote")
+	registryGitInitCmd.Flags().BoolVar(&registryGitAutoCommit, "auto-commit", false, "Commit automatically after every change agmd makes")
+	registryGitCommitCmd.Flags().StringVarP(&registryGitMessage, "message", "m", "Update registry", "Commit message")
+	registryGitLogCmd.Flags().IntVarP(&registryGitLogLimit, "max-count", "n", 20, "Number of commits to show")
+}
+
+// loadRegistryRepo returns the registry and its git repository
+func loadRegistryRepo() (*registry.Registry, *git.Repo, error) {
+	reg, err := registry.New()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	if !reg.Exists() {
+		return nil, nil, fmt.Errorf("registry not found at %s\nRun 'agmd setup' first", reg.BasePath)
+	}
+	return reg, git.Open(reg.BasePath), nil
+}
+
+// openRegistryRepo is loadRegistryRepo for commands that need git history
+func openRegistryRepo() (*registry.Registry, *git.Repo, error) {
+	reg, repo, err := loadRegistryRepo()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !repo.IsRepo() {
+		return nil, nil, fmt.Errorf("registry at %s is not a git repository\nRun 'agmd registry git init' first", reg.BasePath)
+	}
+	return reg, repo, nil
+}
+
+// runRegistryGit runs git in the registry with its output on the terminal
+func runRegistryGit(args ...string) error {
+	_, repo, err := openRegistryRepo()
+	if err != nil {
+		return err
+	}
+	return repo.Exec(os.Stdout, os.Stderr, args...)
+}
+
+func runRegistryGitInit(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	reg, repo, err := loadRegistryRepo()
+	if err != nil {
+		return err
+	}
+
+	if repo.IsRepo() {
+		top, _ := repo.TopLevel()
+		fmt.Printf("%s Registry is already tracked by git: %s\n", yellow("!"), top)
+	} else {
+		if err := repo.Init(); err != nil {
+			return err
+		}
+		fmt.Printf("%s Initialized git repository in %s\n", green("✓"), reg.BasePath)
+	}
+
+	if registryGitRemote != "" {
+		if _, err := repo.Run("remote", "add", "origin", registryGitRemote); err != nil {
+			return err
+		}
+		fmt.Printf("%s Added remote origin: %s\n", green("✓"), registryGitRemote)
+	}
+
+	if registryGitAutoCommit {
+		config, err := reg.LoadConfig()
+		if err != nil {
+			return err
+		}
+		config.AutoCommit = true
+		if err := reg.SaveConfig(config); err != nil {
+			return err
+		}
+		fmt.Printf("%s Enabled auto-commit in %s\n", green("✓"), registry.ConfigFilename)
+	}
+
+	committed, err := repo.CommitAll("Track agmd registry")
+	if err != nil {
+		return err
+	}
+	if committed {
+		fmt.Printf("%s Committed the current registry content\n", green("✓"))
+	}
+	return nil
+}
+
+func runRegistryGitCommit(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+
+	_, repo, err := openRegistryRepo()
+	if err != nil {
+		return err
+	}
+	committed, err := repo.CommitAll(registryGitMessage)
+	if err != nil {
+		return err
+	}
+	if !committed {
+		fmt.Println("Nothing to commit")
+		return nil
+	}
+	fmt.Printf("%s Committed: %s\n", green("✓"), registryGitMessage)
+	return nil
+}
+
+func runRegistryGitPush(cmd *cobra.Command, args []string) error {
+	_, repo, err := openRegistryRepo()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 && !repo.HasUpstream() {
+		args = []string{"--set-upstream", "origin", "HEAD"}
+	}
+	return repo.Exec(os.Stdout, os.Stderr, append([]string{"push"}, args...)...)
+}
+
+func runRegistryGitPull(cmd *cobra.Command, args []string) error {
+	_, repo, err := openRegistryRepo()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 && !repo.HasUpstream() {
+		args = []string{"origin", "HEAD"}
+	}
+	return repo.Exec(os.Stdout, os.Stderr, append([]string{"pull"}, args...)...)
+}
+
+// autoCommit commits the registry changes made by a command when the
+// registry is a git repository with auto_commit enabled. A failed commit is
+// reported but does not fail the command, whose change is already written.
+func autoCommit(reg *registry.Registry, format string, a ...any) {
+	config, err := reg.LoadConfig()
+	if err != nil || !config.AutoCommit {
+		return
+	}
+	repo := git.Open(reg.BasePath)
+	if !repo.IsRepo() {
+		return
+	}
+
+	message := fmt.Sprintf(format, a...)
+	if _, err := repo.CommitAll(message); err != nil {
+		yellow := color.New(color.FgYellow).SprintFunc()
+		fmt.Printf("%s Could not commit the registry: %v\n", yellow("⚠"), err)
+	}
+}
+
+// autoCommitItem commits the change to the item file at path like
+// autoCommit, in the layer that holds it: the project .agmd/ or an AGMD_PATH
+// layer may live in another git repository than the registry, or in none.
+func autoCommitItem(reg *registry.Registry, path, format string, a ...any) {
+	layer := reg.LayerOf(path)
+	if layer == "" || filepath.Clean(layer) == filepath.Clean(reg.BasePath) {
+		autoCommit(reg, format, a...)
+		return
+	}
+	config, err := reg.LoadConfig()
+	if err != nil || !config.AutoCommit {
+		return
+	}
+
+	yellow := color.New(color.FgYellow).SprintFunc()
+	repo := git.Open(layer)
+	if !repo.IsRepo() {
+		fmt.Printf("%s %s is not a git repository; the change is not versioned\n", yellow("⚠"), layer)
+		return
+	}
+	message := fmt.Sprintf(format, a...)
+	if _, err := repo.CommitAll(message); err != nil {
+		fmt.Printf("%s Could not commit %s: %v\n", yellow("⚠"), layer, err)
+	}
+}
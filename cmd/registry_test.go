@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/pkg/git"
+	"agmd/pkg/registry"
+)
+
+// setupGit skips the test without git and gives commits a fixed identity
+func setupGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+}
+
+// gitRegistry creates a git-tracked registry with auto-commit enabled
+func gitRegistry(t *testing.T) string {
+	t.Helper()
+	testProject(t)
+	setupGit(t)
+
+	reg := filepath.Join(t.TempDir(), "registry")
+	t.Setenv(registry.HomeEnv, reg)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := runAgmd(t, "registry", "git", "init", "--auto-commit"); err != nil {
+		t.Fatalf("registry git init: %v", err)
+	}
+	return reg
+}
+
+// subjects returns the commit subjects of the registry, newest first
+func subjects(t *testing.T, reg string) []string {
+	t.Helper()
+	out, err := git.Open(reg).Run("log", "--format=%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(out, "\n")
+}
+
+func TestAutoCommit(t *testing.T) {
+	reg := gitRegistry(t)
+
+	steps := [][]string{
+		{"new", "rule:style", "--no-editor", "--content", "Use tabs."},
+		{"edit", "rule:style", "--content", "Use spaces."},
+		{"mv", "rule:style", "formatting"},
+		{"task", "new", "setup-db", "--no-editor", "--content", "Create the schema"},
+		{"task", "status", "setup-db", "in_progress"},
+		{"delete", "rule:formatting", "--force"},
+	}
+	for _, args := range steps {
+		if err := runAgmd(t, args...); err != nil {
+			t.Fatalf("%s: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	want := []string{
+		"Delete rule:formatting",
+		"Set task:setup-db to in_progress (project: myproject)",
+		"Add task:setup-db (project: myproject)",
+		"Move rule:style to rule:formatting",
+		"Edit rule:style",
+		"Add rule:style",
+		"Track agmd registry",
+	}
+	if got := subjects(t, reg); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commits:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if status, _ := git.Open(reg).Run("status", "--porcelain"); status != "" {
+		t.Errorf("uncommitted changes left:\n%s", status)
+	}
+}
+
+func TestAutoCommitDisabled(t *testing.T) {
+	reg := gitRegistry(t)
+	config := &registry.Config{}
+	if err := (&registry.Registry{BasePath: reg}).SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "registry", "git", "commit", "-m", "Disable auto-commit"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgmd(t, "new", "rule:style", "--no-editor", "--content", "Use tabs."); err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(t, reg)[0]; got != "Disable auto-commit" {
+		t.Errorf("latest commit = %q; new should not commit without auto_commit", got)
+	}
+}
+
+func TestAutoCommitLayers(t *testing.T) {
+	reg := gitRegistry(t)
+
+	// An AGMD_PATH layer with its own repository, and one without any
+	team := filepath.Join(t.TempDir(), "team")
+	plain := filepath.Join(t.TempDir(), "plain")
+	for _, layer := range []string{team, plain} {
+		if err := os.MkdirAll(filepath.Join(layer, "rule"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(team, "rule", "shared.md"), []byte("---\nname: shared\n---\n\nShared.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(plain, "rule", "local.md"), []byte("---\nname: local\n---\n\nLocal.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo := git.Open(team)
+	if err := repo.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CommitAll("Add rule:shared"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(registry.PathEnv, team+string(os.PathListSeparator)+plain)
+
+	if err := runAgmd(t, "edit", "rule:shared", "--content", "Shared by the team."); err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects(t, team)[0]; got != "Edit rule:shared" {
+		t.Errorf("latest commit of the layer = %q, want %q", got, "Edit rule:shared")
+	}
+	if status, _ := repo.Run("status", "--porcelain"); status != "" {
+		t.Errorf("uncommitted changes left in the layer:\n%s", status)
+	}
+
+	stdout, _ := captureOutput(t, func() {
+		if err := runAgmd(t, "edit", "rule:local", "--content", "Still local."); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !strings.Contains(stdout, "is not a git repository; the change is not versioned") {
+		t.Errorf("editing an unversioned layer should say so, got:\n%s", stdout)
+	}
+	if got := subjects(t, reg)[0]; got != "Track agmd registry" {
+		t.Errorf("latest registry commit = %q; edits of other layers should not commit the registry", got)
+	}
+}
+
+func TestHistoryAndRestore(t *testing.T) {
+	reg := gitRegistry(t)
+	if err := runAgmd(t, "new", "rule:style", "--no-editor", "--content", "Use tabs."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "edit", "rule:style", "--content", "Use spaces."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "history", "rule:style"); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+
+	commits, err := git.Open(reg).Log("rule/style.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("rule:style has %d revisions, want 2", len(commits))
+	}
+	first := commits[1].Short
+
+	if err := runAgmd(t, "restore", "rule:style@"+first); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := readFile(t, filepath.Join(reg, "rule", "style.md")); !strings.Contains(got, "Use tabs.") {
+		t.Errorf("restored rule:style = %q", got)
+	}
+	if got := subjects(t, reg)[0]; got != "Restore rule:style from "+first {
+		t.Errorf("latest commit = %q", got)
+	}
+
+	// Deleted items come back too
+	if err := runAgmd(t, "delete", "rule:style", "--force"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "restore", "rule:style@HEAD~1"); err != nil {
+		t.Fatalf("restore deleted item: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(reg, "rule", "style.md")); err != nil {
+		t.Errorf("deleted item not restored: %v", err)
+	}
+
+	if err := runAgmd(t, "restore", "rule:style"); err == nil {
+		t.Error("restore without @rev should fail")
+	}
+	if err := runAgmd(t, "restore", "rule:missing@HEAD"); err == nil {
+		t.Error("restore of an item missing at the revision should fail")
+	}
+}
+
+func TestRegistryPushPull(t *testing.T) {
+	reg := gitRegistry(t)
+	bare := filepath.Join(t.TempDir(), "registry.git")
+	if _, err := (&git.Repo{}).Run("init", "--quiet", "--bare", bare); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git.Open(reg).Run("remote", "add", "origin", bare); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgmd(t, "new", "rule:style", "--no-editor", "--content", "Use tabs."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "registry", "git", "push"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// A second machine clones the registry and receives later changes
+	other := filepath.Join(t.TempDir(), "other")
+	if err := git.Clone(bare, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "edit", "rule:style", "--content", "Use spaces."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "registry", "git", "push"); err != nil {
+		t.Fatalf("second push: %v", err)
+	}
+	if err := runAgmd(t, "--registry", other, "registry", "git", "pull"); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if got := readFile(t, filepath.Join(other, "rule", "style.md")); !strings.Contains(got, "Use spaces.") {
+		t.Errorf("pulled rule:style = %q", got)
+	}
+}
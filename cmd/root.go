@@ -3,6 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+
+	"agmd/pkg/registry"
 
 	"github.com/spf13/cobra"
 )
@@ -38,12 +41,19 @@ Benefits:
 Get started:
   agmd setup    # Initialize your registry
   agmd init     # Create directives.md in your project
-  agmd sync     # Generate AGENTS.md`,
-	Version: "0.1.0",
+  agmd sync     # Generate AGENTS.md
+
+The registry lives in ~/.agmd unless AGMD_HOME or --registry points
+elsewhere, e.g. a directory kept in sync by a dotfiles repository.`,
+	Version:           "0.1.0",
+	PersistentPreRunE: applyRegistryFlag,
 }
 
+var registryFlag string
+
 // Execute runs the root command
 func Execute() {
+	registerToolFlags()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -52,4 +62,18 @@ func Execute() {
 
 func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.PersistentFlags().StringVar(&registryFlag, "registry", "", "Registry directory to use instead of ~/.agmd (overrides $"+registry.HomeEnv+")")
+}
+
+// applyRegistryFlag exports --registry as AGMD_HOME, so every command (and
+// any agmd process it starts) uses the same registry
+func applyRegistryFlag(cmd *cobra.Command, args []string) error {
+	if registryFlag == "" {
+		return nil
+	}
+	path, err := filepath.Abs(registryFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --registry: %w", err)
+	}
+	return os.Setenv(registry.HomeEnv, path)
 }
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/pkg/registry"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// runAgmd executes the root command with args as if run from the shell
+func runAgmd(t *testing.T, args ...string) error {
+	t.Helper()
+	registerToolFlags()
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	return rootCmd.Execute()
+}
+
+// resetFlags restores every flag to its default, as flag values otherwise
+// carry over from one Execute to the next
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
+
+// testProject isolates a test from the real registry: HOME points to an
+// empty directory and the working directory is a fresh project
+func testProject(t *testing.T) (home, project string) {
+	t.Helper()
+	home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(registry.HomeEnv, "")
+	t.Setenv(registry.PathEnv, "")
+
+	project = filepath.Join(t.TempDir(), "myproject")
+	if err := os.Mkdir(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+	return home, project
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRegistryHomeEnv(t *testing.T) {
+	home, project := testProject(t)
+	reg := filepath.Join(t.TempDir(), "registry")
+	t.Setenv(registry.HomeEnv, reg)
+
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".agmd")); !os.IsNotExist(err) {
+		t.Fatalf("setup created ~/.agmd although %s is set", registry.HomeEnv)
+	}
+
+	if err := runAgmd(t, "new", "rule:style", "--no-editor", "--content", "# Style\n\nUse tabs."); err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if got := readFile(t, filepath.Join(reg, "rule", "style.md")); !strings.Contains(got, "Use tabs.") {
+		t.Fatalf("rule:style not written to %s:\n%s", reg, got)
+	}
+
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("# Project\n\n:::include rule:style\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := readFile(t, filepath.Join(project, agentsMdFilename)); !strings.Contains(got, "Use tabs.") {
+		t.Fatalf("AGENTS.md does not include rule:style:\n%s", got)
+	}
+
+	if err := runAgmd(t, "task", "new", "setup-db", "--no-editor", "--content", "Create the schema"); err != nil {
+		t.Fatalf("task new: %v", err)
+	}
+	if err := runAgmd(t, "task", "status", "setup-db", "completed"); err != nil {
+		t.Fatalf("task status: %v", err)
+	}
+	task := readFile(t, filepath.Join(reg, "task", "myproject", "setup-db.md"))
+	if !strings.Contains(task, "status: completed") {
+		t.Fatalf("task not updated in %s:\n%s", reg, task)
+	}
+}
+
+func TestRegistryFlag(t *testing.T) {
+	_, project := testProject(t)
+	envReg := filepath.Join(t.TempDir(), "env")
+	flagReg := filepath.Join(t.TempDir(), "flag")
+	t.Setenv(registry.HomeEnv, envReg)
+
+	// --registry wins over AGMD_HOME
+	if err := runAgmd(t, "--registry", flagReg, "setup"); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := runAgmd(t, "--registry", flagReg, "new", "rule:style", "--no-editor", "--content", "From the flag registry"); err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(flagReg, "rule", "style.md")); err != nil {
+		t.Fatalf("rule:style not written to --registry: %v", err)
+	}
+	if _, err := os.Stat(envReg); !os.IsNotExist(err) {
+		t.Fatalf("%s registry was created although --registry was given", registry.HomeEnv)
+	}
+
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(":::include rule:style\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "--registry", flagReg, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := readFile(t, filepath.Join(project, agentsMdFilename)); !strings.Contains(got, "From the flag registry") {
+		t.Fatalf("AGENTS.md does not include rule:style:\n%s", got)
+	}
+
+	if err := runAgmd(t, "--registry", flagReg, "task", "new", "deploy", "--no-editor", "--content", "Ship it"); err != nil {
+		t.Fatalf("task new: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(flagReg, "task", "myproject", "deploy.md")); err != nil {
+		t.Fatalf("task not written to --registry: %v", err)
+	}
+}
+
+// captureOutput runs fn and returns what it printed to stdout and stderr
+func captureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	capture := func(file **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := *file
+		*file = w
+		done := make(chan string)
+		go func() {
+			data, _ := io.ReadAll(r)
+			done <- string(data)
+		}()
+		return func() string {
+			w.Close()
+			*file = saved
+			return <-done
+		}
+	}
+	stopOut := capture(&os.Stdout)
+	stopErr := capture(&os.Stderr)
+	fn()
+	return stopOut(), stopErr()
+}
@@ -16,6 +16,8 @@ var setupCmd = &cobra.Command{
 	Short: "Initialize the agmd registry",
 	Long: `Create the ~/.agmd directory for storing reusable content.
 
+Set AGMD_HOME or pass --registry to keep the registry somewhere else.
+
 The registry starts empty. Create items with any type you want:
   agmd new rule:my-rule
   agmd new framework:my-framework
@@ -23,7 +25,8 @@ The registry starts empty. Create items with any type you want:
 
 Examples:
   agmd setup              # Initialize registry
-  agmd setup --force      # Reinitialize`,
+  agmd setup --force      # Reinitialize
+  agmd setup --registry ~/dotfiles/agmd   # Registry in a dotfiles repo`,
 	RunE: runSetup,
 }
 
@@ -3,14 +3,22 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
+	"agmd/pkg/parser"
 	"agmd/pkg/registry"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
-var showRaw bool
+var (
+	showRaw     bool
+	showOutline bool
+	showWhich   bool
+	showDeps    bool
+)
 
 var showCmd = &cobra.Command{
 	Use:   "show <type:name>",
@@ -23,10 +31,21 @@ For tasks, use the task subcommand:
   agmd task show setup-db
 
 Examples:
-  agmd show rule:typescript        # Show rule content
-  agmd show workflow:commit        # Show workflow content
-  agmd show guide:agmd             # Show guide content
-  agmd show rule:typescript --raw  # Include frontmatter`,
+  agmd show rule:typescript           # Show rule content
+  agmd show workflow:commit           # Show workflow content
+  agmd show guide:agmd                # Show guide content
+  agmd show rule:typescript --raw     # Include frontmatter
+  agmd show guide:handbook --outline  # List headings and their #anchors
+  agmd show rule:security --which     # Show which registry layer provides it
+  agmd show rule:react-hooks --deps   # Show the items it requires and conflicts with
+
+Items are looked up in the project's .agmd/ directory, then ~/.agmd, then
+the layers listed in AGMD_PATH (or path = [...] in ~/.agmd/config.toml),
+then the sources added with 'agmd source add'. Prefix the type with a
+source name to read that source's item (agmd show team/rule:security).
+
+An anchor selects one section of an item in directives.md:
+  :::include guide:handbook#testing`,
 	Args: cobra.ExactArgs(1),
 	RunE: runShow,
 }
@@ -34,6 +53,9 @@ Examples:
 func init() {
 	rootCmd.AddCommand(showCmd)
 	showCmd.Flags().BoolVar(&showRaw, "raw", false, "Include frontmatter in output")
+	showCmd.Flags().BoolVar(&showOutline, "outline", false, "List the item's headings and their anchors")
+	showCmd.Flags().BoolVar(&showWhich, "which", false, "Print the file providing the item and the layers it shadows")
+	showCmd.Flags().BoolVar(&showDeps, "deps", false, "Print the tree of items it requires and the order sync renders them in")
 }
 
 func runShow(cmd *cobra.Command, args []string) error {
@@ -61,6 +83,13 @@ func runShow(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("registry not found\nRun 'agmd setup' first")
 	}
 
+	if showWhich {
+		return printWhich(reg, itemType, name)
+	}
+	if showDeps {
+		return printDeps(reg, itemType+":"+name)
+	}
+
 	// Get item
 	item, err := reg.GetItem(itemType, name)
 	if err != nil {
@@ -68,7 +97,9 @@ func runShow(cmd *cobra.Command, args []string) error {
 	}
 
 	// Output content
-	if showRaw {
+	if showOutline {
+		printOutline(itemType, name, item.Content)
+	} else if showRaw {
 		// Read raw file with frontmatter
 		raw, err := os.ReadFile(item.FilePath)
 		if err != nil {
@@ -82,3 +113,79 @@ func runShow(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// printOutline prints the headings of an item indented by level, with the
+// type:name#anchor reference that includes each one
+func printOutline(itemType, name, content string) {
+	headings := parser.Outline([]byte(content))
+	if len(headings) == 0 {
+		fmt.Printf("%s:%s has no headings\n", itemType, name)
+		return
+	}
+
+	blue := color.New(color.FgBlue).SprintFunc()
+	for _, heading := range headings {
+		indent := strings.Repeat("  ", heading.Level-1)
+		fmt.Printf("%s%s %s  %s\n", indent, strings.Repeat("#", heading.Level), heading.Title, blue(itemType+":"+name+"#"+heading.Slug))
+	}
+}
+
+// printWhich prints the file that provides type:name and the files it
+// shadows in lower-priority layers
+func printWhich(reg *registry.Registry, itemType, name string) error {
+	paths := reg.Which(itemType, name)
+	if len(paths) == 0 {
+		return fmt.Errorf("%s:%s not found in any registry layer:\n  %s", itemType, name, strings.Join(reg.SearchPath(), "\n  "))
+	}
+
+	dim := color.New(color.Faint).SprintFunc()
+	fmt.Printf("%s  %s\n", paths[0], dim("(layer "+reg.LayerOf(paths[0])+")"))
+	for _, path := range paths[1:] {
+		fmt.Printf("%s  %s\n", dim(path), dim("(shadowed)"))
+	}
+	return nil
+}
+
+// printDeps prints the requires: tree of an item, what it conflicts with,
+// and the order sync renders the items in
+func printDeps(reg *registry.Registry, ref string) error {
+	deps, err := reg.ResolveDependencies(ref)
+	if err != nil {
+		return err
+	}
+	if len(deps.Order) == 0 {
+		return fmt.Errorf("%s not found", ref)
+	}
+
+	dim := color.New(color.Faint).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	var printRequires func(ref, prefix string)
+	printRequires = func(ref, prefix string) {
+		requires := deps.Requires[ref]
+		for i, required := range requires {
+			connector, childPrefix := "├── ", prefix+"│   "
+			if i == len(requires)-1 {
+				connector, childPrefix = "└── ", prefix+"    "
+			}
+			label := required
+			if slices.Contains(deps.Missing, required) {
+				label += "  " + yellow("(not in registry)")
+			}
+			fmt.Printf("%s%s\n", dim(prefix+connector), label)
+			printRequires(required, childPrefix)
+		}
+	}
+
+	fmt.Println(cyan(ref))
+	printRequires(ref, "")
+
+	if conflicts := deps.Conflicts[ref]; len(conflicts) > 0 {
+		fmt.Printf("\nConflicts with: %s\n", strings.Join(conflicts, ", "))
+	}
+	if len(deps.Order) > 1 {
+		fmt.Printf("\nSync order: %s\n", strings.Join(deps.Order, " → "))
+	}
+	return nil
+}
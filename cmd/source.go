@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"agmd/pkg/git"
+	"agmd/pkg/registry"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Subscribe to shared registries published as git repositories",
+	Long: `Subscribe to shared registries, such as the rules a platform team
+publishes in a git repository.
+
+Each source is cloned into ~/.agmd/.sources/<name> and becomes a read-only
+registry layer, searched after the project's .agmd/, your personal registry
+and AGMD_PATH, in the order the sources were added (the [[source]] entries
+of config.toml). Items you create with the same type:name override them.
+
+Reference an item of one source explicitly by prefixing its type:
+  :::include team/rule:security
+  :::list team/rule
+  *
+  :::end
+
+Subcommands:
+  add       Clone a source
+  update    Fetch new revisions of sources
+  list      Show sources and their revisions
+  remove    Unsubscribe from a source
+
+Examples:
+  agmd source add team git@github.com:acme/agmd-rules.git
+  agmd source add team ../agmd-rules.git         # Local or file:// repositories work too
+  agmd source update                             # Fetch every source
+  agmd show team/rule:security`,
+}
+
+var sourceAddCmd = &cobra.Command{
+	Use:   "add <name> <git-url-or-path>",
+	Short: "Clone a shared registry as a read-only layer",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runSourceAdd,
+}
+
+var sourceUpdateCmd = &cobra.Command{
+	Use:   "update [name...]",
+	Short: "Fetch new revisions of sources",
+	Long: `Fetch the latest revision of every source (or only the named ones).
+
+Sources are read-only: local changes in their clones are discarded. A source
+listed in config.toml but not cloned yet (e.g. on a new machine) is cloned.`,
+	RunE: runSourceUpdate,
+}
+
+var sourceListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "Show sources and their revisions",
+	Args:    cobra.NoArgs,
+	RunE:    runSourceList,
+}
+
+var sourceRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Unsubscribe from a source and delete its clone",
+	Args:    cobra.ExactArgs(1),
+	RunE:    runSourceRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(sourceCmd)
+	sourceCmd.AddCommand(sourceAddCmd)
+	sourceCmd.AddCommand(sourceUpdateCmd)
+	sourceCmd.AddCommand(sourceListCmd)
+	sourceCmd.AddCommand(sourceRemoveCmd)
+}
+
+// loadSourceRegistry returns the registry sources are added to
+func loadSourceRegistry() (*registry.Registry, error) {
+	reg, err := registry.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+	if !reg.Exists() {
+		return nil, fmt.Errorf("registry not found at %s\nRun 'agmd setup' first", reg.BasePath)
+	}
+	return reg, nil
+}
+
+func runSourceAdd(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+
+	name, url := args[0], args[1]
+	reg, err := loadSourceRegistry()
+	if err != nil {
+		return err
+	}
+
+	// Local repositories are recorded by absolute path, so updates work
+	// from any directory
+	if _, err := os.Stat(url); err == nil {
+		if url, err = filepath.Abs(url); err != nil {
+			return err
+		}
+	}
+
+	if err := reg.AddSource(registry.Source{Name: name, URL: url}); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s Cloning %s...\n", blue("→"), url)
+	if err := git.Clone(url, reg.SourceDir(name)); err != nil {
+		reg.RemoveSource(name)
+		return fmt.Errorf("failed to clone source %q: %w", name, err)
+	}
+
+	fmt.Printf("%s Added source %s (%d items)\n", green("✓"), name, countItems(reg.SourceDir(name)))
+	fmt.Printf("\nUse its items like your own, or explicitly as %s/TYPE:NAME\n", name)
+	autoCommit(reg, "Add source %s", name)
+	return nil
+}
+
+func runSourceUpdate(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	reg, err := loadSourceRegistry()
+	if err != nil {
+		return err
+	}
+	config, err := reg.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	sources := config.Sources
+	if len(args) > 0 {
+		sources = nil
+		for _, name := range args {
+			source, ok := config.FindSource(name)
+			if !ok {
+				return fmt.Errorf("source %q not found\nRun 'agmd source list' to see your sources", name)
+			}
+			sources = append(sources, *source)
+		}
+	}
+	if len(sources) == 0 {
+		fmt.Println("No sources. Add one with 'agmd source add <name> <git-url-or-path>'")
+		return nil
+	}
+
+	failed := 0
+	for _, source := range sources {
+		dir := reg.SourceDir(source.Name)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := git.Clone(source.URL, dir); err != nil {
+				fmt.Printf("%s %s: %v\n", yellow("⚠"), source.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s Cloned %s\n", green("✓"), source.Name)
+			continue
+		}
+
+		repo := git.Open(dir)
+		before, _ := repo.Run("rev-parse", "--short", "HEAD")
+		_, err := repo.Run("fetch", "--quiet")
+		if err == nil {
+			_, err = repo.Run("reset", "--hard", "--quiet", "@{upstream}")
+		}
+		if err != nil {
+			fmt.Printf("%s %s: %v\n", yellow("⚠"), source.Name, err)
+			failed++
+			continue
+		}
+
+		after, _ := repo.Run("rev-parse", "--short", "HEAD")
+		if before == after {
+			fmt.Printf("%s %s is up to date (%s)\n", green("✓"), source.Name, after)
+		} else {
+			fmt.Printf("%s Updated %s (%s → %s)\n", green("✓"), source.Name, before, after)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d source(s) could not be updated", failed)
+	}
+	return nil
+}
+
+func runSourceList(cmd *cobra.Command, args []string) error {
+	cyan := color.New(color.FgCyan).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	reg, err := loadSourceRegistry()
+	if err != nil {
+		return err
+	}
+	sources, err := reg.Sources()
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		fmt.Println("No sources. Add one with 'agmd source add <name> <git-url-or-path>'")
+		return nil
+	}
+
+	for _, source := range sources {
+		dir := reg.SourceDir(source.Name)
+		revision := yellow("not cloned; run 'agmd source update'")
+		if _, err := os.Stat(dir); err == nil {
+			if rev, err := git.Open(dir).Run("rev-parse", "--short", "HEAD"); err == nil {
+				revision = fmt.Sprintf("%s, %d items", rev, countItems(dir))
+			}
+		}
+		fmt.Printf("%s  %s  (%s)\n", cyan(source.Name), source.URL, revision)
+	}
+	return nil
+}
+
+func runSourceRemove(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+
+	reg, err := loadSourceRegistry()
+	if err != nil {
+		return err
+	}
+	if err := reg.RemoveSource(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s Removed source %s\n", green("✓"), args[0])
+	autoCommit(reg, "Remove source %s", args[0])
+	return nil
+}
+
+// countItems returns the number of items in a registry directory
+func countItems(dir string) int {
+	reg := &registry.Registry{BasePath: dir}
+	types, _ := reg.ListTypes()
+	count := 0
+	for _, itemType := range types {
+		items, _ := reg.ListItems(itemType)
+		count += len(items)
+	}
+	return count
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/pkg/git"
+	"agmd/pkg/registry"
+)
+
+// teamRepo publishes a shared registry as a local bare repository and
+// returns the bare repository and the working copy commits are pushed from
+func teamRepo(t *testing.T, items map[string]string) (bare, work string) {
+	t.Helper()
+	dir := t.TempDir()
+	bare, work = filepath.Join(dir, "team.git"), filepath.Join(dir, "work")
+	if _, err := (&git.Repo{}).Run("init", "--quiet", "--bare", bare); err != nil {
+		t.Fatal(err)
+	}
+	if err := git.Clone(bare, work); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, work, items, "Publish rules")
+	if _, err := git.Open(work).Run("push", "--quiet", "origin", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	return bare, work
+}
+
+// publish commits items (path → content) to a team working copy and pushes
+func publish(t *testing.T, work string, items map[string]string, message string) {
+	t.Helper()
+	for path, content := range items {
+		path = filepath.Join(work, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := git.Open(work)
+	if _, err := repo.CommitAll(message); err != nil {
+		t.Fatal(err)
+	}
+	if repo.HasUpstream() {
+		if _, err := repo.Run("push", "--quiet"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSourceAddAndSync(t *testing.T) {
+	_, project := testProject(t)
+	setupGit(t)
+	reg := filepath.Join(t.TempDir(), "registry")
+	t.Setenv(registry.HomeEnv, reg)
+
+	bare, work := teamRepo(t, map[string]string{
+		"rule/security.md": "# Security\n\nNo secrets in logs.\n",
+		"rule/style.md":    "# Style\n\nTeam style.\n",
+	})
+
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "new", "rule:style", "--no-editor", "--content", "# Style\n\nMy style."); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "source", "add", "team", "file://"+bare); err != nil {
+		t.Fatalf("source add: %v", err)
+	}
+
+	directives := `:::include rule:security
+:::include rule:style
+:::include team/rule:style
+`
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	agents := readFile(t, filepath.Join(project, agentsMdFilename))
+	for _, want := range []string{"No secrets in logs.", "My style.", "Team style."} {
+		if !strings.Contains(agents, want) {
+			t.Errorf("AGENTS.md is missing %q:\n%s", want, agents)
+		}
+	}
+
+	// Source items are read-only
+	if err := runAgmd(t, "edit", "rule:security", "--content", "Anything goes."); err == nil {
+		t.Error("edit of a source item should fail")
+	}
+
+	// New revisions arrive with source update
+	publish(t, work, map[string]string{"rule/security.md": "# Security\n\nRotate keys monthly.\n"}, "Tighten security")
+	if err := runAgmd(t, "source", "update"); err != nil {
+		t.Fatalf("source update: %v", err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if agents := readFile(t, filepath.Join(project, agentsMdFilename)); !strings.Contains(agents, "Rotate keys monthly.") {
+		t.Errorf("AGENTS.md does not have the updated source item:\n%s", agents)
+	}
+
+	if err := runAgmd(t, "source", "remove", "team"); err != nil {
+		t.Fatalf("source remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(reg, registry.SourcesDirname, "team")); !os.IsNotExist(err) {
+		t.Error("source clone left behind after remove")
+	}
+	if err := runAgmd(t, "sync"); err == nil {
+		t.Error("sync should fail once the source providing rule:security is removed")
+	}
+}
+
+func TestSourceUpdateClonesMissing(t *testing.T) {
+	testProject(t)
+	setupGit(t)
+	reg := filepath.Join(t.TempDir(), "registry")
+	t.Setenv(registry.HomeEnv, reg)
+	bare, _ := teamRepo(t, map[string]string{"rule/security.md": "No secrets in logs.\n"})
+
+	// config.toml copied from another machine lists a source not cloned here
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	config := &registry.Config{Sources: []registry.Source{{Name: "team", URL: bare}}}
+	if err := (&registry.Registry{BasePath: reg}).SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgmd(t, "source", "update", "team"); err != nil {
+		t.Fatalf("source update: %v", err)
+	}
+	if err := runAgmd(t, "show", "team/rule:security"); err != nil {
+		t.Errorf("show team/rule:security: %v", err)
+	}
+	if err := runAgmd(t, "source", "update", "missing"); err == nil {
+		t.Error("update of an unknown source should fail")
+	}
+}
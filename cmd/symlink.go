@@ -3,73 +3,175 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"agmd/internal/config"
 	"agmd/internal/symlink"
+	"agmd/pkg/generator"
+	"agmd/pkg/parser"
+	"agmd/pkg/registry"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var (
-	symlinkClaude   bool
-	symlinkCursor   bool
-	symlinkWindsurf bool
-	symlinkCopilot  bool
-	symlinkAider    bool
-	symlinkAll      bool
+	symlinkTools  = map[string]*bool{} // --claude, --cursor, ... by tool name
+	symlinkTool   []string
+	symlinkAll    bool
+	symlinkMode   string
+	symlinkDryRun bool
 )
 
 var symlinkCmd = &cobra.Command{
 	Use:   "symlink",
-	Short: "Manage symlinks",
-	Long:  `Manage symlinks to agent.md for different AI coding assistants.`,
+	Short: "Manage the files AI tools read AGENTS.md from",
+	Long: `Manage the files different AI coding assistants read AGENTS.md from.
+
+Tools that read plain markdown (CLAUDE.md, .windsurfrules,
+.github/copilot-instructions.md) get AGENTS.md in one of these modes:
+  symlink-relative  a symlink by a path relative to the file (the default)
+  copy              a copy with a generated-file header, rewritten by every
+                    'agmd sync'; for zip exports, Docker build contexts and git
+                    hosting UIs that do not follow symlinks
+  hardlink          a hard link
+  adapter           AGENTS.md between the header and footer set in config.toml
+Other tools get a file in their own format, rewritten by every 'agmd sync':
+  cursor  .cursor/rules/agents.mdc, a project rule that always applies
+  aider   .aider.conf.yml, with AGENTS.md added to read: (other settings are kept)
+
+More tools are declared under [[tool]] in ~/.agmd/config.toml, or in the
+project's .agmd/config.toml, which also overrides built-in tools:
+  [[tool]]
+  name = "kiro"
+  path = ".kiro/steering/agents.md"
+  mode = "adapter"                       # symlink (default), copy, hardlink or adapter
+  header = "---\ninclusion: always\n---"  # {{tool}}, {{path}} and {{source}} are replaced
+Each declared tool gets a flag of its own in 'agmd symlink add'.`,
 }
 
 var symlinkAddCmd = &cobra.Command{
 	Use:   "add",
-	Short: "Add symlinks",
-	Long: `Create symlinks for AI coding assistants.
+	Short: "Add symlinks and tool files",
+	Long: `Create the files AI coding assistants read AGENTS.md from.
+
+'agmd sync' keeps them up to date afterwards, as it does for the tools listed
+under targets: in the frontmatter of directives.md. Files keep their mode
+unless config.toml or modes: in the frontmatter sets another one.
 
 Examples:
   agmd symlink add --claude
   agmd symlink add --all
-  agmd symlink add --claude --cursor`,
+  agmd symlink add --claude --cursor
+  agmd symlink add --copilot --mode copy
+  agmd symlink add --tool kiro       # A tool declared in config.toml (or --kiro)`,
 	RunE: runSymlinkAdd,
 }
 
 var symlinkListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List symlinks",
-	Long:  `List all symlinks and their status.`,
+	Short: "List symlinks and tool files",
+	Long:  `List the file of every tool and its status. Copies that differ from AGENTS.md are reported as stale.`,
 	RunE:  runSymlinkList,
 }
 
 var symlinkRemoveCmd = &cobra.Command{
 	Use:   "remove [filename]",
-	Short: "Remove a symlink",
-	Long: `Remove a specific symlink.
+	Short: "Remove a symlink or tool file",
+	Long: `Remove a specific symlink, copy, hard link or generated tool file. For .aider.conf.yml only
+the read: entry for AGENTS.md is removed, unless nothing else is set.
 
 Examples:
   agmd symlink remove CLAUDE.md
-  agmd symlink remove .cursorrules`,
+  agmd symlink remove .cursor/rules/agents.mdc`,
 	Args: cobra.ExactArgs(1),
 	RunE: runSymlinkRemove,
 }
 
+var symlinkRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Fix broken symlinks to AGENTS.md",
+	Long: `Relink tool and legacy files (CLAUDE.md, .github/copilot-instructions.md,
+agent.md, ...) that are broken symlinks, e.g. after AGENTS.md or the file
+itself was renamed, or that lead to AGENTS.md by an absolute or unusual path.
+They become symlinks relative to their own directory. Symlinks to other files
+that exist are left alone. A .cursorrules made by older versions is replaced
+by .cursor/rules/agents.mdc.
+
+Examples:
+  agmd symlink repair --dry-run   # Report what would be fixed
+  agmd symlink repair`,
+	RunE: runSymlinkRepair,
+}
+
 func init() {
 	rootCmd.AddCommand(symlinkCmd)
 	symlinkCmd.AddCommand(symlinkAddCmd)
 	symlinkCmd.AddCommand(symlinkListCmd)
 	symlinkCmd.AddCommand(symlinkRemoveCmd)
+	symlinkCmd.AddCommand(symlinkRepairCmd)
+
+	symlinkRepairCmd.Flags().BoolVar(&symlinkDryRun, "dry-run", false, "Report the links to fix without changing them")
 
 	// Add flags for symlink add
-	symlinkAddCmd.Flags().BoolVar(&symlinkClaude, "claude", false, "Create CLAUDE.md symlink")
-	symlinkAddCmd.Flags().BoolVar(&symlinkCursor, "cursor", false, "Create .cursorrules symlink")
-	symlinkAddCmd.Flags().BoolVar(&symlinkWindsurf, "windsurf", false, "Create .windsurfrules symlink")
-	symlinkAddCmd.Flags().BoolVar(&symlinkCopilot, "copilot", false, "Create .github/copilot-instructions.md symlink")
-	symlinkAddCmd.Flags().BoolVar(&symlinkAider, "aider", false, "Create .aider.conf.yml symlink")
 	symlinkAddCmd.Flags().BoolVar(&symlinkAll, "all", false, "Create symlinks for all tools")
+	symlinkAddCmd.Flags().StringArrayVar(&symlinkTool, "tool", nil, "Tool to set up, by name (repeatable)")
+	symlinkAddCmd.Flags().StringVar(&symlinkMode, "mode", "", "How markdown tools get AGENTS.md: symlink-relative, copy, hardlink or adapter (default: the mode in config.toml or of the existing file, else symlink-relative)")
+	for _, tool := range config.AvailableTools() {
+		addToolFlag(tool)
+	}
+}
+
+// addToolFlag adds the --<name> flag of symlink add for a tool; a name taken
+// by another flag is only available through --tool
+func addToolFlag(tool config.ToolConfig) {
+	if symlinkAddCmd.Flags().Lookup(tool.Name) != nil {
+		return
+	}
+	symlinkTools[tool.Name] = symlinkAddCmd.Flags().Bool(tool.Name, false, "Set up "+tool.Filename)
+}
+
+// registerToolFlags adds the --<name> flags of the tools declared in
+// config.toml, before the command line is parsed. --registry is not applied
+// yet, so they come from $AGMD_HOME or ~/.agmd (and the project's
+// .agmd/config.toml); --tool works with any registry.
+func registerToolFlags() {
+	if err := loadTools(); err != nil {
+		return // Commands report the broken config.toml
+	}
+	for _, tool := range config.AvailableTools() {
+		addToolFlag(tool)
+	}
+}
+
+// loadTools adds the tools declared in config.toml of the personal registry
+// and the project to the tools agmd writes
+func loadTools() error {
+	reg, err := registry.New()
+	if err != nil {
+		return err
+	}
+	targets, err := reg.Tools()
+	if err != nil {
+		return err
+	}
+
+	var tools []config.ToolConfig
+	for _, target := range targets {
+		tool := config.ToolConfig{Name: target.Name, Filename: target.Path, Header: target.Header, Footer: target.Footer}
+		if tool.Filename != "" {
+			tool.Filename = filepath.ToSlash(filepath.Clean(tool.Filename))
+		}
+		if target.Mode != "" {
+			if tool.Mode, err = config.ParseLinkMode(target.Mode); err != nil {
+				return fmt.Errorf("tool %s: %w", target.Name, err)
+			}
+		}
+		tools = append(tools, tool)
+	}
+	return config.Configure(tools)
 }
 
 func runSymlinkAdd(cmd *cobra.Command, args []string) error {
@@ -77,57 +179,66 @@ func runSymlinkAdd(cmd *cobra.Command, args []string) error {
 	yellow := color.New(color.FgYellow).SprintFunc()
 	blue := color.New(color.FgBlue).SprintFunc()
 
-	// Check if agent.md exists
-	if _, err := os.Stat(config.AgentMdFilename); os.IsNotExist(err) {
-		return fmt.Errorf("%s does not exist. Run 'agmd init' first", config.AgentMdFilename)
+	manager := symlink.NewManager(agentsMdFilename)
+	if err := manager.Verify(); err != nil {
+		return fmt.Errorf("%w. Run 'agmd sync' first", err)
+	}
+	if err := loadTools(); err != nil {
+		return err
 	}
 
-	// Determine which tools to create symlinks for
-	var toolsToCreate []config.ToolConfig
-
-	if symlinkAll {
-		toolsToCreate = config.AvailableTools()
-	} else {
-		if symlinkClaude {
-			if tool := config.GetToolByName("claude"); tool != nil {
-				toolsToCreate = append(toolsToCreate, *tool)
-			}
-		}
-		if symlinkCursor {
-			if tool := config.GetToolByName("cursor"); tool != nil {
-				toolsToCreate = append(toolsToCreate, *tool)
-			}
+	var mode config.LinkMode
+	if symlinkMode != "" {
+		var err error
+		if mode, err = config.ParseLinkMode(symlinkMode); err != nil {
+			return err
 		}
-		if symlinkWindsurf {
-			if tool := config.GetToolByName("windsurf"); tool != nil {
-				toolsToCreate = append(toolsToCreate, *tool)
-			}
-		}
-		if symlinkCopilot {
-			if tool := config.GetToolByName("copilot"); tool != nil {
-				toolsToCreate = append(toolsToCreate, *tool)
-			}
+	}
+
+	// Determine which tools to create symlinks for
+	var toolsToCreate []config.ToolAdapter
+
+	for _, name := range symlinkTool {
+		if config.GetAdapter(name) == nil {
+			return fmt.Errorf("unknown tool %q (expected one of: %s)", name, strings.Join(toolNames(), ", "))
 		}
-		if symlinkAider {
-			if tool := config.GetToolByName("aider"); tool != nil {
-				toolsToCreate = append(toolsToCreate, *tool)
-			}
+	}
+	for _, adapter := range config.Adapters() {
+		name := adapter.Tool().Name
+		flag := symlinkTools[name]
+		if symlinkAll || slices.Contains(symlinkTool, name) || (flag != nil && *flag) {
+			toolsToCreate = append(toolsToCreate, adapter)
 		}
 	}
 
 	if len(toolsToCreate) == 0 {
-		return fmt.Errorf("no tools specified. Use --claude, --cursor, etc., or --all")
+		return fmt.Errorf("no tools specified. Use --claude, --cursor, etc., --tool NAME or --all")
 	}
 
-	// Create symlinks
+	// Create symlinks and tool files
 	fmt.Printf("%s Creating symlinks...\n", blue("→"))
-	manager := symlink.NewManager(config.AgentMdFilename)
 
-	for _, tool := range toolsToCreate {
-		if err := manager.Create(tool); err != nil {
+	gen := toolGenerator()
+	for _, adapter := range toolsToCreate {
+		adapter = withMode(adapter, mode)
+		tool := adapter.Tool()
+		doc, err := toolDocument(gen, tool.Name)
+		if err != nil {
+			return err
+		}
+		if _, _, err := manager.Write(adapter, doc); err != nil {
 			fmt.Printf("%s Failed to create %s: %v\n", yellow("⚠"), tool.Filename, err)
-		} else {
-			fmt.Printf("%s Created %s → %s\n", green("✓"), tool.Filename, config.AgentMdFilename)
+			continue
+		}
+		switch linker, _ := adapter.(config.Linker); {
+		case linker == nil:
+			fmt.Printf("%s Created %s from %s\n", green("✓"), tool.Filename, agentsMdFilename)
+		case linker.Mode() == config.ModeCopy:
+			fmt.Printf("%s Created %s (copy of %s)\n", green("✓"), tool.Filename, agentsMdFilename)
+		case linker.Mode() == config.ModeHardlink:
+			fmt.Printf("%s Created %s (hard link to %s)\n", green("✓"), tool.Filename, agentsMdFilename)
+		default:
+			fmt.Printf("%s Created %s → %s\n", green("✓"), tool.Filename, config.LinkTarget(tool.Filename, agentsMdFilename))
 		}
 	}
 
@@ -140,17 +251,34 @@ func runSymlinkList(cmd *cobra.Command, args []string) error {
 	yellow := color.New(color.FgYellow).SprintFunc()
 	cyan := color.New(color.FgCyan).SprintFunc()
 
-	manager := symlink.NewManager(config.AgentMdFilename)
-	statuses := manager.List()
+	if err := loadTools(); err != nil {
+		return err
+	}
+	statuses := toolManager().List()
 
 	fmt.Printf("%s Symlink Status:\n\n", cyan("ℹ"))
 
 	for _, status := range statuses {
+		for _, legacy := range status.Legacy {
+			fmt.Printf("%s %s (left by an older agmd, run 'agmd symlink repair' to replace it by %s)\n", yellow("⚠"), legacy, status.Tool.Filename)
+		}
 		if status.Exists {
-			if status.IsValid {
-				fmt.Printf("%s %s → %s\n", green("✓"), status.Tool.Filename, config.AgentMdFilename)
+			if status.Generated && status.IsValid {
+				fmt.Printf("%s %s (generated from %s)\n", green("✓"), status.Tool.Filename, agentsMdFilename)
+			} else if status.Generated {
+				fmt.Printf("%s %s (exists but does not read %s)\n", yellow("⚠"), status.Tool.Filename, agentsMdFilename)
+			} else if status.Stale {
+				fmt.Printf("%s %s (stale copy: differs from %s, run 'agmd sync')\n", yellow("⚠"), status.Tool.Filename, agentsMdFilename)
+			} else if status.Mode == config.ModeCopy {
+				fmt.Printf("%s %s (copy of %s)\n", green("✓"), status.Tool.Filename, agentsMdFilename)
+			} else if status.Mode == config.ModeHardlink {
+				fmt.Printf("%s %s (hard link to %s)\n", green("✓"), status.Tool.Filename, agentsMdFilename)
+			} else if status.IsValid {
+				fmt.Printf("%s %s → %s\n", green("✓"), status.Tool.Filename, status.Target)
+			} else if status.Target != "" {
+				fmt.Printf("%s %s (exists but invalid: points to %s, see 'agmd symlink repair')\n", yellow("⚠"), status.Tool.Filename, status.Target)
 			} else {
-				fmt.Printf("%s %s (exists but invalid: points to %s)\n", yellow("⚠"), status.Tool.Filename, status.Target)
+				fmt.Printf("%s %s (exists but not created by agmd)\n", yellow("⚠"), status.Tool.Filename)
 			}
 		} else {
 			fmt.Printf("%s %s (not created)\n", red("✗"), status.Tool.Filename)
@@ -166,9 +294,12 @@ func runSymlinkRemove(cmd *cobra.Command, args []string) error {
 
 	filename := args[0]
 
-	fmt.Printf("%s Removing symlink %s...\n", blue("→"), filename)
+	fmt.Printf("%s Removing %s...\n", blue("→"), filename)
+	if err := loadTools(); err != nil {
+		return err
+	}
 
-	manager := symlink.NewManager(config.AgentMdFilename)
+	manager := symlink.NewManager(agentsMdFilename)
 	if err := manager.Remove(filename); err != nil {
 		return err
 	}
@@ -176,3 +307,144 @@ func runSymlinkRemove(cmd *cobra.Command, args []string) error {
 	fmt.Printf("%s Removed %s\n", green("✓"), filename)
 	return nil
 }
+
+func runSymlinkRepair(cmd *cobra.Command, args []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+	cyan := color.New(color.FgCyan).SprintFunc()
+
+	if err := loadTools(); err != nil {
+		return err
+	}
+	repairs, err := toolManager().Repair(symlinkDryRun)
+	for _, repair := range repairs {
+		if repair.Replacement != "" {
+			if symlinkDryRun {
+				fmt.Printf("%s Would replace %s by %s\n", cyan("ℹ"), repair.Path, repair.Replacement)
+			} else {
+				fmt.Printf("%s Replaced %s by %s\n", green("✓"), repair.Path, repair.Replacement)
+			}
+			continue
+		}
+		if symlinkDryRun {
+			fmt.Printf("%s Would relink %s: %s → %s\n", cyan("ℹ"), repair.Path, repair.Target, repair.NewTarget)
+		} else {
+			fmt.Printf("%s Relinked %s: %s → %s\n", green("✓"), repair.Path, repair.Target, repair.NewTarget)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(repairs) == 0 {
+		fmt.Printf("%s No symlinks to repair\n", green("✓"))
+	}
+	return nil
+}
+
+// withMode sets how a tool that reads plain markdown gets AGENTS.md: mode
+// when given, else the mode set in config.toml or the one its file already
+// has. Other adapters are returned as they are.
+func withMode(adapter config.ToolAdapter, mode config.LinkMode) config.ToolAdapter {
+	linker, ok := adapter.(config.Linker)
+	if !ok || (mode == "" && adapter.Tool().Mode != "") {
+		return adapter
+	}
+	if mode == "" {
+		mode = config.DetectMode(".", adapter.Tool().Filename, agentsMdFilename)
+	}
+	return linker.WithMode(mode)
+}
+
+// toolManager returns a manager that tells stale copies by the document each
+// tool is rendered from
+func toolManager() *symlink.Manager {
+	manager := symlink.NewManager(agentsMdFilename)
+	gen := toolGenerator()
+	manager.Document = func(tool string) (*config.Document, error) {
+		return toolDocument(gen, tool)
+	}
+	return manager
+}
+
+// toolGenerator returns a generator over the registry set up like the last
+// sync (its --set vars and other flags recorded in agmd.lock), for tool
+// documents that split out the items of directives.md, or nil when there is
+// no registry
+func toolGenerator() *generator.Generator {
+	reg, err := registry.New()
+	if err != nil || !reg.Exists() {
+		return nil
+	}
+	settings, err := loadSyncSettings()
+	if err != nil {
+		return generator.New(reg, nil)
+	}
+	gen, err := syncGenerator(reg, settings)
+	if err != nil {
+		return generator.New(reg, nil)
+	}
+	return gen
+}
+
+// toolDocument reads AGENTS.md for the adapter of tool and, when gen can
+// expand directives.md, expands it again for the tool (so :::if target=<tool>
+// blocks apply) and splits it into the items directives.md includes
+func toolDocument(gen *generator.Generator, tool string) (*config.Document, error) {
+	agents, err := os.ReadFile(agentsMdFilename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", agentsMdFilename, err)
+	}
+	doc := &config.Document{Agents: agents}
+	if gen == nil {
+		return doc, nil
+	}
+	if _, err := os.Stat(directivesMdFilename); err != nil {
+		return doc, nil
+	}
+
+	targeted := *gen
+	targeted.Target = tool
+	expansion, err := targeted.Expand(directivesMdFilename)
+	if err != nil {
+		// Tools still get AGENTS.md as a whole; sync reports the problem
+		return doc, nil
+	}
+	doc.Agents = expansion.Output
+
+	// Provenance markers tell where each item starts and ends
+	if !targeted.Provenance {
+		marked := targeted
+		marked.Provenance = true
+		if expansion, err = marked.Expand(directivesMdFilename); err != nil {
+			return doc, nil
+		}
+	}
+	output := string(expansion.Output)
+	regions, err := parser.ParseRegions(output)
+	if err != nil {
+		return nil, err
+	}
+
+	isItem := func(region *parser.Region) bool { return region.Type != "file" }
+	for _, region := range regions {
+		if !isItem(region) {
+			continue
+		}
+		item := config.DocumentItem{
+			Ref:     region.Ref(),
+			Args:    strings.TrimSpace(strings.TrimPrefix(region.Directive(), ":::include "+region.Ref())),
+			Content: []byte(parser.StripMarkers(region.Content)),
+		}
+		name, _, _ := strings.Cut(region.Name, "#")
+		if entry, err := gen.Registry.GetItem(region.Type, name); err == nil {
+			item.Description = entry.Description
+			item.Globs = entry.Meta.AppliesToGlobs
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	rest, err := parser.WithoutRegions(output, isItem)
+	if err != nil {
+		return nil, err
+	}
+	doc.Rest = []byte(rest)
+	return doc, nil
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/internal/config"
+	"agmd/internal/symlink"
+	"agmd/pkg/registry"
+)
+
+func TestSymlinkRepair(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("# Project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "notes.md"), []byte("# Notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(project, ".github"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		".github/copilot-instructions.md": "AGENTS.md",   // Relative to the project root instead of .github/
+		"CLAUDE.md":                       "./AGENTS.md", // Valid, but not the relative target
+		"AGENT.md":                        "agent.md",    // Left from before the rename to AGENTS.md
+		"GEMINI.md":                       "notes.md",    // The user's own
+	}
+	for path, target := range links {
+		if err := os.Symlink(target, filepath.Join(project, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readlinks := func() map[string]string {
+		got := map[string]string{}
+		for path := range links {
+			got[path], _ = os.Readlink(filepath.Join(project, path))
+		}
+		return got
+	}
+
+	for _, status := range symlink.NewManager(agentsMdFilename).List() {
+		if status.Tool.Name == "claude" && !status.IsValid {
+			t.Error("CLAUDE.md → ./AGENTS.md should be valid")
+		}
+		if status.Tool.Name == "copilot" && status.IsValid {
+			t.Error("copilot-instructions.md → AGENTS.md should be invalid")
+		}
+	}
+
+	if err := runAgmd(t, "symlink", "repair", "--dry-run"); err != nil {
+		t.Fatalf("repair --dry-run: %v", err)
+	}
+	for path, target := range readlinks() {
+		if target != links[path] {
+			t.Errorf("dry run changed %s to → %s", path, target)
+		}
+	}
+
+	if err := runAgmd(t, "symlink", "repair"); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	want := map[string]string{
+		".github/copilot-instructions.md": "../AGENTS.md",
+		"CLAUDE.md":                       "AGENTS.md",
+		"AGENT.md":                        "AGENTS.md",
+		"GEMINI.md":                       "notes.md",
+	}
+	for path, target := range readlinks() {
+		if target != want[path] {
+			t.Errorf("%s → %s, want → %s", path, target, want[path])
+		}
+	}
+	for _, status := range symlink.NewManager(agentsMdFilename).List() {
+		if status.Exists && !status.IsValid {
+			t.Errorf("%s is invalid after repair", status.Tool.Filename)
+		}
+	}
+}
+
+func TestUserTools(t *testing.T) {
+	home, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	reg := &registry.Registry{BasePath: filepath.Join(home, ".agmd")}
+	err := reg.SaveConfig(&registry.Config{Tools: []registry.ToolTarget{
+		{Name: "gemini", Path: "GEMINI.md"},
+		{Name: "kiro", Path: ".kiro/steering/agents.md", Mode: "adapter", Header: "---\ninclusion: always\n---", Footer: "<!-- {{tool}} reads {{source}} -->"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The project overrides the mode of a built-in tool
+	if err := os.MkdirAll(filepath.Join(project, registry.ProjectDirname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	override := "[[tool]]\nname = \"claude\"\nmode = \"copy\"\n"
+	if err := os.WriteFile(filepath.Join(project, registry.ProjectDirname, registry.ConfigFilename), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	directives := "---\ntargets: [kiro, claude]\n---\n# Project\n\nUse tabs.\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	agents := readFile(t, filepath.Join(project, agentsMdFilename))
+	kiro := readFile(t, filepath.Join(project, ".kiro", "steering", "agents.md"))
+	if !strings.HasPrefix(kiro, "---\ninclusion: always\n---\n<!-- Generated by agmd") || !strings.HasSuffix(kiro, agents+"\n<!-- kiro reads AGENTS.md -->\n") {
+		t.Errorf("kiro steering file:\n%s", kiro)
+	}
+	if got := readFile(t, filepath.Join(project, "CLAUDE.md")); got != config.CopyHeader+agents {
+		t.Errorf("CLAUDE.md should be a copy:\n%s", got)
+	}
+
+	// Declared tools get their own flag, as well as --tool
+	if err := runAgmd(t, "symlink", "add", "--gemini"); err != nil {
+		t.Fatalf("symlink add --gemini: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(project, "GEMINI.md")); err != nil || target != agentsMdFilename {
+		t.Errorf("GEMINI.md should link to AGENTS.md, got %q, %v", target, err)
+	}
+	if err := runAgmd(t, "symlink", "add", "--tool", "junie"); err == nil {
+		t.Error("symlink add accepted an undeclared tool")
+	}
+
+	if err := os.WriteFile(filepath.Join(project, ".kiro", "steering", "agents.md"), []byte(kiro+"Edited.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range symlink.NewManager(agentsMdFilename).List() {
+		switch status.Tool.Name {
+		case "kiro":
+			if !status.IsValid || !status.Stale {
+				t.Errorf("edited kiro file: valid %v, stale %v", status.IsValid, status.Stale)
+			}
+		case "gemini", "claude":
+			if !status.IsValid || status.Stale {
+				t.Errorf("%s: valid %v, stale %v", status.Tool.Name, status.IsValid, status.Stale)
+			}
+		}
+	}
+
+	err = reg.SaveConfig(&registry.Config{Tools: []registry.ToolTarget{{Name: "zed", Path: ".rules", Header: "# Zed"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err == nil {
+		t.Error("sync accepted a header without adapter mode")
+	}
+}
+
+func TestSymlinkKeepsSource(t *testing.T) {
+	_, project := testProject(t)
+	if err := os.WriteFile(filepath.Join(project, agentsMdFilename), []byte("# Project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { config.Configure(nil) })
+	manager := symlink.NewManager(agentsMdFilename)
+	for _, mode := range []config.LinkMode{config.ModeSymlink, config.ModeCopy, config.ModeHardlink, config.ModeAdapter} {
+		for _, path := range []string{agentsMdFilename, "./" + agentsMdFilename} {
+			if err := config.Configure([]config.ToolConfig{{Name: "self", Filename: path, Mode: mode}}); err != nil {
+				t.Fatal(err)
+			}
+			adapter := config.GetAdapter("self").(config.Linker).WithMode(mode)
+			if _, _, err := manager.Write(adapter, &config.Document{Agents: []byte("# Project\n")}); err == nil {
+				t.Errorf("%s in %s mode: Write accepted the source file as a tool file", path, mode)
+			}
+			if info, err := os.Lstat(filepath.Join(project, agentsMdFilename)); err != nil || !info.Mode().IsRegular() {
+				t.Fatalf("%s in %s mode replaced AGENTS.md: %v", path, mode, err)
+			}
+			if got := readFile(t, filepath.Join(project, agentsMdFilename)); got != "# Project\n" {
+				t.Fatalf("%s in %s mode changed AGENTS.md:\n%s", path, mode, got)
+			}
+		}
+	}
+}
+
+func TestSymlinkAiderLinkedConfig(t *testing.T) {
+	_, project := testProject(t)
+	if err := os.WriteFile(filepath.Join(project, agentsMdFilename), []byte("# Project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	shared := filepath.Join(t.TempDir(), "aider.yml")
+	if err := os.WriteFile(shared, []byte("model: gpt-4\nread: CONVENTIONS.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(shared, filepath.Join(project, config.AiderFilename)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgmd(t, "symlink", "add", "--aider"); err != nil {
+		t.Fatalf("symlink add --aider: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(project, config.AiderFilename)); err != nil || target != shared {
+		t.Errorf("%s should still link to %s, got %q, %v", config.AiderFilename, shared, target, err)
+	}
+	if got := readFile(t, shared); got != "model: gpt-4\nread:\n  - CONVENTIONS.md\n  - AGENTS.md\n" {
+		t.Errorf("linked config:\n%s", got)
+	}
+}
+
+func TestCursorLegacyMigration(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("# Project\n\nUse tabs.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(project, config.CursorLegacyFilename)
+	rules := filepath.Join(project, config.CursorFilename)
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	// sync replaces a .cursorrules symlink made by older versions
+	if err := os.Symlink(agentsMdFilename, legacy); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range toolManager().List() {
+		if status.Tool.Name == "cursor" && (len(status.Legacy) != 1 || status.Legacy[0] != config.CursorLegacyFilename) {
+			t.Errorf("cursor status lists legacy files %v", status.Legacy)
+		}
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if exists(legacy) || !exists(rules) {
+		t.Errorf("after sync: .cursorrules exists %v, agents.mdc exists %v", exists(legacy), exists(rules))
+	}
+
+	// So does symlink repair
+	if err := os.Remove(rules); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(agentsMdFilename, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "symlink", "repair", "--dry-run"); err != nil {
+		t.Fatalf("repair --dry-run: %v", err)
+	}
+	if !exists(legacy) || exists(rules) {
+		t.Error("dry run changed the Cursor files")
+	}
+	if err := runAgmd(t, "symlink", "repair"); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if exists(legacy) || !strings.Contains(readFile(t, rules), "Use tabs.") {
+		t.Errorf("after repair: .cursorrules exists %v, agents.mdc exists %v", exists(legacy), exists(rules))
+	}
+
+	// A .cursorrules of the user's own is kept
+	if err := os.WriteFile(legacy, []byte("Be brief.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := readFile(t, legacy); got != "Be brief.\n" {
+		t.Errorf(".cursorrules:\n%s", got)
+	}
+}
@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"agmd/internal/config"
+	"agmd/internal/symlink"
+	"agmd/pkg/diff"
 	"agmd/pkg/generator"
+	"agmd/pkg/parser"
 	"agmd/pkg/registry"
+	"agmd/pkg/state"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -27,26 +35,158 @@ All non-directive content is preserved.
 Note: If you have :::new blocks, run 'agmd promote' first to add them to
 your registry with proper metadata (name, description).
 
+Registry items may contain directives themselves; they are expanded
+recursively, each item is rendered at most once, and include cycles or
+chains deeper than --max-depth are reported as errors.
+
+:::list entries may be selectors instead of names: globs (go/*, go/**),
+tags (tag:security) and exclusions (!go/legacy) expand to the matching
+registry items, including nested folders, in sorted order.
+
+:::include type:name#anchor includes only the section under the heading
+with that anchor; a missing anchor is reported like a missing item.
+
+:::file path/to/doc.md inlines a file from the project (the directory of
+directives.md). Add #anchor or lines=10-20 to include part of it, and
+lang=NAME to wrap non-markdown files in a code block. Paths outside the
+project are rejected.
+
+Headings of included items are shifted to nest under the section they are
+included in. Add level=N to a directive to set the item's top heading level,
+or flatten to render its headings as bold text.
+
+Blocks wrapped in :::if key=value ... [:::else ...] :::end are kept or dropped
+depending on the variables set in the vars: frontmatter of directives.md or
+with --set, and on the output target ("target", e.g. target=agents).
+
+References that cannot be found in the registry (for example a typo in
+:::include rule:typscript) are collected and reported with their line and
+column, and nothing is written. Use --allow-missing to skip them instead.
+
+With --provenance (or provenance: true in the frontmatter of directives.md),
+each expanded item is wrapped in HTML comments that agents do not see:
+  <!-- agmd:begin rule:typescript sha256=... -->
+  ...
+  <!-- agmd:end -->
+The hash covers the generated content, so hand edits can be located exactly.
+
+Items may declare requires: [rule:typescript] in their frontmatter. The
+required items are added to AGENTS.md, before the items that need them,
+unless they are already included. With --dependencies warn (or
+dependencies: warn in the frontmatter of directives.md) they are only
+reported. Requires cycles, required items missing from the registry and
+items included together despite conflicts_with: are errors.
+
+List the AI tools a project uses under targets: in the frontmatter of
+directives.md (claude, cursor, windsurf, copilot, aider, or tools declared
+under [[tool]] in config.toml, see 'agmd symlink --help'): each sync also
+writes their files in the tool's own format, as do the tools set up with
+'agmd symlink add'. --target NAME writes only the files of that tool. For
+cursor, every item included in directives.md becomes a rule of its own in
+.cursor/rules/, scoped to the files matching the applies_to_globs of the
+item's frontmatter; rules agmd generated earlier for items no longer
+included are removed.
+
+Each sync also writes agmd.lock, pinning the content hash of every registry
+item used and the registry it came from, and recording the --set,
+--provenance, --allow-missing and --dependencies flags it ran with. With --frozen the sync refuses to
+run when the registry content differs from agmd.lock (or an item is not
+pinned), so every machine builds the same AGENTS.md. Refresh pins with
+'agmd update'.
+
+With --check, nothing is written: the expanded output is compared with the
+existing AGENTS.md and a unified diff is printed when they differ (for
+example after a hand edit, or when a registry item changed). The command
+then exits non-zero, without colours or prompts, so it can gate CI. AGENTS.md
+is rebuilt with the flags recorded in agmd.lock by the last sync, unless
+given again; settings that should hold everywhere are best kept in the
+frontmatter of directives.md (vars:, provenance:, dependencies:).
+
 Examples:
-  agmd sync               # Generate AGENTS.md from directives.md`,
+  agmd sync                      # Generate AGENTS.md from directives.md
+  agmd sync --check              # Fail if AGENTS.md is out of date
+  agmd sync --frozen             # Fail if registry content differs from agmd.lock
+  agmd sync --provenance         # Mark where each expanded item came from
+  agmd sync --allow-missing      # Skip references missing from the registry
+  agmd sync --dependencies warn  # Report required items instead of adding them
+  agmd sync --target cursor      # Also write .cursor/rules/*.mdc
+  agmd sync --set env=ci         # Set a variable for :::if and {{placeholders}}`,
 	RunE: runSync,
 }
 
+var (
+	syncAllowMissing bool
+	syncMaxDepth     int
+	syncSet          []string
+	syncCheck        bool
+	syncProvenance   bool
+	syncFrozen       bool
+	syncDependencies string
+	syncTargets      []string
+)
+
 func init() {
 	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().BoolVar(&syncAllowMissing, "allow-missing", false, "Skip unresolved :::include/:::list references instead of failing")
+	syncCmd.Flags().StringArrayVar(&syncSet, "set", nil, "Set a variable as key=value (repeatable)")
+	syncCmd.Flags().IntVar(&syncMaxDepth, "max-depth", parser.DefaultMaxDepth, "Maximum nesting of includes inside registry items")
+	syncCmd.Flags().BoolVar(&syncCheck, "check", false, "Compare with AGENTS.md instead of writing it; exit non-zero on drift")
+	syncCmd.Flags().BoolVar(&syncFrozen, "frozen", false, "Refuse to sync when registry content differs from "+state.LockFilename)
+	syncCmd.Flags().BoolVar(&syncProvenance, "provenance", false, "Wrap each expanded item in <!-- agmd:begin/end --> markers")
+	syncCmd.Flags().StringArrayVar(&syncTargets, "target", nil, "Only write the files of this tool (repeatable): "+strings.Join(toolNames(), ", "))
+	syncCmd.Flags().StringVar(&syncDependencies, "dependencies", "", "Add items that included items require (include) or only report them (warn)")
 }
 
 func runSync(cmd *cobra.Command, args []string) error {
+	if syncCheck {
+		// Headless CI mode: plain output and no usage dump on failure
+		color.NoColor = true
+		cmd.SilenceUsage = true
+	}
+	if syncFrozen {
+		cmd.SilenceUsage = true
+	}
+
 	green := color.New(color.FgGreen).SprintFunc()
 	blue := color.New(color.FgBlue).SprintFunc()
 
-	fmt.Printf("%s Generating AGENTS.md from directives.md...\n", blue("→"))
+	if syncCheck {
+		fmt.Printf("%s Checking AGENTS.md against directives.md...\n", blue("→"))
+	} else {
+		fmt.Printf("%s Generating AGENTS.md from directives.md...\n", blue("→"))
+	}
 
 	// Check if directives.md exists
 	if _, err := os.Stat(directivesMdFilename); err != nil {
 		return fmt.Errorf("directives.md not found\nRun 'agmd init' first")
 	}
 
+	vars, err := parseSetFlags(syncSet)
+	if err != nil {
+		return err
+	}
+	settings := state.SyncSettings{Vars: vars, Provenance: syncProvenance, AllowMissing: syncAllowMissing, Dependencies: syncDependencies}
+	if syncCheck {
+		// Rebuild AGENTS.md the way the last sync did, unless told otherwise
+		recorded, err := loadSyncSettings()
+		if err != nil {
+			return err
+		}
+		flags := cmd.Flags()
+		if !flags.Changed("set") {
+			settings.Vars = recorded.Vars
+		}
+		if !flags.Changed("provenance") {
+			settings.Provenance = recorded.Provenance
+		}
+		if !flags.Changed("allow-missing") {
+			settings.AllowMissing = recorded.AllowMissing
+		}
+		if !flags.Changed("dependencies") {
+			settings.Dependencies = recorded.Dependencies
+		}
+	}
+
 	// Load registry
 	fmt.Printf("%s Loading registry...\n", blue("→"))
 	reg, err := registry.New()
@@ -72,27 +212,248 @@ func runSync(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("cannot sync with unpromoted :::new blocks")
 	}
 
-	// Auto-sync filenames with frontmatter names
-	autoSyncRegistryFilenames(reg)
+	// Auto-sync filenames with frontmatter names (never modify anything in check mode)
+	if !syncCheck {
+		autoSyncRegistryFilenames(reg)
+	}
 
 	// Create generator
-	gen := generator.New(reg, nil)
+	gen, err := syncGenerator(reg, settings)
+	if err != nil {
+		return err
+	}
+	gen.MaxDepth = syncMaxDepth
 
 	// Parse and expand directives from directives.md
 	fmt.Printf("%s Parsing and expanding directives...\n", blue("→"))
-	content, err := gen.ParseAndExpand(directivesMdFilename)
+	expansion, err := gen.Expand(directivesMdFilename)
 	if err != nil {
+		var unresolved *parser.UnresolvedError
+		if errors.As(err, &unresolved) {
+			red := color.New(color.FgRed).SprintFunc()
+			fmt.Println()
+			for _, ref := range unresolved.Refs {
+				fmt.Printf("%s %s:%d:%d: %s not found in registry\n", red("✗"), ref.File, ref.Pos.Line, ref.Pos.Column, ref)
+			}
+			fmt.Println("\nFix the references above, or run 'agmd sync --allow-missing' to skip them.")
+			return fmt.Errorf("cannot sync with %d unresolved references", len(unresolved.Refs))
+		}
 		return fmt.Errorf("failed to parse and expand directives.md: %w", err)
 	}
 
+	if len(expansion.Warnings) > 0 {
+		yellow := color.New(color.FgYellow).SprintFunc()
+		fmt.Fprintln(os.Stderr)
+		for _, warning := range expansion.Warnings {
+			fmt.Fprintf(os.Stderr, "%s %s\n", yellow("⚠"), warning)
+		}
+	}
+
+	pins := lockedItems(expansion.Items)
+	if syncFrozen {
+		if err := checkFrozen(pins); err != nil {
+			return err
+		}
+	}
+
+	content := string(expansion.Output)
+	if syncCheck {
+		return checkAgentsMd(content)
+	}
+
 	// Write expanded output to AGENTS.md
 	if err := os.WriteFile(agentsMdFilename, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write AGENTS.md: %w", err)
 	}
 
+	// Pin what was just built (a frozen sync already matches the lock)
+	if syncFrozen {
+		pins = nil
+	}
+	if err := writeLock(pins, nil, &settings); err != nil {
+		return err
+	}
+
+	if err := writeToolTargets(gen, syncTargets); err != nil {
+		return err
+	}
+
 	fmt.Printf("\n%s Generated AGENTS.md successfully!\n", green("✓"))
 	fmt.Printf("%s Source: %s → Output: %s\n", blue("ℹ"), directivesMdFilename, agentsMdFilename)
 
 	return nil
 }
 
+// writeToolTargets writes the files of the given tools, or else of the tools
+// listed under targets: in directives.md and those already set up with
+// 'agmd symlink add'
+func writeToolTargets(gen *generator.Generator, only []string) error {
+	green := color.New(color.FgGreen).SprintFunc()
+
+	meta, err := generator.ReadMeta(directivesMdFilename)
+	if err != nil {
+		return err
+	}
+	if err := loadTools(); err != nil {
+		return err
+	}
+	for _, name := range append(slices.Clone(only), meta.Targets...) {
+		if config.GetAdapter(name) == nil {
+			return fmt.Errorf("unknown target %q (expected one of: %s)", name, strings.Join(toolNames(), ", "))
+		}
+	}
+	modes := map[string]config.LinkMode{}
+	for name, value := range meta.Modes {
+		adapter := config.GetAdapter(name)
+		if adapter == nil {
+			return fmt.Errorf("modes: unknown tool %q (expected one of: %s)", name, strings.Join(toolNames(), ", "))
+		}
+		mode, err := config.ParseLinkMode(value)
+		if err != nil {
+			return fmt.Errorf("modes: %s: %w", name, err)
+		}
+		if _, ok := adapter.(config.Linker); !ok && mode != config.ModeAdapter {
+			return fmt.Errorf("modes: %s files are written in the tool's own format (mode %s)", name, config.ModeAdapter)
+		}
+		modes[name] = mode
+	}
+
+	var adapters []config.ToolAdapter
+	for _, adapter := range config.Adapters() {
+		name := adapter.Tool().Name
+		if len(only) > 0 && !slices.Contains(only, name) {
+			continue
+		}
+		if len(only) == 0 && !slices.Contains(meta.Targets, name) && !adapter.Installed(".") {
+			continue
+		}
+		adapters = append(adapters, withMode(adapter, modes[name]))
+	}
+	if len(adapters) == 0 {
+		return nil
+	}
+
+	manager := symlink.NewManager(agentsMdFilename)
+	for _, adapter := range adapters {
+		doc, err := toolDocument(gen, adapter.Tool().Name)
+		if err != nil {
+			return err
+		}
+		written, removed, err := manager.Write(adapter, doc)
+		if err != nil {
+			return fmt.Errorf("failed to write %s files: %w", adapter.Tool().Name, err)
+		}
+		for _, path := range written {
+			fmt.Printf("%s Wrote %s\n", green("✓"), path)
+		}
+		for _, path := range removed {
+			fmt.Printf("%s Removed stale %s\n", green("✓"), path)
+		}
+	}
+	return nil
+}
+
+// toolNames returns the names of the supported tools
+func toolNames() []string {
+	var names []string
+	for _, adapter := range config.Adapters() {
+		names = append(names, adapter.Tool().Name)
+	}
+	return names
+}
+
+// checkAgentsMd compares freshly expanded content with AGENTS.md on disk
+// and prints a unified diff when they differ
+func checkAgentsMd(expected string) error {
+	current, err := os.ReadFile(agentsMdFilename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read AGENTS.md: %w", err)
+	}
+
+	patch := diff.Unified(agentsMdFilename, agentsMdFilename+" (expected)", string(current), expected, 3)
+	if patch == "" {
+		fmt.Printf("\n✓ %s is up to date\n", agentsMdFilename)
+		return nil
+	}
+
+	fmt.Println()
+	fmt.Print(patch)
+	fmt.Println()
+
+	// With provenance markers the hand-edited items can be named exactly
+	if regions, err := parser.ParseRegions(string(current)); err == nil {
+		for _, region := range parser.EditedRegions(regions) {
+			fmt.Printf("✗ %s:%d: %s was edited by hand\n", agentsMdFilename, region.Line, region.Ref())
+		}
+	}
+	fmt.Printf("✗ %s is out of date with %s and the registry\n", agentsMdFilename, directivesMdFilename)
+	fmt.Println("Run 'agmd sync' to regenerate it.")
+	return fmt.Errorf("%s is out of date", agentsMdFilename)
+}
+
+// checkFrozen fails when resolved items differ from their pins in agmd.lock
+func checkFrozen(pins []state.LockedItem) error {
+	lock, err := state.LoadLock(state.LockFilename)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s not found\nRun 'agmd sync' without --frozen to create it", state.LockFilename)
+	}
+	if err != nil {
+		return err
+	}
+
+	problems := lock.Check(pins)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	red := color.New(color.FgRed).SprintFunc()
+	fmt.Println()
+	for _, problem := range problems {
+		fmt.Printf("%s %s\n", red("✗"), problem)
+	}
+	fmt.Println("\nRun 'agmd update' to refresh the pins, then commit agmd.lock.")
+	return fmt.Errorf("registry content differs from %s", state.LockFilename)
+}
+
+// syncGenerator returns a generator building AGENTS.md with the given sync
+// settings
+func syncGenerator(reg *registry.Registry, settings state.SyncSettings) (*generator.Generator, error) {
+	gen := generator.New(reg, nil)
+	gen.Vars = settings.Vars
+	gen.Provenance = settings.Provenance
+	gen.AllowMissing = settings.AllowMissing
+	if settings.Dependencies != "" {
+		dependencies, err := parser.ParseDependencyPolicy(settings.Dependencies)
+		if err != nil {
+			return nil, err
+		}
+		gen.Dependencies = dependencies
+	}
+	return gen, nil
+}
+
+// loadSyncSettings returns the sync settings recorded in agmd.lock, none
+// when there is no lock yet
+func loadSyncSettings() (state.SyncSettings, error) {
+	lock, err := state.LoadLock(state.LockFilename)
+	if os.IsNotExist(err) {
+		return state.SyncSettings{}, nil
+	}
+	if err != nil {
+		return state.SyncSettings{}, err
+	}
+	return lock.Sync, nil
+}
+
+// parseSetFlags converts repeated --set key=value flags into a map
+func parseSetFlags(values []string) (map[string]string, error) {
+	vars := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set value %q (expected key=value)", value)
+		}
+		vars[key] = val
+	}
+	return vars, nil
+}
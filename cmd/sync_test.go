@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/internal/config"
+	"agmd/internal/symlink"
+	"agmd/pkg/state"
+)
+
+func TestSyncDependencies(t *testing.T) {
+	home, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	items := map[string]string{
+		"typescript":  "# TypeScript\n\nUse strict mode.\n",
+		"react-hooks": "---\nrequires: [rule:typescript]\n---\n# Hooks\n\nName hooks useX.\n",
+	}
+	ruleDir := filepath.Join(home, ".agmd", "rule")
+	if err := os.MkdirAll(ruleDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range items {
+		if err := os.WriteFile(filepath.Join(ruleDir, name+".md"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	directives := filepath.Join(project, directivesMdFilename)
+	agents := filepath.Join(project, agentsMdFilename)
+	if err := os.WriteFile(directives, []byte(":::include rule:react-hooks\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	got := readFile(t, agents)
+	if i, j := strings.Index(got, "Use strict mode."), strings.Index(got, "Name hooks useX."); i < 0 || j < i {
+		t.Errorf("AGENTS.md should include rule:typescript before rule:react-hooks:\n%s", got)
+	}
+
+	// dependencies: warn in directives.md leaves the requirement out
+	if err := os.WriteFile(directives, []byte("---\ndependencies: warn\n---\n:::include rule:react-hooks\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := readFile(t, agents); strings.Contains(got, "Use strict mode.") {
+		t.Errorf("AGENTS.md should not include rule:typescript with dependencies: warn:\n%s", got)
+	}
+	if err := runAgmd(t, "sync", "--dependencies", "include"); err != nil {
+		t.Fatalf("sync --dependencies include: %v", err)
+	}
+	if got := readFile(t, agents); !strings.Contains(got, "Use strict mode.") {
+		t.Errorf("--dependencies include should override the frontmatter:\n%s", got)
+	}
+	if err := runAgmd(t, "sync", "--dependencies", "sometimes"); err == nil {
+		t.Error("sync accepted an invalid --dependencies policy")
+	}
+
+	if err := runAgmd(t, "show", "rule:react-hooks", "--deps"); err != nil {
+		t.Errorf("show --deps: %v", err)
+	}
+}
+
+func TestSyncTargets(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	directives := "---\ntargets: [claude, cursor]\n---\n# Project\n\nUse tabs.\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".aider.conf.yml"), []byte("model: sonnet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(project, "CLAUDE.md")); err != nil || target != agentsMdFilename {
+		t.Errorf("CLAUDE.md should link to AGENTS.md, got %q, %v", target, err)
+	}
+	if got := readFile(t, filepath.Join(project, ".cursor", "rules", "agents.mdc")); !strings.Contains(got, "alwaysApply: true") || !strings.Contains(got, "Use tabs.") {
+		t.Errorf("agents.mdc:\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(project, ".aider.conf.yml")); got != "model: sonnet\n" {
+		t.Errorf(".aider.conf.yml changed although aider is not a target:\n%s", got)
+	}
+
+	// Tools set up with symlink add are refreshed by later syncs
+	if err := runAgmd(t, "symlink", "add", "--aider"); err != nil {
+		t.Fatal(err)
+	}
+	directives = strings.Replace(directives, "Use tabs.", "Use spaces.", 1)
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := readFile(t, filepath.Join(project, ".aider.conf.yml")); got != "model: sonnet\nread:\n  - AGENTS.md\n" {
+		t.Errorf(".aider.conf.yml:\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(project, ".cursor", "rules", "agents.mdc")); !strings.Contains(got, "Use spaces.") {
+		t.Errorf("agents.mdc not refreshed:\n%s", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("---\ntargets: [vim]\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err == nil {
+		t.Error("sync accepted an unknown target")
+	}
+}
+
+func TestSyncReportsSyntaxDiagnostics(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("# Project\n\n:::inclde rule:ts\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	_, stderr := captureOutput(t, func() { err = runAgmd(t, "sync") })
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if !strings.Contains(stderr, "directives.md:3:1: warning:") || !strings.Contains(stderr, "[unknown-directive]") {
+		t.Errorf("sync did not report the malformed directive, stderr:\n%s", stderr)
+	}
+}
+
+func TestSyncCheck(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	directives := "# Project\n\n:::if env=ci\nRun headless.\n:::end\n\nUse tabs.\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync", "--provenance", "--set", "env=ci"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if lock := readFile(t, filepath.Join(project, state.LockFilename)); !strings.Contains(lock, "provenance = true") || !strings.Contains(lock, `env = "ci"`) {
+		t.Errorf("sync settings not recorded in %s:\n%s", state.LockFilename, lock)
+	}
+
+	// The flags of the last sync are reused
+	var err error
+	stdout, _ := captureOutput(t, func() { err = runAgmd(t, "sync", "--check") })
+	if err != nil {
+		t.Errorf("sync --check on a clean tree: %v\n%s", err, stdout)
+	}
+
+	agents := filepath.Join(project, agentsMdFilename)
+	if err := os.WriteFile(agents, []byte(strings.Replace(readFile(t, agents), "Use tabs.", "Use spaces.", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _ = captureOutput(t, func() { err = runAgmd(t, "sync", "--check") })
+	if err == nil {
+		t.Error("sync --check accepted an edited AGENTS.md")
+	}
+	if !strings.Contains(stdout, "-Use spaces.") || !strings.Contains(stdout, "+Use tabs.") {
+		t.Errorf("sync --check printed no diff:\n%s", stdout)
+	}
+}
+
+func TestSyncFrozen(t *testing.T) {
+	home, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	item := filepath.Join(home, ".agmd", "rule", "style.md")
+	if err := os.MkdirAll(filepath.Dir(item), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(item, []byte("# Style\n\nUse tabs.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(":::include rule:style\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := runAgmd(t, "sync", "--frozen"); err != nil {
+		t.Fatalf("sync --frozen with unchanged items: %v", err)
+	}
+
+	if err := os.WriteFile(item, []byte("# Style\n\nUse spaces.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	stdout, _ := captureOutput(t, func() { err = runAgmd(t, "sync", "--frozen") })
+	if err == nil {
+		t.Fatal("sync --frozen accepted a changed item")
+	}
+	if !strings.Contains(stdout, "rule:style") {
+		t.Errorf("sync --frozen should name the changed item:\n%s", stdout)
+	}
+	if got := readFile(t, filepath.Join(project, agentsMdFilename)); strings.Contains(got, "Use spaces.") {
+		t.Errorf("a failed sync --frozen rewrote AGENTS.md:\n%s", got)
+	}
+}
+
+func TestSyncTargetConditionals(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	directives := "---\ntargets: [claude]\nmodes:\n  claude: copy\n---\n# Project\n\n:::if target=claude\nUse subagents.\n:::else\nWork alone.\n:::end\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	agents := readFile(t, filepath.Join(project, agentsMdFilename))
+	if !strings.Contains(agents, "Work alone.") || strings.Contains(agents, "Use subagents.") {
+		t.Errorf("AGENTS.md should take the else branch:\n%s", agents)
+	}
+	claude := readFile(t, filepath.Join(project, "CLAUDE.md"))
+	if !strings.HasPrefix(claude, config.CopyHeader) || !strings.Contains(claude, "Use subagents.") || strings.Contains(claude, "Work alone.") {
+		t.Errorf("CLAUDE.md should take the target=claude branch:\n%s", claude)
+	}
+	for _, status := range toolManager().List() {
+		if status.Tool.Name == "claude" && status.Stale {
+			t.Error("CLAUDE.md reported stale right after sync")
+		}
+	}
+	if err := runAgmd(t, "symlink", "list"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An explicit target picks the branch for every output
+	if err := runAgmd(t, "sync", "--set", "target=claude"); err != nil {
+		t.Fatalf("sync --set target=claude: %v", err)
+	}
+	if agents := readFile(t, filepath.Join(project, agentsMdFilename)); !strings.Contains(agents, "Use subagents.") {
+		t.Errorf("--set target=claude ignored for AGENTS.md:\n%s", agents)
+	}
+
+	// symlink renders the files with the vars of the last sync
+	directives = "---\ntargets: [claude]\nmodes:\n  claude: copy\n---\n# Project\n\n:::if env=ci\nRun headless.\n:::end\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync", "--set", "env=ci"); err != nil {
+		t.Fatalf("sync --set env=ci: %v", err)
+	}
+	for _, status := range toolManager().List() {
+		if status.Tool.Name == "claude" && status.Stale {
+			t.Error("CLAUDE.md reported stale after sync --set env=ci")
+		}
+	}
+	if err := os.Remove(filepath.Join(project, "CLAUDE.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "symlink", "add", "--claude", "--mode", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if claude := readFile(t, filepath.Join(project, "CLAUDE.md")); !strings.Contains(claude, "Run headless.") {
+		t.Errorf("symlink add dropped the env=ci branch:\n%s", claude)
+	}
+}
+
+func TestSyncModes(t *testing.T) {
+	_, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	directives := "---\ntargets: [claude, copilot, windsurf]\nmodes:\n  claude: copy\n  windsurf: hardlink\n---\n# Project\n\nUse tabs.\n"
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte(directives), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	agents := readFile(t, filepath.Join(project, agentsMdFilename))
+	if got := readFile(t, filepath.Join(project, "CLAUDE.md")); got != config.CopyHeader+agents {
+		t.Errorf("CLAUDE.md should be a copy of AGENTS.md:\n%s", got)
+	}
+	if target, err := os.Readlink(filepath.Join(project, ".github", "copilot-instructions.md")); err != nil || target != "../AGENTS.md" {
+		t.Errorf("copilot-instructions.md should link to ../AGENTS.md, got %q, %v", target, err)
+	}
+	if config.DetectMode(project, ".windsurfrules", agentsMdFilename) != config.ModeHardlink {
+		t.Error(".windsurfrules should be a hard link to AGENTS.md")
+	}
+
+	// A drifted copy is stale until the next sync
+	if err := os.WriteFile(filepath.Join(project, "CLAUDE.md"), []byte(config.CopyHeader+"# Edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager := symlink.NewManager(agentsMdFilename)
+	stale := func() bool {
+		for _, status := range manager.List() {
+			if status.Tool.Name == "claude" {
+				return status.Stale
+			}
+		}
+		return false
+	}
+	if !stale() {
+		t.Error("edited copy not reported as stale")
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if stale() {
+		t.Error("copy still stale after sync")
+	}
+
+	// Files keep their mode once the frontmatter no longer sets it
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("# Project\n\nUse spaces.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := readFile(t, filepath.Join(project, "CLAUDE.md")); !strings.HasPrefix(got, config.CopyHeader) || !strings.Contains(got, "Use spaces.") {
+		t.Errorf("CLAUDE.md copy not refreshed:\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(project, ".windsurfrules")); !strings.Contains(got, "Use spaces.") {
+		t.Errorf(".windsurfrules:\n%s", got)
+	}
+
+	// symlink add switches modes, but never replaces files agmd did not write
+	if err := runAgmd(t, "symlink", "add", "--claude", "--mode", "symlink-relative"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(project, "CLAUDE.md")); err != nil || target != agentsMdFilename {
+		t.Errorf("CLAUDE.md should link to AGENTS.md, got %q, %v", target, err)
+	}
+	windsurf := filepath.Join(project, ".windsurfrules")
+	if err := os.Remove(windsurf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(windsurf, []byte("# Mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "symlink", "add", "--windsurf", "--mode", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, windsurf); got != "# Mine\n" {
+		t.Errorf("hand-written .windsurfrules replaced:\n%s", got)
+	}
+	if err := runAgmd(t, "symlink", "add", "--claude", "--mode", "zip"); err == nil {
+		t.Error("symlink add accepted an unknown mode")
+	}
+
+	if err := os.WriteFile(filepath.Join(project, directivesMdFilename), []byte("---\nmodes:\n  cursor: copy\n---\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err == nil {
+		t.Error("sync accepted a mode for cursor")
+	}
+}
@@ -821,11 +821,16 @@ func runTaskNew(cmd *cobra.Command, args []string) error {
 	// Open editor unless --no-editor or content was provided
 	if taskNoEditor || taskContent != "" || !isTerminal(os.Stdin) {
 		fmt.Printf("%s %s\n", blue("->"), filePath)
+		autoCommit(reg, "Add task:%s (project: %s)", name, projectName)
 		return nil
 	}
 
 	fmt.Printf("%s Opening editor...\n", blue("->"))
-	return openInEditor(filePath)
+	if err := openInEditor(filePath); err != nil {
+		return err
+	}
+	autoCommit(reg, "Add task:%s (project: %s)", name, projectName)
+	return nil
 }
 
 func runTaskShow(cmd *cobra.Command, args []string) error {
@@ -1019,6 +1024,7 @@ func runTaskDelete(cmd *cobra.Command, args []string) error {
 		os.Remove(taskDir)
 	}
 
+	autoCommit(reg, "Delete task:%s (project: %s)", name, projectName)
 	return nil
 }
 
@@ -1064,6 +1070,7 @@ func runTaskStatus(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("%s Updated task '%s' status to '%s'\n", green("✓"), taskName, newStatus)
+	autoCommit(reg, "Set task:%s to %s (project: %s)", taskName, newStatus, projectName)
 	return nil
 }
 
@@ -1112,6 +1119,7 @@ func runTaskBlockedBy(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("%s Added dependency: '%s' is now blocked by '%s'\n", green("✓"), taskName, dependency)
+	autoCommit(reg, "Block task:%s by %s (project: %s)", taskName, dependency, projectName)
 	return nil
 }
 
@@ -1162,5 +1170,6 @@ func runTaskUnblock(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("%s Removed dependency: '%s' is no longer blocked by '%s'\n", green("✓"), taskName, dependency)
+	autoCommit(reg, "Unblock task:%s from %s (project: %s)", taskName, dependency, projectName)
 	return nil
 }
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agmd/pkg/generator"
+	"agmd/pkg/parser"
+	"agmd/pkg/registry"
+	"agmd/pkg/state"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update [type:name...]",
+	Short: "Refresh the registry pins in agmd.lock",
+	Long: `Refresh the content hashes pinned in agmd.lock.
+
+agmd.lock records every registry item directives.md expands to, with the
+hash of its content and the registry it came from, so 'agmd sync --frozen'
+can refuse to build from different content. After changing items in the
+registry, run 'agmd update' to accept the new content.
+
+Without arguments every pin is refreshed, items no longer used are dropped
+and new ones are added. With type:name arguments only those pins change.
+AGENTS.md is not modified; run 'agmd sync' to regenerate it.
+
+Examples:
+  agmd update                  # Re-pin every item used by directives.md
+  agmd update rule:typescript  # Re-pin one item, keep the others`,
+	RunE: runUpdate,
+}
+
+var updateSet []string
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().StringArrayVar(&updateSet, "set", nil, "Set a variable as key=value, as passed to sync (repeatable)")
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	blue := color.New(color.FgBlue).SprintFunc()
+
+	if _, err := os.Stat(directivesMdFilename); err != nil {
+		return fmt.Errorf("directives.md not found\nRun 'agmd init' first")
+	}
+	for _, arg := range args {
+		if !strings.Contains(arg, ":") {
+			return fmt.Errorf("invalid format %q. Use 'type:name' (e.g., 'rule:typescript')", arg)
+		}
+	}
+
+	vars, err := parseSetFlags(updateSet)
+	if err != nil {
+		return err
+	}
+
+	reg, err := registry.New()
+	if err != nil {
+		return fmt.Errorf("failed to load registry: %w", err)
+	}
+	if !reg.Exists() {
+		return fmt.Errorf("registry not found at %s\nRun 'agmd setup' first", reg.BasePath)
+	}
+
+	fmt.Printf("%s Resolving registry items from directives.md...\n", blue("→"))
+	gen := generator.New(reg, nil)
+	gen.AllowMissing = true
+	gen.Vars = vars
+	expansion, err := gen.Expand(directivesMdFilename)
+	if err != nil {
+		return fmt.Errorf("failed to parse and expand directives.md: %w", err)
+	}
+
+	return writeLock(lockedItems(expansion.Items), args, nil)
+}
+
+// lockedItems converts the items used by an expansion into lock pins
+func lockedItems(items []parser.ResolvedItem) []state.LockedItem {
+	pins := make([]state.LockedItem, 0, len(items))
+	for _, item := range items {
+		pins = append(pins, state.LockedItem{
+			Ref:    item.Ref(),
+			SHA256: item.Hash,
+			Layer:  displayPath(item.Layer),
+		})
+	}
+	return pins
+}
+
+// writeLock saves pins to agmd.lock and reports what changed. When only is
+// set, just those references are re-pinned and the other pins are kept;
+// when pins is nil, all of them are. settings replaces the recorded sync
+// settings unless nil.
+func writeLock(pins []state.LockedItem, only []string, settings *state.SyncSettings) error {
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	old, err := state.LoadLock(state.LockFilename)
+	if os.IsNotExist(err) {
+		old = &state.Lock{}
+	} else if err != nil {
+		return err
+	}
+
+	lock := &state.Lock{Sync: old.Sync, Items: pins}
+	if settings != nil {
+		lock.Sync = *settings
+	}
+	if pins == nil {
+		lock.Items = old.Items
+	} else if len(only) > 0 {
+		lock.Items = append([]state.LockedItem(nil), old.Items...)
+		fresh := &state.Lock{Items: pins}
+		for _, ref := range only {
+			pin := fresh.Find(ref)
+			if pin == nil {
+				return fmt.Errorf("%s is not used by directives.md", ref)
+			}
+			lock.Pin(*pin)
+		}
+	}
+
+	for _, pin := range lock.Items {
+		previous := old.Find(pin.Ref)
+		switch {
+		case previous == nil:
+			fmt.Printf("%s Pinned %s\n", green("✓"), pin.Ref)
+		case previous.SHA256 != pin.SHA256 || previous.Layer != pin.Layer:
+			fmt.Printf("%s Updated pin %s\n", green("✓"), pin.Ref)
+		}
+	}
+	for _, pin := range old.Items {
+		if lock.Find(pin.Ref) == nil {
+			fmt.Printf("%s Unpinned %s (no longer used)\n", yellow("⊘"), pin.Ref)
+		}
+	}
+
+	return lock.Save(state.LockFilename)
+}
+
+// displayPath shortens paths below the project to relative paths and paths
+// below the home directory to ~/..., so pins do not depend on the machine
+func displayPath(path string) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, ok := registry.Within(cwd, path); ok {
+			return filepath.ToSlash(rel)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if rel, ok := registry.Within(home, path); ok {
+			return filepath.ToSlash(filepath.Join("~", rel))
+		}
+	}
+	return path
+}
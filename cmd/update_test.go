@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"agmd/pkg/state"
+)
+
+func TestUpdate(t *testing.T) {
+	home, project := testProject(t)
+	if err := runAgmd(t, "setup"); err != nil {
+		t.Fatal(err)
+	}
+	ruleDir := filepath.Join(home, ".agmd", "rule")
+	if err := os.MkdirAll(ruleDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeRule := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(ruleDir, name+".md"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRule("style", "Use tabs.\n")
+	writeRule("tests", "Write tests.\n")
+	directives := filepath.Join(project, directivesMdFilename)
+	if err := os.WriteFile(directives, []byte(":::include rule:style\n\n:::include rule:tests\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	pins := func() map[string]state.LockedItem {
+		t.Helper()
+		lock, err := state.LoadLock(filepath.Join(project, state.LockFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]state.LockedItem{}
+		for _, item := range lock.Items {
+			found[item.Ref] = item
+		}
+		return found
+	}
+	synced := pins()
+	if layer := synced["rule:style"].Layer; layer != "~/.agmd" {
+		t.Errorf("layer of rule:style = %q, want ~/.agmd", layer)
+	}
+
+	// Only the named item is re-pinned
+	writeRule("style", "Use spaces.\n")
+	writeRule("tests", "Write more tests.\n")
+	if err := runAgmd(t, "update", "rule:style"); err != nil {
+		t.Fatalf("update rule:style: %v", err)
+	}
+	updated := pins()
+	if updated["rule:style"].SHA256 == synced["rule:style"].SHA256 {
+		t.Error("update rule:style kept the old pin of rule:style")
+	}
+	if updated["rule:tests"].SHA256 != synced["rule:tests"].SHA256 {
+		t.Error("update rule:style changed the pin of rule:tests")
+	}
+
+	// Without arguments every pin is refreshed and unused items are dropped
+	if err := os.WriteFile(directives, []byte(":::include rule:tests\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runAgmd(t, "update"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	updated = pins()
+	if _, ok := updated["rule:style"]; ok {
+		t.Error("update kept the pin of rule:style, no longer used")
+	}
+	if updated["rule:tests"].SHA256 == synced["rule:tests"].SHA256 {
+		t.Error("update kept the old pin of rule:tests")
+	}
+	if err := runAgmd(t, "sync", "--frozen"); err != nil {
+		t.Errorf("sync --frozen after update: %v", err)
+	}
+}
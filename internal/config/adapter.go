@@ -0,0 +1,288 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output is one file a tool reads its instructions from
+type Output struct {
+	Path     string // Relative to the project root
+	Content  []byte // Content of a generated file
+	Link     string // Symlink target, relative to the directory of Path
+	Hardlink string // File to hard-link Path to, relative to the project root
+}
+
+// Document is the generated instructions tool adapters render
+type Document struct {
+	Agents []byte // Content of AGENTS.md
+	// Items are the registry items included at the top level of
+	// directives.md, and Rest is AGENTS.md without them (the project's own
+	// text); Items is empty when AGENTS.md cannot be split
+	Items []DocumentItem
+	Rest  []byte
+}
+
+// DocumentItem is one registry item included in AGENTS.md
+type DocumentItem struct {
+	Ref         string // TYPE:NAME, with #anchor for section includes
+	Args        string // Parameters the item was included with, e.g. env=prod
+	Description string
+	Globs       []string // applies_to_globs of the item
+	Content     []byte
+}
+
+// ToolAdapter renders AGENTS.md in the native format of one AI tool
+type ToolAdapter interface {
+	Tool() ToolConfig
+	// Render returns the files the tool reads, given the project root
+	Render(root string, doc *Document) ([]Output, error)
+	// Installed reports whether the project is already set up for the tool
+	Installed(root string) bool
+}
+
+// Cleaner is implemented by adapters whose files hold settings of their own
+// (e.g. .aider.conf.yml), which are edited rather than deleted on removal,
+// or that write several files
+type Cleaner interface {
+	Clean(root string) error
+}
+
+// Pruner is implemented by adapters writing a varying set of files. Stale
+// returns the files generated earlier that outputs no longer include.
+type Pruner interface {
+	Stale(root string, outputs []Output) ([]string, error)
+}
+
+// Migrator is implemented by adapters of tools that read another file
+// before, which older agmd versions set up. Legacy returns those still in
+// place; they are removed as stale once the tool's current files are written.
+type Migrator interface {
+	Legacy(root string) []string
+}
+
+// Linker is implemented by adapters of tools that read plain markdown, which
+// get AGENTS.md by a symlink, a copy, a hard link or an adapter-mode file
+type Linker interface {
+	Mode() LinkMode
+	// WithMode returns the adapter set to mode ("" is ModeSymlink)
+	WithMode(mode LinkMode) ToolAdapter
+}
+
+// Adapters returns the adapters of all supported tools
+func Adapters() []ToolAdapter {
+	var adapters []ToolAdapter
+	for _, tool := range AvailableTools() {
+		switch tool.Name {
+		case "cursor":
+			adapters = append(adapters, cursorAdapter{tool})
+		case "aider":
+			adapters = append(adapters, aiderAdapter{tool})
+		default:
+			adapters = append(adapters, markdownAdapter{tool: tool, mode: tool.Mode})
+		}
+	}
+	return adapters
+}
+
+// GetAdapter returns the adapter of a tool by name
+func GetAdapter(name string) ToolAdapter {
+	for _, adapter := range Adapters() {
+		if adapter.Tool().Name == name {
+			return adapter
+		}
+	}
+	return nil
+}
+
+// AdapterFor returns the adapter writing filename
+func AdapterFor(filename string) ToolAdapter {
+	for _, adapter := range Adapters() {
+		if filepath.Clean(adapter.Tool().Filename) == filepath.Clean(filename) {
+			return adapter
+		}
+	}
+	return nil
+}
+
+// markdownAdapter gives tools that read plain markdown AGENTS.md itself
+type markdownAdapter struct {
+	tool ToolConfig
+	mode LinkMode
+}
+
+func (a markdownAdapter) Tool() ToolConfig { return a.tool }
+
+func (a markdownAdapter) Render(root string, doc *Document) ([]Output, error) {
+	switch a.Mode() {
+	case ModeCopy, ModeAdapter:
+		// Files are written over agmd's own files only
+		if _, err := os.Lstat(filepath.Join(root, a.tool.Filename)); err == nil && DetectMode(root, a.tool.Filename, AgentMdFilename) == "" {
+			return nil, fmt.Errorf("file %s already exists (not created by agmd)", a.tool.Filename)
+		}
+		content := CopyContent(doc.Agents)
+		if a.Mode() == ModeAdapter {
+			content = AdapterContent(a.tool, doc.Agents)
+		}
+		return []Output{{Path: a.tool.Filename, Content: content}}, nil
+	case ModeHardlink:
+		return []Output{{Path: a.tool.Filename, Hardlink: AgentMdFilename}}, nil
+	}
+	return []Output{{Path: a.tool.Filename, Link: LinkTarget(a.tool.Filename, AgentMdFilename)}}, nil
+}
+
+func (a markdownAdapter) Installed(root string) bool {
+	return DetectMode(root, a.tool.Filename, AgentMdFilename) != ""
+}
+
+func (a markdownAdapter) Mode() LinkMode {
+	if a.mode == "" {
+		return ModeSymlink
+	}
+	return a.mode
+}
+
+func (a markdownAdapter) WithMode(mode LinkMode) ToolAdapter {
+	a.mode = mode
+	return a
+}
+
+// aiderAdapter lists AGENTS.md under read: in .aider.conf.yml, keeping the
+// other settings of the file
+type aiderAdapter struct{ tool ToolConfig }
+
+func (a aiderAdapter) Tool() ToolConfig { return a.tool }
+
+func (a aiderAdapter) Render(root string, doc *Document) ([]Output, error) {
+	settings, err := a.load(root)
+	if err != nil {
+		return nil, err
+	}
+	files := readFiles(settings)
+	if !slices.Contains(files, AgentMdFilename) {
+		setReadFiles(settings, append(files, AgentMdFilename))
+	}
+
+	content, err := encodeYAML(settings)
+	if err != nil {
+		return nil, err
+	}
+	return []Output{{Path: a.tool.Filename, Content: content}}, nil
+}
+
+func (a aiderAdapter) Installed(root string) bool {
+	doc, err := a.load(root)
+	return err == nil && slices.Contains(readFiles(doc), AgentMdFilename)
+}
+
+// Clean removes AGENTS.md from read:, and the file once nothing else is set
+func (a aiderAdapter) Clean(root string) error {
+	path := filepath.Join(root, a.tool.Filename)
+	doc, err := a.load(root)
+	if err != nil {
+		return err
+	}
+	files := slices.DeleteFunc(readFiles(doc), func(file string) bool { return file == AgentMdFilename })
+	setReadFiles(doc, files)
+
+	if len(doc.Content[0].Content) == 0 {
+		return os.Remove(path)
+	}
+	content, err := encodeYAML(doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// load parses .aider.conf.yml into a document whose root is a mapping. A
+// missing file, or a symlink to AGENTS.md left by older agmd versions, is an
+// empty one; any other symlink is read through.
+func (a aiderAdapter) load(root string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+
+	path := filepath.Join(root, a.tool.Filename)
+	if _, err := os.Lstat(path); os.IsNotExist(err) || DetectMode(root, a.tool.Filename, AgentMdFilename) == ModeSymlink {
+		return doc, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return doc, nil
+	}
+
+	var parsed yaml.Node
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", a.tool.Filename, err)
+	}
+	if len(parsed.Content) == 0 || parsed.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse %s: expected a mapping of settings", a.tool.Filename)
+	}
+	return &parsed, nil
+}
+
+// readFiles returns the files listed under read: (a single file or a list)
+func readFiles(doc *yaml.Node) []string {
+	mapping := doc.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != "read" {
+			continue
+		}
+		value := mapping.Content[i+1]
+		if value.Kind == yaml.ScalarNode {
+			return []string{value.Value}
+		}
+		var files []string
+		for _, item := range value.Content {
+			files = append(files, item.Value)
+		}
+		return files
+	}
+	return nil
+}
+
+// setReadFiles replaces read: with files, dropping the key when there are none
+func setReadFiles(doc *yaml.Node, files []string) {
+	mapping := doc.Content[0]
+	value := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, file := range files {
+		value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: file})
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != "read" {
+			continue
+		}
+		if len(files) == 0 {
+			mapping.Content = slices.Delete(mapping.Content, i, i+2)
+		} else {
+			mapping.Content[i+1] = value
+		}
+		return
+	}
+	if len(files) > 0 {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "read"}
+		mapping.Content = append(mapping.Content, key, value)
+	}
+}
+
+// encodeYAML writes a YAML document with two-space indentation
+func encodeYAML(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAiderAdapter(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, AiderFilename)
+	if err := os.WriteFile(path, []byte("# Team settings\nmodel: sonnet\nread: CONVENTIONS.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	adapter := GetAdapter("aider")
+	if adapter.Installed(root) {
+		t.Error("Installed() before AGENTS.md is listed under read:")
+	}
+
+	outputs, err := adapter.Render(root, &Document{Agents: []byte("# Agents\n")})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "# Team settings\nmodel: sonnet\nread:\n  - CONVENTIONS.md\n  - AGENTS.md\n"
+	if len(outputs) != 1 || outputs[0].Path != AiderFilename || string(outputs[0].Content) != want {
+		t.Fatalf("Render() = %+v\nwant content:\n%s", outputs, want)
+	}
+
+	if err := os.WriteFile(path, outputs[0].Content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !adapter.Installed(root) {
+		t.Error("Installed() = false once AGENTS.md is listed under read:")
+	}
+	if err := adapter.(Cleaner).Clean(root); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "# Team settings\nmodel: sonnet\nread:\n  - CONVENTIONS.md\n" {
+		t.Errorf("after Clean:\n%s", data)
+	}
+
+	// A config holding nothing but AGENTS.md is removed with it
+	if err := os.WriteFile(path, []byte("read: AGENTS.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.(Cleaner).Clean(root); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s should be removed, got %v", AiderFilename, err)
+	}
+
+	// A symlink left by older versions is replaced, not parsed as YAML
+	if err := os.WriteFile(filepath.Join(root, AgentMdFilename), []byte("# Agents\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(AgentMdFilename, path); err != nil {
+		t.Fatal(err)
+	}
+	outputs, err = adapter.Render(root, &Document{Agents: []byte("# Agents\n")})
+	if err != nil || string(outputs[0].Content) != "read:\n  - AGENTS.md\n" {
+		t.Errorf("Render() over a symlink = %q, %v", outputs[0].Content, err)
+	}
+
+	// Settings linked from elsewhere are read through the link
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "shared.yml"), []byte("model: gpt-4\nread: CONVENTIONS.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("shared.yml", path); err != nil {
+		t.Fatal(err)
+	}
+	outputs, err = adapter.Render(root, &Document{Agents: []byte("# Agents\n")})
+	if err != nil || string(outputs[0].Content) != "model: gpt-4\nread:\n  - CONVENTIONS.md\n  - AGENTS.md\n" {
+		t.Errorf("Render() over a linked config = %q, %v", outputs[0].Content, err)
+	}
+}
+
+func TestCursorAdapter(t *testing.T) {
+	root := t.TempDir()
+	adapter := GetAdapter("cursor")
+	doc := &Document{
+		Agents: []byte("# Project\n\nOwn text.\n\nUse tabs.\n\nTyped props.\n\nDeploy to prod.\n\nDeploy to staging.\n"),
+		Rest:   []byte("# Project\n\nOwn text.\n"),
+		Items: []DocumentItem{
+			{Ref: "rule:style", Content: []byte("Use tabs.")},
+			{Ref: "rule:react/props", Description: "React: props", Globs: []string{"**/*.tsx", "**/*.jsx"}, Content: []byte("Typed props.")},
+			{Ref: "rule:deploy", Args: "env=prod", Content: []byte("Deploy to prod.")},
+			{Ref: "rule:deploy", Args: "env=staging", Content: []byte("Deploy to staging.")},
+		},
+	}
+
+	outputs, err := adapter.Render(root, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		CursorFilename: "---\ndescription: Project instructions from AGENTS.md\nalwaysApply: true\n---\n\n" +
+			"<!-- Generated by agmd from AGENTS.md; edit it there and run 'agmd sync' -->\n\n# Project\n\nOwn text.\n",
+		".cursor/rules/agmd-rule-style.mdc": "---\ndescription: rule:style\nalwaysApply: true\n---\n\n" +
+			"<!-- Generated by agmd from rule:style; edit it there and run 'agmd sync' -->\n\nUse tabs.\n",
+		".cursor/rules/agmd-rule-react-props.mdc": "---\ndescription: 'React: props'\nglobs: **/*.tsx,**/*.jsx\nalwaysApply: false\n---\n\n" +
+			"<!-- Generated by agmd from rule:react/props; edit it there and run 'agmd sync' -->\n\nTyped props.\n",
+		".cursor/rules/agmd-rule-deploy-env-prod.mdc": "---\ndescription: rule:deploy env=prod\nalwaysApply: true\n---\n\n" +
+			"<!-- Generated by agmd from rule:deploy env=prod; edit it there and run 'agmd sync' -->\n\nDeploy to prod.\n",
+		".cursor/rules/agmd-rule-deploy-env-staging.mdc": "---\ndescription: rule:deploy env=staging\nalwaysApply: true\n---\n\n" +
+			"<!-- Generated by agmd from rule:deploy env=staging; edit it there and run 'agmd sync' -->\n\nDeploy to staging.\n",
+	}
+	if len(outputs) != len(want) {
+		t.Fatalf("Render() returned %d files, want %d: %+v", len(outputs), len(want), outputs)
+	}
+	for _, output := range outputs {
+		if string(output.Content) != want[output.Path] {
+			t.Errorf("%s:\n%s\nwant:\n%s", output.Path, output.Content, want[output.Path])
+		}
+		path := filepath.Join(root, output.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, output.Content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rules agmd no longer generates are stale; hand-written ones are not
+	handWritten := filepath.Join(root, CursorRulesDir, "team.mdc")
+	if err := os.WriteFile(handWritten, []byte("---\nalwaysApply: true\n---\n\nOurs.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc.Items = slices.Delete(doc.Items, 1, 3)
+	outputs, err = adapter.Render(root, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := adapter.(Pruner).Stale(root, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(stale)
+	if len(stale) != 2 || stale[0] != ".cursor/rules/agmd-rule-deploy-env-prod.mdc" || stale[1] != ".cursor/rules/agmd-rule-react-props.mdc" {
+		t.Errorf("Stale() = %v", stale)
+	}
+
+	if err := adapter.(Cleaner).Clean(root); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(root, CursorRulesDir))
+	if len(entries) != 1 || entries[0].Name() != "team.mdc" {
+		t.Errorf("Clean() left %v, want only the hand-written rule", entries)
+	}
+
+	// Hand-written rules at the paths agmd writes are never replaced
+	for _, path := range []string{CursorFilename, ".cursor/rules/agmd-rule-style.mdc"} {
+		if err := os.WriteFile(filepath.Join(root, path), []byte("---\nalwaysApply: true\n---\n\nOurs.\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := adapter.Render(root, doc); err == nil {
+			t.Errorf("Render() accepted a hand-written %s", path)
+		}
+		if err := os.Remove(filepath.Join(root, path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMarkdownAdapterModes(t *testing.T) {
+	root := t.TempDir()
+	doc := &Document{Agents: []byte("# Agents\n")}
+	adapter := GetAdapter("copilot").(Linker)
+	if adapter.Mode() != ModeSymlink {
+		t.Errorf("default mode = %q, want %q", adapter.Mode(), ModeSymlink)
+	}
+
+	tests := []struct {
+		mode LinkMode
+		want Output
+	}{
+		{ModeSymlink, Output{Path: CopilotFilename, Link: "../AGENTS.md"}},
+		{ModeCopy, Output{Path: CopilotFilename, Content: []byte(CopyHeader + "# Agents\n")}},
+		{ModeHardlink, Output{Path: CopilotFilename, Hardlink: AgentMdFilename}},
+	}
+	for _, tt := range tests {
+		outputs, err := adapter.WithMode(tt.mode).Render(root, doc)
+		if err != nil {
+			t.Fatalf("%s: Render failed: %v", tt.mode, err)
+		}
+		got := outputs[0]
+		if len(outputs) != 1 || got.Path != tt.want.Path || got.Link != tt.want.Link || got.Hardlink != tt.want.Hardlink || string(got.Content) != string(tt.want.Content) {
+			t.Errorf("%s: Render() = %+v, want %+v", tt.mode, outputs, tt.want)
+		}
+	}
+
+	// A copy never replaces a file agmd did not write
+	path := filepath.Join(root, ClaudeFilename)
+	if err := os.WriteFile(path, []byte("# My notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetAdapter("claude").(Linker).WithMode(ModeCopy).Render(root, doc); err == nil {
+		t.Error("copy over a hand-written CLAUDE.md should fail")
+	}
+}
+
+func TestDetectMode(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(AgentMdFilename, "# Agents\n")
+	write("copy.md", string(CopyContent([]byte("# Old agents\n"))))
+	write("notes.md", "# Notes\n")
+	if err := os.Symlink("AGENTS.md", filepath.Join(root, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("notes.md", filepath.Join(root, "other.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("./AGENTS.md", filepath.Join(root, "dot.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, AgentMdFilename), filepath.Join(root, "absolute.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("agent.md", filepath.Join(root, "broken.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(root, AgentMdFilename), filepath.Join(root, "hard.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]LinkMode{
+		"link.md":     ModeSymlink,
+		"dot.md":      ModeSymlink,
+		"absolute.md": ModeSymlink,
+		"copy.md":     ModeCopy,
+		"hard.md":     ModeHardlink,
+		"notes.md":    "",
+		"other.md":    "",
+		"broken.md":   "",
+		"missing.md":  "",
+		"AGENTS.md":   "",
+		"./AGENTS.md": "",
+	} {
+		if got := DetectMode(root, name, AgentMdFilename); got != want {
+			t.Errorf("DetectMode(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { Configure(nil) })
+	err := Configure([]ToolConfig{
+		{Name: "junie", Filename: ".junie/guidelines.md"},
+		{Name: "kiro", Filename: ".kiro/steering/agents.md", Mode: ModeAdapter, Header: "---\ninclusion: always\n---", Footer: "<!-- for {{tool}} -->"},
+		{Name: "claude", Mode: ModeCopy},
+	})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	if tool := GetToolByName("claude"); tool == nil || tool.Filename != ClaudeFilename || tool.Mode != ModeCopy {
+		t.Errorf("claude = %+v, want its built-in file in copy mode", tool)
+	}
+	if tool := GetToolByName("junie"); tool == nil || !tool.NeedsDir {
+		t.Errorf("junie = %+v", tool)
+	}
+	outputs, err := GetAdapter("kiro").Render(t.TempDir(), &Document{Agents: []byte("# Agents\n")})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "---\ninclusion: always\n---\n<!-- Generated by agmd from AGENTS.md for kiro. Do not edit: change directives.md and run 'agmd sync'. -->\n\n# Agents\n\n<!-- for kiro -->\n"
+	if len(outputs) != 1 || string(outputs[0].Content) != want {
+		t.Errorf("Render() = %q, want %q", outputs[0].Content, want)
+	}
+
+	for _, tools := range [][]ToolConfig{
+		{{Name: "zed"}},
+		{{Name: "zed", Filename: ".rules", Header: "# Zed"}},
+		{{Name: "cursor", Mode: ModeCopy}},
+	} {
+		if err := Configure(tools); err == nil {
+			t.Errorf("Configure(%+v) succeeded", tools)
+		}
+	}
+	if GetToolByName("junie") != nil {
+		t.Error("tools of an earlier Configure remain after a failed one")
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CursorRulesDir holds Cursor's project rules
+const CursorRulesDir = ".cursor/rules"
+
+// CursorLegacyFilename is the rules file Cursor read before project rules,
+// which older agmd versions linked to AGENTS.md
+const CursorLegacyFilename = ".cursorrules"
+
+// cursorGeneratedMarker opens the body of every .mdc file agmd writes, so
+// stale ones can be told apart from hand-written rules
+const cursorGeneratedMarker = "<!-- Generated by agmd"
+
+// cursorAdapter writes one Cursor project rule per item included in
+// AGENTS.md, scoped to the item's applies_to_globs, and one always-applied
+// rule with the rest of AGENTS.md
+type cursorAdapter struct{ tool ToolConfig }
+
+func (a cursorAdapter) Tool() ToolConfig { return a.tool }
+
+func (a cursorAdapter) Render(root string, doc *Document) ([]Output, error) {
+	if len(doc.Items) == 0 {
+		rule := cursorRule("Project instructions from AGENTS.md", nil, "AGENTS.md", doc.Agents)
+		return a.own(root, []Output{{Path: a.tool.Filename, Content: rule}})
+	}
+
+	var outputs []Output
+	if len(bytes.TrimSpace(doc.Rest)) > 0 {
+		rule := cursorRule("Project instructions from AGENTS.md", nil, "AGENTS.md", doc.Rest)
+		outputs = append(outputs, Output{Path: a.tool.Filename, Content: rule})
+	}
+	for _, item := range doc.Items {
+		// An item included with different parameters gets a rule for each
+		source := strings.TrimSpace(item.Ref + " " + item.Args)
+		path := filepath.ToSlash(filepath.Join(CursorRulesDir, cursorRuleName(source)))
+		if slices.ContainsFunc(outputs, func(o Output) bool { return o.Path == path }) {
+			return nil, fmt.Errorf("%s and another item both map to %s", source, path)
+		}
+		description := item.Description
+		if description == "" {
+			description = source
+		}
+		rule := cursorRule(description, item.Globs, source, item.Content)
+		outputs = append(outputs, Output{Path: path, Content: rule})
+	}
+	return a.own(root, outputs)
+}
+
+// own returns outputs unless one would replace a rule agmd did not write
+func (a cursorAdapter) own(root string, outputs []Output) ([]Output, error) {
+	for _, output := range outputs {
+		if _, err := os.Lstat(filepath.Join(root, output.Path)); err != nil {
+			continue
+		}
+		if generated, err := isCursorGenerated(root, output.Path); err != nil || !generated {
+			return nil, fmt.Errorf("file %s already exists (not created by agmd)", output.Path)
+		}
+	}
+	return outputs, nil
+}
+
+func (a cursorAdapter) Installed(root string) bool {
+	generated, _ := a.generated(root)
+	return len(generated) > 0 || len(a.Legacy(root)) > 0
+}
+
+// Stale returns the rules agmd generated that outputs no longer include,
+// and a .cursorrules left by older versions
+func (a cursorAdapter) Stale(root string, outputs []Output) ([]string, error) {
+	generated, err := a.generated(root)
+	if err != nil {
+		return nil, err
+	}
+	stale := slices.DeleteFunc(generated, func(path string) bool {
+		return slices.ContainsFunc(outputs, func(o Output) bool { return o.Path == path })
+	})
+	return append(stale, a.Legacy(root)...), nil
+}
+
+// Legacy returns .cursorrules when agmd made it: a symlink, copy or hard link
+// of AGENTS.md, or a symlink broken since AGENTS.md was renamed
+func (a cursorAdapter) Legacy(root string) []string {
+	path := filepath.Join(root, CursorLegacyFilename)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	if DetectMode(root, CursorLegacyFilename, AgentMdFilename) != "" {
+		return []string{CursorLegacyFilename}
+	}
+	if _, err := os.Stat(path); err != nil && info.Mode()&os.ModeSymlink != 0 {
+		return []string{CursorLegacyFilename}
+	}
+	return nil
+}
+
+// Clean removes every rule agmd generated
+func (a cursorAdapter) Clean(root string) error {
+	generated, err := a.generated(root)
+	if err != nil {
+		return err
+	}
+	for _, path := range generated {
+		if err := os.Remove(filepath.Join(root, path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generated returns the .mdc files under .cursor/rules written by agmd,
+// relative to root; hand-written rules are left out
+func (a cursorAdapter) generated(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, CursorRulesDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".mdc" {
+			continue
+		}
+		path := filepath.ToSlash(filepath.Join(CursorRulesDir, entry.Name()))
+		generated, err := isCursorGenerated(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// isCursorGenerated reports whether the rule at path (relative to root) is
+// one agmd wrote: its body opens with the generated marker
+func isCursorGenerated(root, path string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return false, err
+	}
+	_, body, _ := strings.Cut(strings.TrimPrefix(string(data), "---\n"), "\n---\n")
+	return strings.HasPrefix(strings.TrimLeft(body, "\n"), cursorGeneratedMarker), nil
+}
+
+var cursorNameRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// cursorRuleName returns the file name of an item's rule, e.g.
+// agmd-rule-go-errors.mdc for rule:go/errors and agmd-rule-deploy-env-prod.mdc
+// for rule:deploy env=prod
+func cursorRuleName(ref string) string {
+	return "agmd-" + strings.Trim(cursorNameRe.ReplaceAllString(strings.ToLower(ref), "-"), "-") + ".mdc"
+}
+
+// cursorRule renders an .mdc rule: applied to files matching globs, or to
+// every request without globs
+func cursorRule(description string, globs []string, source string, content []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	fmt.Fprintf(&buf, "description: %s\n", yamlString(description))
+	if len(globs) > 0 {
+		fmt.Fprintf(&buf, "globs: %s\n", strings.Join(globs, ","))
+		buf.WriteString("alwaysApply: false\n")
+	} else {
+		buf.WriteString("alwaysApply: true\n")
+	}
+	buf.WriteString("---\n\n")
+	fmt.Fprintf(&buf, "%s from %s; edit it there and run 'agmd sync' -->\n\n", cursorGeneratedMarker, source)
+	buf.Write(bytes.TrimSpace(content))
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// yamlString quotes s when it would not read back as the same plain string
+func yamlString(s string) string {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Sprintf("%q", s)
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
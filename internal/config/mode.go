@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LinkMode is how a tool that reads plain markdown gets AGENTS.md
+type LinkMode string
+
+const (
+	// ModeSymlink links the tool's file to AGENTS.md by a path relative to
+	// the file's directory (the default)
+	ModeSymlink LinkMode = "symlink-relative"
+	// ModeCopy writes a copy of AGENTS.md under a generated-file header,
+	// rewritten by every sync. Copies survive zip exports, Docker build
+	// contexts and git hosting UIs that do not follow symlinks.
+	ModeCopy LinkMode = "copy"
+	// ModeHardlink hard-links the tool's file to AGENTS.md
+	ModeHardlink LinkMode = "hardlink"
+	// ModeAdapter renders the file through the tool's adapter: the native
+	// format of Cursor and Aider, or for other tools AGENTS.md between the
+	// header and footer set in config.toml, rewritten by every sync
+	ModeAdapter LinkMode = "adapter"
+)
+
+// ParseLinkMode validates a mode name; "" and "symlink" are ModeSymlink
+func ParseLinkMode(name string) (LinkMode, error) {
+	switch mode := LinkMode(name); mode {
+	case "", "symlink":
+		return ModeSymlink, nil
+	case ModeSymlink, ModeCopy, ModeHardlink, ModeAdapter:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode %q (expected %s, %s, %s or %s)", name, ModeSymlink, ModeCopy, ModeHardlink, ModeAdapter)
+}
+
+// generatedMarker starts the comment marking the files agmd renders from
+// AGENTS.md
+const generatedMarker = "<!-- Generated by agmd from AGENTS.md"
+
+// CopyHeader opens every copy of AGENTS.md agmd writes
+const CopyHeader = generatedMarker + ". Do not edit: change directives.md and run 'agmd sync'. -->\n\n"
+
+// CopyContent returns the content of a copy-mode file
+func CopyContent(agents []byte) []byte {
+	return append([]byte(CopyHeader), agents...)
+}
+
+// AdapterContent returns the content of an adapter-mode file of a tool that
+// reads plain markdown: the tool's header, a generated-file comment, agents
+// and the footer. {{tool}}, {{path}} and {{source}} in the header and footer
+// are replaced by the tool name, its file and AGENTS.md.
+func AdapterContent(tool ToolConfig, agents []byte) []byte {
+	vars := strings.NewReplacer("{{tool}}", tool.Name, "{{path}}", tool.Filename, "{{source}}", AgentMdFilename)
+	var buf bytes.Buffer
+	if tool.Header != "" {
+		buf.WriteString(strings.TrimRight(vars.Replace(tool.Header), "\n") + "\n")
+	}
+	buf.WriteString(generatedMarker + " for " + tool.Name + ". Do not edit: change directives.md and run 'agmd sync'. -->\n\n")
+	buf.Write(agents)
+	if tool.Footer != "" {
+		buf.WriteString("\n" + strings.TrimRight(vars.Replace(tool.Footer), "\n") + "\n")
+	}
+	return buf.Bytes()
+}
+
+// LinkTarget returns the symlink target leading from filename to source,
+// both relative to the project root
+func LinkTarget(filename, source string) string {
+	target, err := filepath.Rel(filepath.Dir(filename), source)
+	if err != nil {
+		return source
+	}
+	return target
+}
+
+// DetectMode returns how filename reads source (both relative to root), or
+// "" when it does not. A symlink counts when it leads to source by any path
+// (./AGENTS.md, an absolute path, another symlink). Source itself does not
+// read source.
+func DetectMode(root, filename, source string) LinkMode {
+	path := filepath.Join(root, filename)
+	info, err := os.Lstat(path)
+	if err != nil || SamePath(path, filepath.Join(root, source)) {
+		return ""
+	}
+	sourceInfo, err := os.Stat(filepath.Join(root, source))
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if target, statErr := os.Stat(path); err == nil && statErr == nil && os.SameFile(target, sourceInfo) {
+			return ModeSymlink
+		}
+	case err == nil && os.SameFile(info, sourceInfo):
+		return ModeHardlink
+	default:
+		data, _ := os.ReadFile(path)
+		if bytes.HasPrefix(data, []byte(CopyHeader)) {
+			return ModeCopy
+		}
+		if bytes.Contains(data, []byte(generatedMarker+" for ")) {
+			return ModeAdapter
+		}
+	}
+	return ""
+}
+
+// SamePath reports whether a and b are the same directory entry, not just
+// links to the same file: their directories are the same and so are their
+// names (up to case, on file systems that ignore it)
+func SamePath(a, b string) bool {
+	nameA, nameB := filepath.Base(a), filepath.Base(b)
+	if !strings.EqualFold(nameA, nameB) {
+		return false
+	}
+	dirA, errA := os.Stat(filepath.Dir(a))
+	dirB, errB := os.Stat(filepath.Dir(b))
+	if errA != nil || errB != nil || !os.SameFile(dirA, dirB) {
+		return false
+	}
+	if nameA == nameB {
+		return true
+	}
+	infoA, errA := os.Lstat(a)
+	infoB, errB := os.Lstat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
@@ -1,5 +1,11 @@
 package config
 
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
 // AgentMdFilename is the main configuration file
 const AgentMdFilename = "AGENTS.md"
 
@@ -14,33 +20,83 @@ var LegacyFilenames = []string{
 	".continuerules",
 }
 
-// Tool configuration filenames (symlink targets)
+// Tool configuration filenames
 const (
 	ClaudeFilename    = "CLAUDE.md"
-	CursorFilename    = ".cursorrules"
+	CursorFilename    = ".cursor/rules/agents.mdc"
 	WindsurfFilename  = ".windsurfrules"
 	CopilotFilename   = ".github/copilot-instructions.md"
 	AiderFilename     = ".aider.conf.yml"
 )
 
-// ToolConfig represents a tool's symlink configuration
+// ToolConfig represents a tool's output configuration
 type ToolConfig struct {
 	Name     string
 	Filename string
-	NeedsDir bool // true if we need to create a directory (e.g., .github/)
+	NeedsDir bool     // true if we need to create a directory (e.g., .github/)
+	Mode     LinkMode // Mode set in config.toml, "" when it is not
+	Header   string   // Template written above AGENTS.md in ModeAdapter
+	Footer   string   // Template written below AGENTS.md in ModeAdapter
 }
 
-// AvailableTools returns all supported tools
-func AvailableTools() []ToolConfig {
+// builtinTools are the tools agmd supports out of the box
+func builtinTools() []ToolConfig {
 	return []ToolConfig{
 		{Name: "claude", Filename: ClaudeFilename, NeedsDir: false},
-		{Name: "cursor", Filename: CursorFilename, NeedsDir: false},
+		{Name: "cursor", Filename: CursorFilename, NeedsDir: true},
 		{Name: "windsurf", Filename: WindsurfFilename, NeedsDir: false},
 		{Name: "copilot", Filename: CopilotFilename, NeedsDir: true},
 		{Name: "aider", Filename: AiderFilename, NeedsDir: false},
 	}
 }
 
+// configuredTools are the tools set by Configure
+var configuredTools []ToolConfig
+
+// Configure adds the tools declared in config.toml to AvailableTools. A tool
+// named like a built-in one overrides the settings it sets (path, mode,
+// header and footer); a new tool needs a filename. On error only the
+// built-in tools are available.
+func Configure(tools []ToolConfig) error {
+	configuredTools = nil
+	builtin := builtinTools()
+	for _, tool := range tools {
+		i := slices.IndexFunc(builtin, func(b ToolConfig) bool { return b.Name == tool.Name })
+		if i < 0 && tool.Filename == "" {
+			return fmt.Errorf("tool %s: path is required", tool.Name)
+		}
+		if (tool.Header != "" || tool.Footer != "") && tool.Mode != ModeAdapter {
+			return fmt.Errorf("tool %s: header and footer need mode %q", tool.Name, ModeAdapter)
+		}
+		if (tool.Name == "cursor" || tool.Name == "aider") && tool.Mode != "" && tool.Mode != ModeAdapter {
+			return fmt.Errorf("tool %s: %s files are written in the tool's own format (mode %q)", tool.Name, tool.Name, ModeAdapter)
+		}
+	}
+	configuredTools = tools
+	return nil
+}
+
+// AvailableTools returns all supported tools: the built-in ones, with the
+// settings Configure overrides, then the tools it adds
+func AvailableTools() []ToolConfig {
+	tools := builtinTools()
+	for _, tool := range configuredTools {
+		i := slices.IndexFunc(tools, func(t ToolConfig) bool { return t.Name == tool.Name })
+		if i < 0 {
+			tools = append(tools, ToolConfig{Name: tool.Name})
+			i = len(tools) - 1
+		}
+		if tool.Filename != "" {
+			tools[i].Filename = tool.Filename
+			tools[i].NeedsDir = filepath.Dir(tool.Filename) != "."
+		}
+		tools[i].Mode = tool.Mode
+		tools[i].Header = tool.Header
+		tools[i].Footer = tool.Footer
+	}
+	return tools
+}
+
 // GetToolByName returns a tool configuration by name
 func GetToolByName(name string) *ToolConfig {
 	for _, tool := range AvailableTools() {
@@ -51,7 +107,7 @@ func GetToolByName(name string) *ToolConfig {
 	return nil
 }
 
-// DefaultTemplate is the initial agent.md template
+// DefaultTemplate is the initial AGENTS.md template
 const DefaultTemplate = `# Agent Configuration
 
 This file contains rules and guidelines for AI coding assistants working on this project.
@@ -1,9 +1,11 @@
 package symlink
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"agmd/internal/config"
 )
@@ -11,6 +13,10 @@ import (
 // Manager handles symlink operations
 type Manager struct {
 	sourceFile string
+
+	// Document returns the document the files of a tool are rendered from,
+	// for List to tell stale copies; nil renders them from the source file
+	Document func(tool string) (*config.Document, error)
 }
 
 // NewManager creates a new symlink manager
@@ -20,109 +26,336 @@ func NewManager(sourceFile string) *Manager {
 	}
 }
 
-// Create creates a symlink for the specified tool
-func (m *Manager) Create(tool config.ToolConfig) error {
-	// If the tool needs a directory, create it
-	if tool.NeedsDir {
-		dir := filepath.Dir(tool.Filename)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+// Write writes the files a tool reads: symlinks, copies or hard links of the
+// source file, and generated files in the tool's own format. Files the tool
+// generated earlier and no longer needs are removed. It returns the files
+// written and removed.
+func (m *Manager) Write(adapter config.ToolAdapter, doc *config.Document) (written, removed []string, err error) {
+	outputs, err := adapter.Render(".", doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, output := range outputs {
+		if config.SamePath(output.Path, m.sourceFile) {
+			return written, nil, fmt.Errorf("%s is %s itself, not a file for %s", output.Path, m.sourceFile, adapter.Tool().Name)
+		}
+
+		// If the output is in a directory, create it
+		if dir := filepath.Dir(output.Path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return written, nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+			}
+		}
+
+		var wrote bool
+		switch {
+		case output.Link != "":
+			wrote, err = m.link(output.Path, output.Link)
+		case output.Hardlink != "":
+			wrote, err = m.hardlink(output.Path, output.Hardlink)
+		default:
+			wrote, err = m.writeGenerated(output.Path, output.Content)
+		}
+		if err != nil {
+			return written, nil, err
+		}
+		if wrote {
+			written = append(written, output.Path)
+		}
+	}
+
+	if pruner, ok := adapter.(config.Pruner); ok {
+		stale, err := pruner.Stale(".", outputs)
+		if err != nil {
+			return written, nil, err
+		}
+		for _, path := range stale {
+			if err := os.Remove(path); err != nil {
+				return written, removed, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			removed = append(removed, path)
 		}
 	}
+	return written, removed, nil
+}
 
+// link creates a symlink at filename pointing to target. A copy, hard link
+// or symlink to the source file agmd made earlier is replaced.
+func (m *Manager) link(filename, target string) (bool, error) {
 	// Check if target already exists
-	if _, err := os.Lstat(tool.Filename); err == nil {
-		// File exists, check if it's already a symlink to agent.md
-		target, err := os.Readlink(tool.Filename)
-		if err == nil && target == m.sourceFile {
-			// Already a valid symlink
-			return nil
+	if _, err := os.Lstat(filename); err == nil {
+		// File exists, check if it's already the symlink
+		current, err := os.Readlink(filename)
+		if err == nil && current == target {
+			return false, nil
+		}
+		if err := m.replace(filename); err != nil {
+			return false, err
 		}
-
-		// File exists but is not our symlink
-		return fmt.Errorf("file %s already exists (not a symlink to %s)", tool.Filename, m.sourceFile)
 	}
 
 	// Create the symlink
-	if err := os.Symlink(m.sourceFile, tool.Filename); err != nil {
-		return fmt.Errorf("failed to create symlink %s: %w", tool.Filename, err)
+	if err := os.Symlink(target, filename); err != nil {
+		return false, fmt.Errorf("failed to create symlink %s: %w", filename, err)
+	}
+
+	return true, nil
+}
+
+// hardlink hard-links filename to target
+func (m *Manager) hardlink(filename, target string) (bool, error) {
+	if info, err := os.Lstat(filename); err == nil {
+		if source, err := os.Stat(target); err == nil && os.SameFile(info, source) {
+			return false, nil
+		}
+		if err := m.replace(filename); err != nil {
+			return false, err
+		}
 	}
 
+	if err := os.Link(target, filename); err != nil {
+		return false, fmt.Errorf("failed to create hard link %s: %w", filename, err)
+	}
+	return true, nil
+}
+
+// replace removes a file agmd made for the source file, to put another in
+// its place; any other file is an error
+func (m *Manager) replace(filename string) error {
+	if config.SamePath(filename, m.sourceFile) {
+		return fmt.Errorf("refusing to replace %s itself", m.sourceFile)
+	}
+	if config.DetectMode(".", filename, m.sourceFile) == "" {
+		if _, err := os.Stat(filename); err != nil {
+			return fmt.Errorf("file %s is a broken symlink (run 'agmd symlink repair')", filename)
+		}
+		return fmt.Errorf("file %s already exists (not created by agmd)", filename)
+	}
+	if err := os.Remove(filename); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", filename, err)
+	}
 	return nil
 }
 
-// Remove removes a symlink
-func (m *Manager) Remove(filename string) error {
-	// Check if it's a symlink
-	info, err := os.Lstat(filename)
-	if err != nil {
-		return fmt.Errorf("file %s not found: %w", filename, err)
+// writeGenerated writes a generated file unless it is up to date. A symlink
+// or hard link to the source file in its place, left by older agmd versions
+// or another mode, is replaced (writing to it would change the source); any
+// other symlink is written through.
+func (m *Manager) writeGenerated(filename string, content []byte) (bool, error) {
+	if mode := config.DetectMode(".", filename, m.sourceFile); mode == config.ModeSymlink || mode == config.ModeHardlink {
+		if err := os.Remove(filename); err != nil {
+			return false, fmt.Errorf("failed to remove %s: %w", filename, err)
+		}
+	} else if current, err := os.ReadFile(filename); err == nil && bytes.Equal(current, content) {
+		return false, nil
 	}
 
-	// Verify it's a symlink
-	if info.Mode()&os.ModeSymlink == 0 {
-		return fmt.Errorf("%s is not a symlink", filename)
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", filename, err)
 	}
+	return true, nil
+}
 
-	// Verify it points to agent.md
-	target, err := os.Readlink(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read symlink %s: %w", filename, err)
+// Remove removes a symlink, copy or hard link of the source file, or a file
+// generated for a tool
+func (m *Manager) Remove(filename string) error {
+	if _, err := os.Lstat(filename); err != nil {
+		return fmt.Errorf("file %s not found: %w", filename, err)
 	}
 
-	if target != m.sourceFile {
-		return fmt.Errorf("%s is a symlink but doesn't point to %s (points to %s)", filename, m.sourceFile, target)
+	// Generated files are removed by their tool's rules
+	adapter := config.AdapterFor(filename)
+	if _, linked := adapter.(config.Linker); adapter != nil && !linked {
+		if cleaner, ok := adapter.(config.Cleaner); ok {
+			return cleaner.Clean(".")
+		}
+	} else if config.DetectMode(".", filename, m.sourceFile) == "" {
+		return fmt.Errorf("%s is not a symlink, copy or hard link of %s", filename, m.sourceFile)
 	}
 
-	// Remove the symlink
 	if err := os.Remove(filename); err != nil {
-		return fmt.Errorf("failed to remove symlink %s: %w", filename, err)
+		return fmt.Errorf("failed to remove %s: %w", filename, err)
 	}
-
 	return nil
 }
 
-// List returns all existing symlinks and their status
+// List returns the status of every tool's file
 func (m *Manager) List() []SymlinkStatus {
 	var statuses []SymlinkStatus
 
-	for _, tool := range config.AvailableTools() {
-		status := SymlinkStatus{
-			Tool:     tool,
-			Exists:   false,
-			IsValid:  false,
-			Target:   "",
+	for _, adapter := range config.Adapters() {
+		tool := adapter.Tool()
+		status := SymlinkStatus{Tool: tool}
+		if migrator, ok := adapter.(config.Migrator); ok {
+			status.Legacy = migrator.Legacy(".")
 		}
 
 		info, err := os.Lstat(tool.Filename)
-		if err == nil {
-			status.Exists = true
-
-			// Check if it's a symlink
-			if info.Mode()&os.ModeSymlink != 0 {
-				target, err := os.Readlink(tool.Filename)
-				if err == nil {
-					status.Target = target
-					status.IsValid = (target == m.sourceFile)
-				}
-			}
+		if err != nil {
+			statuses = append(statuses, status)
+			continue
+		}
+		status.Exists = true
+		if info.Mode()&os.ModeSymlink != 0 {
+			status.Target, _ = os.Readlink(tool.Filename)
+		}
+
+		linker, ok := adapter.(config.Linker)
+		if !ok {
+			status.Generated = true
+			status.IsValid = adapter.Installed(".")
+			statuses = append(statuses, status)
+			continue
 		}
 
+		status.Mode = config.DetectMode(".", tool.Filename, m.sourceFile)
+		switch status.Mode {
+		case config.ModeSymlink:
+			status.IsValid = true
+		case config.ModeCopy, config.ModeAdapter:
+			status.IsValid = true
+			status.Stale = m.stale(linker.WithMode(status.Mode))
+		case config.ModeHardlink:
+			status.IsValid = true
+		}
 		statuses = append(statuses, status)
 	}
 
 	return statuses
 }
 
-// SymlinkStatus represents the status of a symlink
+// stale reports whether the file a tool adapter writes differs from what the
+// adapter renders now
+func (m *Manager) stale(adapter config.ToolAdapter) bool {
+	doc, err := m.document(adapter.Tool().Name)
+	if err != nil {
+		return true
+	}
+	outputs, err := adapter.Render(".", doc)
+	if err != nil || len(outputs) != 1 {
+		return true
+	}
+	current, err := os.ReadFile(outputs[0].Path)
+	return err != nil || !bytes.Equal(current, outputs[0].Content)
+}
+
+// document returns the document the files of tool are rendered from
+func (m *Manager) document(tool string) (*config.Document, error) {
+	if m.Document != nil {
+		return m.Document(tool)
+	}
+	source, err := os.ReadFile(m.sourceFile)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Document{Agents: source}, nil
+}
+
+// SymlinkStatus represents the status of a tool's file
 type SymlinkStatus struct {
-	Tool    config.ToolConfig
-	Exists  bool
-	IsValid bool // true if it's a valid symlink to agent.md
-	Target  string
+	Tool      config.ToolConfig
+	Exists    bool
+	IsValid   bool            // true if it reads the source file (by symlink, copy or hard link), or is a generated file set up for the tool
+	Generated bool            // true if it's a file in the tool's own format
+	Mode      config.LinkMode // How a plain markdown file reads the source file, "" if it does not
+	Stale     bool            // true if it's a copy or adapter-mode file that differs from what the source file renders to
+	Target    string          // Target of a symlink, as written in the link
+	Legacy    []string        // Files older agmd versions made for the tool instead, still in place
+}
+
+// LinkRepair is a symlink Repair points back to the source file, or a file
+// from older agmd versions it replaces
+type LinkRepair struct {
+	Path        string
+	Target      string // Target of the link before the repair
+	NewTarget   string
+	Replacement string // File written instead of Path, which is removed (e.g. .cursor/rules/agents.mdc for .cursorrules)
+}
+
+// Repair finds the symlinks at tool and legacy filenames that are broken
+// (e.g. after the file they pointed to was renamed), or that lead to the
+// source file by a path other than the relative one, and relinks them to the
+// source file. Files a tool read before (.cursorrules) are replaced by its
+// current ones. With dryRun it only reports them.
+func (m *Manager) Repair(dryRun bool) ([]LinkRepair, error) {
+	if err := m.Verify(); err != nil {
+		return nil, err
+	}
+
+	var filenames []string
+	for _, adapter := range config.Adapters() {
+		if _, ok := adapter.(config.Linker); ok {
+			filenames = append(filenames, adapter.Tool().Filename)
+		}
+	}
+	for _, filename := range config.LegacyFilenames {
+		if !slices.Contains(filenames, filename) {
+			filenames = append(filenames, filename)
+		}
+	}
+
+	var repairs []LinkRepair
+	var migrators []config.ToolAdapter
+	for _, adapter := range config.Adapters() {
+		migrator, ok := adapter.(config.Migrator)
+		if !ok {
+			continue
+		}
+		for _, filename := range migrator.Legacy(".") {
+			target, _ := os.Readlink(filename)
+			repairs = append(repairs, LinkRepair{Path: filename, Target: target, Replacement: adapter.Tool().Filename})
+			filenames = slices.DeleteFunc(filenames, func(name string) bool { return name == filename })
+			if !slices.Contains(migrators, adapter) {
+				migrators = append(migrators, adapter)
+			}
+		}
+	}
+	if !dryRun {
+		for _, adapter := range migrators {
+			doc, err := m.document(adapter.Tool().Name)
+			if err != nil {
+				return repairs, err
+			}
+			if _, _, err := m.Write(adapter, doc); err != nil {
+				return repairs, fmt.Errorf("failed to write %s files: %w", adapter.Tool().Name, err)
+			}
+		}
+	}
+
+	for _, filename := range filenames {
+		info, err := os.Lstat(filename)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := os.Readlink(filename)
+		if err != nil {
+			return repairs, fmt.Errorf("failed to read symlink %s: %w", filename, err)
+		}
+		newTarget := config.LinkTarget(filename, m.sourceFile)
+		if target == newTarget {
+			continue
+		}
+		// Links to other files that exist are the user's own
+		if _, err := os.Stat(filename); err == nil && config.DetectMode(".", filename, m.sourceFile) == "" {
+			continue
+		}
+
+		repairs = append(repairs, LinkRepair{Path: filename, Target: target, NewTarget: newTarget})
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(filename); err != nil {
+			return repairs, fmt.Errorf("failed to remove %s: %w", filename, err)
+		}
+		if err := os.Symlink(newTarget, filename); err != nil {
+			return repairs, fmt.Errorf("failed to create symlink %s: %w", filename, err)
+		}
+	}
+	return repairs, nil
 }
 
-// Verify checks if agent.md exists
+// Verify checks if the source file exists
 func (m *Manager) Verify() error {
 	if _, err := os.Stat(m.sourceFile); err != nil {
 		if os.IsNotExist(err) {
@@ -0,0 +1,246 @@
+// Package diff produces unified diffs of text files
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// op is one line of an edit script: ' ' keeps a line, '-' deletes a[A], '+' inserts b[B]
+type op struct {
+	kind byte
+	a, b int // Line indexes in a and b (insertion points for the side not involved)
+}
+
+// Unified returns a unified diff turning a into b with the given number of
+// context lines, or "" when a and b are equal
+func Unified(fromName, toName, a, b string, context int) string {
+	aLines, bLines := splitLines(a), splitLines(b)
+	ops := edits(aLines, bLines)
+	if !slices.ContainsFunc(ops, func(o op) bool { return o.kind != ' ' }) {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Changes separated by at most 2*context unchanged lines share a hunk
+		start, last := max(0, i-context), i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			} else if j-last > 2*context {
+				break
+			}
+		}
+		stop := min(len(ops), last+context+1)
+
+		writeHunk(&out, ops[start:stop], aLines, bLines)
+		i = stop
+	}
+
+	return out.String()
+}
+
+// writeHunk writes one @@ hunk
+func writeHunk(out *strings.Builder, ops []op, a, b []string) {
+	aCount, bCount := 0, 0
+	for _, o := range ops {
+		if o.kind != '+' {
+			aCount++
+		}
+		if o.kind != '-' {
+			bCount++
+		}
+	}
+	aStart, bStart := ops[0].a, ops[0].b
+	if aCount > 0 {
+		aStart++
+	}
+	if bCount > 0 {
+		bStart++
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+
+	for _, o := range ops {
+		line := ""
+		switch o.kind {
+		case '+':
+			line = b[o.b]
+		default:
+			line = a[o.a]
+		}
+		out.WriteByte(o.kind)
+		out.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits s into lines that keep their trailing newline
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edits returns the shortest edit script from a to b (Myers' algorithm)
+func edits(a, b []string) []op {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk back through the saved frontiers to recover the path
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, op{kind: ' ', a: x - 1, b: y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, op{kind: '+', a: x, b: y - 1})
+			} else {
+				ops = append(ops, op{kind: '-', a: x - 1, b: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	slices.Reverse(ops)
+	return ops
+}
+
+// ConflictError reports a change that could not be located in the patched text
+type ConflictError struct {
+	Line int      // Line of the change in the original text (1-based)
+	Old  []string // Lines the change replaces
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("change at line %d does not apply", e.Line)
+}
+
+// Patch applies the changes that turn a into b to base, a text that shares
+// most of its lines with a. Each changed run of lines is located in base by
+// the lines it replaces plus up to context surrounding lines, falling back to
+// less context when the surroundings differ; a run that cannot be located
+// unambiguously returns a *ConflictError.
+func Patch(base, a, b string, context int) (string, error) {
+	aLines, bLines, baseLines := strings.Split(a, "\n"), strings.Split(b, "\n"), strings.Split(base, "\n")
+	ops := edits(aLines, bLines)
+
+	var out []string
+	cursor := 0 // First line of base not yet copied to out
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		j := i
+		var old, repl []string
+		for ; j < len(ops) && ops[j].kind != ' '; j++ {
+			if ops[j].kind == '-' {
+				old = append(old, aLines[ops[j].a])
+			} else {
+				repl = append(repl, bLines[ops[j].b])
+			}
+		}
+
+		start := ops[i].a
+		at, ok := locate(baseLines[cursor:], aLines, start, start+len(old), context)
+		if !ok {
+			return "", &ConflictError{Line: start + 1, Old: old}
+		}
+		at += cursor
+
+		out = append(out, baseLines[cursor:at]...)
+		out = append(out, repl...)
+		cursor = at + len(old)
+		i = j
+	}
+	out = append(out, baseLines[cursor:]...)
+
+	return strings.Join(out, "\n"), nil
+}
+
+// locate finds where a[start:end] sits in base, trying the most surrounding
+// context first, and returns its index when exactly one place matches
+func locate(base, a []string, start, end, context int) (int, bool) {
+	type attempt struct{ before, after int }
+	var attempts []attempt
+	for k := context; k >= 0; k-- {
+		attempts = append(attempts, attempt{k, k})
+	}
+	for k := context; k >= 1; k-- {
+		attempts = append(attempts, attempt{0, k}, attempt{k, 0})
+	}
+
+	for _, at := range attempts {
+		before, after := min(at.before, start), min(at.after, len(a)-end)
+		pattern := a[start-before : end+after]
+		if !slices.ContainsFunc(pattern, func(line string) bool { return strings.TrimSpace(line) != "" }) {
+			// Blank lines alone would match almost anywhere
+			continue
+		}
+
+		found, matches := -1, 0
+		for p := 0; p+len(pattern) <= len(base); p++ {
+			if slices.Equal(base[p:p+len(pattern)], pattern) {
+				found = p
+				matches++
+			}
+		}
+		if matches == 1 {
+			return found + before, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "equal", a: "a\nb\n", b: "a\nb\n", want: ""},
+		{
+			name: "change in the middle",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "separate hunks",
+			a:    "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			b:    "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "new\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+new\n",
+		},
+		{
+			name: "missing final newline",
+			a:    "x\n",
+			b:    "x",
+			want: "--- old\n+++ new\n@@ -1,1 +1,1 @@\n-x\n+x\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.a, tt.b, 3); got != tt.want {
+				t.Errorf("Unexpected diff\n--- want ---\n%s\n--- got ---\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		base, a, b string
+		want       string
+		conflict   bool
+	}{
+		{
+			name: "same text",
+			base: "a\nb\nc\n", a: "a\nb\nc\n", b: "a\nB\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "shifted base",
+			base: "header\n\na\nb\nc\n", a: "a\nb\nc\n", b: "a\nb\nnew\nc\n",
+			want: "header\n\na\nb\nnew\nc\n",
+		},
+		{
+			name: "context differs in base",
+			base: ":::include rule:x\n\nintro\nold\n", a: "X content\n\nintro\nold\n", b: "X content\n\nintro\nnew\n",
+			want: ":::include rule:x\n\nintro\nnew\n",
+		},
+		{
+			name: "ambiguous",
+			base: "x\nsame\ny\nsame\nz\n", a: "same\n", b: "other\n",
+			conflict: true,
+		},
+		{
+			name: "missing",
+			base: "a\nb\n", a: "c\n", b: "d\n",
+			conflict: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Patch(tt.base, tt.a, tt.b, 3)
+			if tt.conflict {
+				var conflict *ConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("Expected *ConflictError, got %v (%q)", err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Patch failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Patch mismatch\n--- want ---\n%s\n--- got ---\n%s", tt.want, got)
+			}
+		})
+	}
+}
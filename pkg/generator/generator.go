@@ -1,21 +1,44 @@
 package generator
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"agmd/pkg/parser"
 	"agmd/pkg/registry"
 	"agmd/pkg/state"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Generator handles AGENTS.md generation from registry and state
 type Generator struct {
-	Registry *registry.Registry
-	State    *state.ProjectState
+	Registry     *registry.Registry
+	State        *state.ProjectState
+	AllowMissing bool // Skip unresolved directive references instead of failing
+	MaxDepth     int  // Maximum include nesting (0 = parser default)
+
+	// Vars overrides the vars: frontmatter of directives.md (e.g. from --set)
+	Vars map[string]string
+
+	// Target names the output being generated, for :::if target=... blocks
+	// (a target set in Vars or the vars: frontmatter wins)
+	Target string
+
+	// Provenance marks each expanded item with <!-- agmd:begin/end -->
+	// comments (also enabled by provenance: true in directives.md)
+	Provenance bool
+
+	// Dependencies overrides the dependencies: frontmatter of directives.md
+	Dependencies parser.DependencyPolicy
 }
 
+// DefaultTarget is the output target name used for AGENTS.md
+const DefaultTarget = "agents"
+
 // New creates a new Generator
 func New(reg *registry.Registry, st *state.ProjectState) *Generator {
 	return &Generator{
@@ -93,35 +116,136 @@ func formatAsSubsection(name, content string) string {
 	return builder.String()
 }
 
+// DirectivesMeta is the optional YAML frontmatter of directives.md
+type DirectivesMeta struct {
+	Name        string            `yaml:"name,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Vars        map[string]string `yaml:"vars,omitempty"`       // Project-wide values for item {{placeholders}}
+	Provenance  bool              `yaml:"provenance,omitempty"` // Wrap expanded items in provenance markers
+	// Dependencies is include (add the items that included items require)
+	// or warn (only report them)
+	Dependencies string `yaml:"dependencies,omitempty"`
+	// Targets names the tools whose files sync writes next to AGENTS.md
+	// (claude, cursor, windsurf, copilot, aider, or tools in config.toml)
+	Targets []string `yaml:"targets,omitempty"`
+	// Modes sets how tools that read plain markdown get AGENTS.md, by tool
+	// name: symlink-relative (the default), copy, hardlink or adapter
+	Modes map[string]string `yaml:"modes,omitempty"`
+}
+
+// ReadMeta returns the frontmatter of directives.md
+func ReadMeta(inputPath string) (*DirectivesMeta, error) {
+	meta, _, _, err := readDirectives(inputPath)
+	return meta, err
+}
+
+// readDirectives reads directives.md and returns its frontmatter, its body
+// and the number of lines before the body
+func readDirectives(inputPath string) (*DirectivesMeta, []byte, int, error) {
+	content, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to read %s: %w", inputPath, err)
+	}
+
+	// Split off frontmatter if present, keeping track of the lines removed
+	frontmatter, body := splitFrontmatter(content)
+	lineOffset := bytes.Count(content[:len(content)-len(body)], []byte("\n"))
+
+	var meta DirectivesMeta
+	if err := yaml.Unmarshal(frontmatter, &meta); err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid frontmatter in %s: %w", inputPath, err)
+	}
+	return &meta, body, lineOffset, nil
+}
+
 // ParseAndExpand reads directives.md, strips frontmatter, expands directives from registry, and returns the result
 func (g *Generator) ParseAndExpand(inputPath string) (string, error) {
-	content, err := os.ReadFile(inputPath)
+	expansion, err := g.Expand(inputPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read %s: %w", inputPath, err)
+		return "", err
 	}
+	return string(expansion.Output), nil
+}
 
-	// Strip frontmatter if present
-	content = stripFrontmatter(content)
+// Expand is ParseAndExpand that also returns the registry items used
+func (g *Generator) Expand(inputPath string) (*parser.Expansion, error) {
+	body, opts, err := g.parserInput(inputPath)
+	if err != nil {
+		return nil, err
+	}
 
 	// Use the parser to expand directives
-	expanded, err := parser.ParseAndExpand(content, g.Registry.BasePath)
+	expansion, err := parser.ExpandDocument(body, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse and expand directives: %w", err)
+	}
+
+	return expansion, nil
+}
+
+// Check reads directives.md like ParseAndExpand and returns the diagnostics
+// for it and every registry item or project file it includes
+func (g *Generator) Check(inputPath string) ([]parser.Diagnostic, error) {
+	body, opts, err := g.parserInput(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	return parser.Check(body, opts), nil
+}
+
+// parserInput reads directives.md and returns its body with the parser
+// options derived from its frontmatter and the generator settings
+func (g *Generator) parserInput(inputPath string) ([]byte, parser.Options, error) {
+	meta, body, lineOffset, err := readDirectives(inputPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse and expand directives: %w", err)
+		return nil, parser.Options{}, err
+	}
+
+	vars := make(map[string]string, len(meta.Vars)+len(g.Vars))
+	for key, value := range meta.Vars {
+		vars[key] = value
+	}
+	for key, value := range g.Vars {
+		vars[key] = value
+	}
+
+	dependencies := g.Dependencies
+	if dependencies == "" {
+		if dependencies, err = parser.ParseDependencyPolicy(meta.Dependencies); err != nil {
+			return nil, parser.Options{}, fmt.Errorf("invalid frontmatter in %s: %w", inputPath, err)
+		}
+	}
+
+	target := g.Target
+	if target == "" {
+		target = DefaultTarget
 	}
 
-	return string(expanded), nil
+	return body, parser.Options{
+		RegistryPath: g.Registry.BasePath,
+		Layers:       g.Registry.Layers,
+		Filename:     inputPath,
+		LineOffset:   lineOffset,
+		AllowMissing: g.AllowMissing,
+		MaxDepth:     g.MaxDepth,
+		Vars:         vars,
+		Target:       target,
+		ProjectRoot:  filepath.Dir(inputPath),
+		Provenance:   g.Provenance || meta.Provenance,
+		Dependencies: dependencies,
+	}, nil
 }
 
-// stripFrontmatter removes YAML frontmatter from content if present
-func stripFrontmatter(content []byte) []byte {
+// splitFrontmatter separates YAML frontmatter from content if present
+func splitFrontmatter(content []byte) ([]byte, []byte) {
 	if len(content) < 4 || string(content[:4]) != "---\n" {
-		return content
+		return nil, content
 	}
 
 	// Find the closing delimiter
 	end := -1
 	for i := 4; i < len(content)-3; i++ {
-		if content[i] == '\n' && i+4 < len(content) && string(content[i+1:i+4]) == "---" {
+		if content[i] == '\n' && string(content[i+1:i+4]) == "---" {
 			if i+4 == len(content) || content[i+4] == '\n' || content[i+4] == '\r' {
 				end = i + 4
 				break
@@ -130,12 +254,13 @@ func stripFrontmatter(content []byte) []byte {
 	}
 
 	if end == -1 {
-		return content
+		return nil, content
 	}
 
+	frontmatter := content[4 : end-3]
 	for end < len(content) && (content[end] == '\n' || content[end] == '\r') {
 		end++
 	}
 
-	return content[end:]
+	return frontmatter, content[end:]
 }
@@ -0,0 +1,152 @@
+// Package git drives the git command line for registry directories
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrNotInstalled is returned when no git executable is found in PATH
+var ErrNotInstalled = errors.New("git not found in PATH")
+
+// Repo is a directory inside a git working tree. Commits made through it
+// only include changes below Dir, so a registry kept inside a larger
+// repository (e.g. dotfiles) leaves the rest of that repository alone.
+type Repo struct {
+	Dir string
+}
+
+// Commit is one revision from the log
+type Commit struct {
+	Hash    string
+	Short   string
+	Author  string
+	Date    time.Time
+	Subject string
+}
+
+// Open returns the repository for dir; use IsRepo to check it is tracked
+func Open(dir string) *Repo {
+	return &Repo{Dir: dir}
+}
+
+// Run executes git in the repository and returns its trimmed stdout. The
+// error carries git's stderr.
+func (r *Repo) Run(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	if err := r.Exec(&stdout, &stderr, args...); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", err
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// Exec executes git in the repository, streaming its output
+func (r *Repo) Exec(stdout, stderr io.Writer, args ...string) error {
+	path, err := exec.LookPath("git")
+	if err != nil {
+		return ErrNotInstalled
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Dir = r.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// IsRepo reports whether Dir is inside a git working tree
+func (r *Repo) IsRepo() bool {
+	out, err := r.Run("rev-parse", "--is-inside-work-tree")
+	return err == nil && out == "true"
+}
+
+// TopLevel returns the root of the working tree containing Dir
+func (r *Repo) TopLevel() (string, error) {
+	return r.Run("rev-parse", "--show-toplevel")
+}
+
+// Init creates a repository in Dir
+func (r *Repo) Init() error {
+	_, err := r.Run("init", "--quiet")
+	return err
+}
+
+// CommitAll stages every change below Dir and commits it with message. It
+// returns false, without committing, when there is nothing to commit.
+func (r *Repo) CommitAll(message string) (bool, error) {
+	if _, err := r.Run("add", "--all", "--", "."); err != nil {
+		return false, err
+	}
+	// diff --cached --quiet exits 1 when something is staged
+	if _, err := r.Run("diff", "--cached", "--quiet", "--", "."); err == nil {
+		return false, nil
+	}
+	if _, err := r.Run("commit", "--quiet", "--message", message, "--", "."); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// HasUpstream reports whether the current branch tracks a remote branch
+func (r *Repo) HasUpstream() bool {
+	_, err := r.Run("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	return err == nil
+}
+
+// logFormat separates the fields of each commit with a unit separator
+const logFormat = "--format=%H%x1f%h%x1f%an%x1f%aI%x1f%s"
+
+// Log returns the commits that changed path (relative to Dir), newest
+// first, following renames
+func (r *Repo) Log(path string) ([]Commit, error) {
+	out, err := r.Run("log", "--follow", logFormat, "--", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[3])
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Short:   fields[1],
+			Author:  fields[2],
+			Date:    date,
+			Subject: fields[4],
+		})
+	}
+	return commits, nil
+}
+
+// Show returns the content of path (relative to Dir) at revision rev
+func (r *Repo) Show(rev, path string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	if err := r.Exec(&stdout, &stderr, "show", rev+":./"+path); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git show: %s", msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Clone copies the repository at url (a remote URL, file:// URL or local
+// path) into dir
+func Clone(url, dir string) error {
+	_, err := (&Repo{}).Run("clone", "--quiet", url, dir)
+	return err
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// setupGit skips the test without git and gives commits a fixed identity
+func setupGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitLogShow(t *testing.T) {
+	setupGit(t)
+	dir := t.TempDir()
+	repo := Open(dir)
+
+	if repo.IsRepo() {
+		t.Fatal("IsRepo() = true before Init")
+	}
+	if err := repo.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.IsRepo() {
+		t.Fatal("IsRepo() = false after Init")
+	}
+
+	writeFile(t, filepath.Join(dir, "rule", "style.md"), "v1\n")
+	if ok, err := repo.CommitAll("Add rule:style"); err != nil || !ok {
+		t.Fatalf("CommitAll() = %v, %v", ok, err)
+	}
+	writeFile(t, filepath.Join(dir, "rule", "style.md"), "v2\n")
+	if ok, err := repo.CommitAll("Edit rule:style"); err != nil || !ok {
+		t.Fatalf("CommitAll() = %v, %v", ok, err)
+	}
+	if ok, err := repo.CommitAll("Nothing"); err != nil || ok {
+		t.Fatalf("CommitAll() without changes = %v, %v", ok, err)
+	}
+
+	commits, err := repo.Log("rule/style.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "Edit rule:style" || commits[1].Subject != "Add rule:style" {
+		t.Fatalf("Log() = %+v", commits)
+	}
+	if commits[0].Author != "Test" || commits[0].Date.IsZero() || commits[0].Short == "" {
+		t.Errorf("Log() fields = %+v", commits[0])
+	}
+
+	old, err := repo.Show(commits[1].Short, "rule/style.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "v1\n" {
+		t.Errorf("Show() = %q, want %q", old, "v1\n")
+	}
+	if _, err := repo.Show("HEAD", "rule/missing.md"); err == nil {
+		t.Error("Show() of a missing path should fail")
+	}
+}
+
+func TestCommitAllStaysInDir(t *testing.T) {
+	setupGit(t)
+	top := t.TempDir()
+	if err := Open(top).Init(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(top, "dotfile"), "x\n")
+	writeFile(t, filepath.Join(top, "agmd", "rule", "a.md"), "a\n")
+
+	repo := Open(filepath.Join(top, "agmd"))
+	if ok, err := repo.CommitAll("Add rule:a"); err != nil || !ok {
+		t.Fatalf("CommitAll() = %v, %v", ok, err)
+	}
+
+	status, err := Open(top).Run("status", "--porcelain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "?? dotfile" {
+		t.Errorf("files outside the registry were committed; status = %q", status)
+	}
+}
+
+func TestCloneAndPullFromBareRepo(t *testing.T) {
+	setupGit(t)
+	bare := filepath.Join(t.TempDir(), "registry.git")
+	if _, err := (&Repo{}).Run("init", "--quiet", "--bare", bare); err != nil {
+		t.Fatal(err)
+	}
+
+	first := t.TempDir()
+	repo := Open(first)
+	if err := repo.Init(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(first, "rule", "a.md"), "a\n")
+	if _, err := repo.CommitAll("Add rule:a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Run("remote", "add", "origin", bare); err != nil {
+		t.Fatal(err)
+	}
+	if repo.HasUpstream() {
+		t.Fatal("HasUpstream() = true before the first push")
+	}
+	if _, err := repo.Run("push", "--quiet", "--set-upstream", "origin", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.HasUpstream() {
+		t.Fatal("HasUpstream() = false after push --set-upstream")
+	}
+
+	second := filepath.Join(t.TempDir(), "clone")
+	if err := Clone("file://"+bare, second); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(second, "rule", "a.md"))
+	if err != nil || string(data) != "a\n" {
+		t.Fatalf("clone content = %q, %v", data, err)
+	}
+
+	writeFile(t, filepath.Join(first, "rule", "b.md"), "b\n")
+	if _, err := repo.CommitAll("Add rule:b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Run("push", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(second).Run("pull", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(second, "rule", "b.md")); err != nil {
+		t.Errorf("pull did not bring rule:b: %v", err)
+	}
+}
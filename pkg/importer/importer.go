@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"agmd/pkg/parser"
 )
 
 // ImportedItem represents a rule/workflow/guideline extracted from AGENTS.md
@@ -11,6 +13,9 @@ type ImportedItem struct {
 	Type    string // "rule", "workflow", "guideline"
 	Name    string
 	Content string // Full markdown content
+	// Region the item was read from in output with provenance markers (nil
+	// when located by headings); its content is still expanded
+	Region *parser.Region
 }
 
 // DirectivesSection represents a section in directives.md
@@ -26,6 +31,14 @@ type DirectivesSection struct {
 func MatchDirectivesWithAgents(directivesContent, agentsContent string) (map[string][]ImportedItem, []string, error) {
 	var warnings []string
 
+	// Output generated with provenance markers records exact item boundaries
+	regions, err := parser.ParseRegions(agentsContent)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("ignoring provenance markers: %v", err))
+	} else if len(regions) > 0 {
+		return itemsFromRegions(regions), warnings, nil
+	}
+
 	// Step 1: Parse directives.md structure to understand document layout
 	sections, err := parseDirectivesStructure(directivesContent)
 	if err != nil {
@@ -41,6 +54,27 @@ func MatchDirectivesWithAgents(directivesContent, agentsContent string) (map[str
 	return result, warnings, nil
 }
 
+// itemsFromRegions extracts every registry item marked in generated output.
+// Items included inside other items are collected on their own and replaced
+// by their directive in the enclosing item. Project files and partial
+// (#anchor) includes are not registry items and are skipped.
+func itemsFromRegions(regions []*parser.Region) map[string][]ImportedItem {
+	result := make(map[string][]ImportedItem)
+	for _, region := range parser.AllRegions(regions) {
+		// Project files, sections and items of read-only sources are not collected
+		if region.Type == "file" || strings.Contains(region.Name, "#") || strings.Contains(region.Type, "/") {
+			continue
+		}
+		result[region.Type] = append(result[region.Type], ImportedItem{
+			Type:    region.Type,
+			Name:    region.Name,
+			Content: strings.TrimSpace(region.Source()),
+			Region:  region,
+		})
+	}
+	return result
+}
+
 // parseDirectivesStructure extracts the document structure including section headers
 // and what items they contain
 func parseDirectivesStructure(content string) ([]DirectivesSection, error) {
@@ -48,8 +82,8 @@ func parseDirectivesStructure(content string) ([]DirectivesSection, error) {
 
 	lines := strings.Split(content, "\n")
 	h2Re := regexp.MustCompile(`^## (.+)$`)
-	listRe := regexp.MustCompile(`^:::list\s+([a-z0-9-]+)\s*$`)
-	includeRe := regexp.MustCompile(`^:::include\s+([a-z0-9-]+):([a-z0-9/_-]+)\s*$`)
+	listRe := regexp.MustCompile(`^:::list\s+([a-z0-9-]+)(?:\s+.*)?$`)
+	includeRe := regexp.MustCompile(`^:::include\s+([a-z0-9-]+):([a-z0-9/_-]+)(?:\s+.*)?$`)
 	endRe := regexp.MustCompile(`^:::end\s*$`)
 
 	var currentSection *DirectivesSection
@@ -172,6 +172,45 @@ func TestContentBoundaryDetection(t *testing.T) {
 	t.Logf("TypeScript rule content:\n%s\n", typescriptRule.Content)
 }
 
+func TestMatchWithProvenanceMarkers(t *testing.T) {
+	directives := "# Project\n\n## Go\n\n:::include bundle:go\n"
+	agents := `# Project
+
+## Go
+
+<!-- agmd:begin bundle:go sha256=0 -->
+### Go
+
+<!-- agmd:begin rule:errors sha256=0 -->
+Wrap errors.
+<!-- agmd:end -->
+
+Keep it simple.
+<!-- agmd:end -->
+
+<!-- agmd:begin file:docs/notes.md sha256=0 -->
+Notes.
+<!-- agmd:end -->
+`
+
+	result, _, err := MatchDirectivesWithAgents(directives, agents)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	bundle := findItem(result["bundle"], "go")
+	if bundle == nil || bundle.Content != "### Go\n\n:::include rule:errors\n\nKeep it simple." {
+		t.Errorf("Unexpected bundle:go item: %+v", bundle)
+	}
+	rule := findItem(result["rule"], "errors")
+	if rule == nil || rule.Content != "Wrap errors." {
+		t.Errorf("Unexpected rule:errors item: %+v", rule)
+	}
+	if len(result["file"]) != 0 {
+		t.Errorf("Project files should not be collected: %+v", result["file"])
+	}
+}
+
 func TestParseDirectivesStructure(t *testing.T) {
 	content := `# Project Directives
 
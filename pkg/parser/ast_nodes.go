@@ -1,15 +1,21 @@
 package parser
 
 import (
+	"slices"
+
 	"github.com/yuin/goldmark/ast"
 )
 
 // ListBlock represents :::list TYPE ... :::end or :::include:TYPE name
 type ListBlock struct {
 	ast.BaseBlock
-	ItemType     string   // "rules", "workflows", "guidelines"
-	Names        []string // Item names to load
-	IsSingleItem bool     // True for :::include (no :::end needed)
+	ItemType      string            // "rules", "workflows", "guidelines"
+	Names         []string          // Item names to load
+	NamePositions []Position        // Source position of each name, parallel to Names
+	Params        map[string]string // key=value arguments given after the reference
+	HeadingLevel  int               // level=N: level of the items' top heading (0 = automatic)
+	Flatten       bool              // flatten: render the items' headings as bold text
+	IsSingleItem  bool              // True for :::include (no :::end needed)
 }
 
 // KindListBlock is the kind of ListBlock
@@ -28,8 +34,42 @@ func (n *ListBlock) Dump(source []byte, level int) {
 // NewListBlock creates a new ListBlock
 func NewListBlock(itemType string) *ListBlock {
 	return &ListBlock{
-		ItemType: itemType,
-		Names:    []string{},
+		ItemType:      itemType,
+		Names:         []string{},
+		NamePositions: []Position{},
+		Params:        map[string]string{},
+	}
+}
+
+// FileBlock represents :::file PATH[#ANCHOR], which inlines a project file
+type FileBlock struct {
+	ast.BaseBlock
+	Path         string            // Project-relative path
+	Anchor       string            // Heading subtree to include ("" = whole file)
+	Pos          Position          // Source position of the path
+	Params       map[string]string // lines=, lang=, level=, ...
+	HeadingLevel int               // level=N: level of the file's top heading (0 = automatic)
+	Flatten      bool              // flatten: render the file's headings as bold text
+}
+
+// KindFileBlock is the kind of FileBlock
+var KindFileBlock = ast.NewNodeKind("FileBlock")
+
+// Kind implements ast.Node
+func (n *FileBlock) Kind() ast.NodeKind {
+	return KindFileBlock
+}
+
+// Dump implements ast.Node
+func (n *FileBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Path": n.Path}, nil)
+}
+
+// NewFileBlock creates a new FileBlock
+func NewFileBlock(path string) *FileBlock {
+	return &FileBlock{
+		Path:   path,
+		Params: map[string]string{},
 	}
 }
 
@@ -60,3 +100,142 @@ func NewNewItemBlock(itemType, name string) *NewItemBlock {
 		Name:     name,
 	}
 }
+
+// IncludedItem holds the parsed content of one registry item inside a ListBlock,
+// or of a project file inside a FileBlock
+type IncludedItem struct {
+	ast.BaseBlock
+	ItemType     string
+	Name         string
+	Params       map[string]string // Directive arguments the item was expanded with
+	Source       []byte            // Item markdown that the child nodes' segments point into
+	HeadingLevel int               // Requested level of the top heading (0 = automatic)
+	Flatten      bool              // Render headings as bold text instead
+}
+
+// KindIncludedItem is the kind of IncludedItem
+var KindIncludedItem = ast.NewNodeKind("IncludedItem")
+
+// Kind implements ast.Node
+func (n *IncludedItem) Kind() ast.NodeKind {
+	return KindIncludedItem
+}
+
+// Dump implements ast.Node
+func (n *IncludedItem) Dump(source []byte, level int) {
+	ast.DumpHelper(n, n.Source, level, map[string]string{"Item": n.ItemType + ":" + n.Name}, nil)
+}
+
+// NewIncludedItem creates a new IncludedItem
+func NewIncludedItem(itemType, name string, source []byte) *IncludedItem {
+	return &IncludedItem{
+		ItemType: itemType,
+		Name:     name,
+		Source:   source,
+	}
+}
+
+// Condition is one test of a :::if directive, e.g. target=claude or env!=ci
+type Condition struct {
+	Key    string
+	Values []string // Accepted values; empty means the key must be truthy
+	Negate bool     // True for key!=value
+}
+
+// Matches evaluates the condition against a set of variables
+func (c Condition) Matches(vars map[string]string) bool {
+	value, ok := vars[c.Key]
+	var result bool
+	if len(c.Values) == 0 {
+		result = ok && value != "" && value != "false" && value != "0"
+	} else {
+		result = ok && slices.Contains(c.Values, value)
+	}
+	return result != c.Negate
+}
+
+// ConditionalBlock represents :::if CONDITIONS ... [:::else ...] :::end
+type ConditionalBlock struct {
+	ast.BaseBlock
+	Conditions []Condition // All must match for the first branch to be taken
+}
+
+// KindConditionalBlock is the kind of ConditionalBlock
+var KindConditionalBlock = ast.NewNodeKind("ConditionalBlock")
+
+// Kind implements ast.Node
+func (n *ConditionalBlock) Kind() ast.NodeKind {
+	return KindConditionalBlock
+}
+
+// Dump implements ast.Node
+func (n *ConditionalBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// NewConditionalBlock creates a new ConditionalBlock
+func NewConditionalBlock(conditions []Condition) *ConditionalBlock {
+	return &ConditionalBlock{
+		Conditions: conditions,
+	}
+}
+
+// Evaluate reports whether every condition matches vars
+func (n *ConditionalBlock) Evaluate(vars map[string]string) bool {
+	for _, cond := range n.Conditions {
+		if !cond.Matches(vars) {
+			return false
+		}
+	}
+	return true
+}
+
+// ElseMarker represents the :::else line inside a ConditionalBlock
+type ElseMarker struct {
+	ast.BaseBlock
+}
+
+// KindElseMarker is the kind of ElseMarker
+var KindElseMarker = ast.NewNodeKind("ElseMarker")
+
+// Kind implements ast.Node
+func (n *ElseMarker) Kind() ast.NodeKind {
+	return KindElseMarker
+}
+
+// Dump implements ast.Node
+func (n *ElseMarker) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// NewElseMarker creates a new ElseMarker
+func NewElseMarker() *ElseMarker {
+	return &ElseMarker{}
+}
+
+// LinkReferenceDefinitions holds the lines of link reference definitions
+// ([x]: https://example.com), which goldmark drops from the document once it
+// has recorded them, so they can be written back
+type LinkReferenceDefinitions struct {
+	ast.BaseBlock
+	// Tight is set when paragraph text follows on the next line
+	Tight bool
+}
+
+// KindLinkReferenceDefinitions is the kind of LinkReferenceDefinitions
+var KindLinkReferenceDefinitions = ast.NewNodeKind("LinkReferenceDefinitions")
+
+// Kind implements ast.Node
+func (n *LinkReferenceDefinitions) Kind() ast.NodeKind {
+	return KindLinkReferenceDefinitions
+}
+
+// Dump implements ast.Node
+func (n *LinkReferenceDefinitions) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// NewLinkReferenceDefinitions creates a new LinkReferenceDefinitions node
+func NewLinkReferenceDefinitions(tight bool) *LinkReferenceDefinitions {
+	return &LinkReferenceDefinitions{Tight: tight}
+}
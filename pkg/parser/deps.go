@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+
+	"agmd/pkg/registry"
+)
+
+// DependencyPolicy says what expansion does with the requires: of the items
+// it includes
+type DependencyPolicy string
+
+const (
+	// DependenciesInclude adds required items to the document, before the
+	// items that need them (the default)
+	DependenciesInclude DependencyPolicy = "include"
+	// DependenciesWarn only warns about required items the document lacks
+	DependenciesWarn DependencyPolicy = "warn"
+)
+
+// ParseDependencyPolicy validates a policy name; "" is DependenciesInclude
+func ParseDependencyPolicy(name string) (DependencyPolicy, error) {
+	switch policy := DependencyPolicy(name); policy {
+	case "":
+		return DependenciesInclude, nil
+	case DependenciesInclude, DependenciesWarn:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid dependency policy %q (expected %s or %s)", name, DependenciesInclude, DependenciesWarn)
+}
+
+// DependencyError reports a requires: or conflicts_with: rule that the items
+// of a document break
+type DependencyError struct {
+	Item     string // TYPE:NAME whose frontmatter declares the rule
+	Other    string // TYPE:NAME it requires or conflicts with
+	Conflict bool   // Both are included although Item conflicts with Other
+}
+
+// Error implements error
+func (e *DependencyError) Error() string {
+	if e.Conflict {
+		return fmt.Sprintf("%s conflicts with %s, but both are included", e.Item, e.Other)
+	}
+	return fmt.Sprintf("%s requires %s, which is not in the registry", e.Item, e.Other)
+}
+
+// checkDependencies checks the requires: and conflicts_with: of the items
+// in an expanded document. Cycles, conflicts and requirements missing from
+// the registry are errors; with DependenciesWarn, requirements that are in
+// the registry but not in the document are warnings.
+func checkDependencies(items []ResolvedItem, opts Options) ([]error, []Diagnostic) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	refs := make([]string, len(items))
+	for i, item := range items {
+		refs[i] = item.Ref()
+	}
+
+	reg := &registry.Registry{BasePath: opts.RegistryPath, Layers: opts.Layers}
+	deps, err := reg.ResolveDependencies(refs...)
+	if err != nil {
+		return []error{err}, nil
+	}
+
+	var errs []error
+	var warnings []Diagnostic
+	for _, ref := range refs {
+		for _, required := range deps.Requires[ref] {
+			switch {
+			case slices.Contains(refs, required):
+			case slices.Contains(deps.Missing, required):
+				errs = append(errs, &DependencyError{Item: ref, Other: required})
+			default:
+				warnings = append(warnings, Diagnostic{
+					File:     opts.Filename,
+					Severity: SeverityWarning,
+					Code:     CodeMissingRequire,
+					Message:  fmt.Sprintf("%s requires %s, which is not included", ref, required),
+				})
+			}
+		}
+		for _, conflict := range deps.Conflicts[ref] {
+			if slices.Contains(refs, conflict) {
+				errs = append(errs, &DependencyError{Item: ref, Other: conflict, Conflict: true})
+			}
+		}
+	}
+	return errs, warnings
+}
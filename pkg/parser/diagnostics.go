@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"agmd/pkg/registry"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// Severity is the importance of a diagnostic
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic codes
+const (
+	CodeIncludeSyntax     = "include-syntax"     // :::include without TYPE:NAME
+	CodeListSyntax        = "list-syntax"        // :::list without TYPE
+	CodeNewSyntax         = "new-syntax"         // :::new without TYPE:NAME
+	CodeIfSyntax          = "if-syntax"          // :::if without conditions
+	CodeFileSyntax        = "file-syntax"        // :::file without a path
+	CodeUnknownDirective  = "unknown-directive"  // :::verb that agmd does not know
+	CodeUnterminatedBlock = "unterminated-block" // :::list, :::new or :::if without :::end
+	CodeUnmatchedEnd      = "unmatched-end"      // :::end or :::else outside a block
+	CodeListEntry         = "list-entry"         // Directive inside a :::list block
+	CodeInvalidOption     = "invalid-option"     // Bad level= value
+	CodeUnresolvedRef     = "unresolved-ref"     // Reference missing from the registry
+	CodeIncludeCycle      = "include-cycle"
+	CodeIncludeDepth      = "include-depth"
+	CodeMissingParam      = "missing-param"
+	CodeFileError         = "file-error"   // :::file that cannot be read
+	CodeInvalidMeta       = "invalid-meta" // Registry item with malformed frontmatter
+	CodeRequireCycle      = "require-cycle"
+	CodeMissingRequire    = "missing-require" // Item whose requires: are not all included
+	CodeConflict          = "conflict"        // Items included together despite conflicts_with:
+	CodeExpandError       = "expand-error"
+)
+
+// Diagnostic is a problem found in a directives file or registry item
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Pos      Position `json:"position"` // Line 0 when the problem has no single position
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+// String formats the diagnostic compiler-style: file:line:col: severity: message [code]
+func (d Diagnostic) String() string {
+	location := d.File
+	if d.Pos.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", d.File, d.Pos.Line, d.Pos.Column)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", location, d.Severity, d.Message, d.Code)
+}
+
+var diagnosticsKey = parser.NewContextKey()
+
+// addDiagnostic records a syntax diagnostic in the parser context
+func addDiagnostic(pc parser.Context, d Diagnostic) {
+	diags, _ := pc.Get(diagnosticsKey).([]Diagnostic)
+	if slices.Contains(diags, d) {
+		// Goldmark may offer the same line to the parser more than once
+		return
+	}
+	pc.Set(diagnosticsKey, append(diags, d))
+}
+
+// Diagnostics returns the syntax diagnostics recorded while parsing
+func Diagnostics(pc parser.Context) []Diagnostic {
+	diags, _ := pc.Get(diagnosticsKey).([]Diagnostic)
+	return diags
+}
+
+// knownDirectives are the verbs that may follow :::
+var knownDirectives = []string{"include", "list", "new", "if", "else", "end", "file"}
+
+var directiveVerbRe = regexp.MustCompile(`^:::([A-Za-z][A-Za-z0-9_-]*)`)
+
+// diagnoseDirectiveLine explains why a line starting with ::: was not
+// recognised as a directive. Lines like "::: note" (no verb) are left alone.
+func diagnoseDirectiveLine(line []byte, pos Position, pc parser.Context) {
+	match := directiveVerbRe.FindSubmatch(line)
+	if match == nil {
+		return
+	}
+	verb := string(match[1])
+	rest := strings.TrimSpace(string(line[len(match[0]):]))
+
+	d := Diagnostic{Pos: pos, Severity: SeverityError}
+	switch verb {
+	case "include":
+		d.Code = CodeIncludeSyntax
+		d.Message = fmt.Sprintf("invalid reference %q: expected :::include TYPE:NAME", firstField(rest))
+		if rest == "" {
+			d.Message = "missing reference: expected :::include TYPE:NAME"
+		}
+	case "list":
+		d.Code = CodeListSyntax
+		d.Message = fmt.Sprintf("invalid item type %q: expected :::list TYPE", firstField(rest))
+		if rest == "" {
+			d.Message = "missing item type: expected :::list TYPE"
+		}
+	case "new":
+		d.Code = CodeNewSyntax
+		d.Message = "expected :::new TYPE:NAME"
+	case "if":
+		d.Code = CodeIfSyntax
+		d.Message = "missing conditions: expected :::if key=value"
+	case "file":
+		d.Code = CodeFileSyntax
+		d.Message = "missing path: expected :::file PATH"
+	case "else":
+		d.Code = CodeUnmatchedEnd
+		d.Message = ":::else outside a :::if block"
+	case "end":
+		d.Code = CodeUnmatchedEnd
+		d.Message = ":::end without an open :::list, :::new or :::if block"
+	default:
+		d.Code = CodeUnknownDirective
+		d.Message = fmt.Sprintf("unknown directive :::%s", verb)
+		if suggestion := closestDirective(verb); suggestion != "" {
+			d.Message += fmt.Sprintf(" (did you mean :::%s?)", suggestion)
+		}
+	}
+	addDiagnostic(pc, d)
+}
+
+// firstField returns the first whitespace-separated word of s
+func firstField(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// closestDirective returns the known verb within two edits of verb, if any
+func closestDirective(verb string) string {
+	best, bestDistance := "", 3
+	for _, known := range knownDirectives {
+		if d := editDistance(strings.ToLower(verb), known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+// errorDiagnostic converts an expansion error into a diagnostic; errors
+// without a position of their own are reported against file
+func errorDiagnostic(err error, file string) Diagnostic {
+	d := Diagnostic{File: file, Severity: SeverityError, Code: CodeExpandError, Message: err.Error()}
+
+	var (
+		cycle   *CycleError
+		depth   *DepthError
+		param   *ParamError
+		fileErr *FileError
+		metaErr *registry.MetaError
+		require *registry.RequireCycleError
+		dep     *DependencyError
+	)
+	switch {
+	case errors.As(err, &cycle):
+		d.Code = CodeIncludeCycle
+	case errors.As(err, &depth):
+		d.Code = CodeIncludeDepth
+	case errors.As(err, &param):
+		d.File, d.Pos = param.File, param.Pos
+		d.Code = CodeMissingParam
+		d.Message = fmt.Sprintf("%s: missing required parameter %q", param.Item, param.Param)
+	case errors.As(err, &fileErr):
+		d.File, d.Pos = fileErr.File, fileErr.Pos
+		d.Code = CodeFileError
+		d.Message = fmt.Sprintf(":::file %s: %v", fileErr.Path, fileErr.Err)
+	case errors.As(err, &metaErr):
+		d.File = metaErr.Path
+		d.Code = CodeInvalidMeta
+		d.Message = "invalid frontmatter: " + strings.Join(metaErr.Problems, "; ")
+	case errors.As(err, &require):
+		d.Code = CodeRequireCycle
+	case errors.As(err, &dep) && dep.Conflict:
+		d.Code = CodeConflict
+	case errors.As(err, &dep):
+		d.Code = CodeMissingRequire
+	}
+	return d
+}
@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDiagnostics(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "go", "# Go\n\n:::inclde rule:errors\n")
+
+	input := []byte(`# Project
+
+:::include rule
+:::list
+:::inclde rule:go
+:::include rule:go level=9
+:::end
+
+:::list rule
+go
+:::include rule:go
+missing
+`)
+
+	diags := Check(input, Options{RegistryPath: registryPath, Filename: "directives.md", LineOffset: 2})
+
+	itemPath := filepath.Join(registryPath, "rule", "go.md")
+	want := []Diagnostic{
+		{File: "directives.md", Pos: Position{Line: 5, Column: 1}, Severity: SeverityError, Code: CodeIncludeSyntax, Message: `invalid reference "rule": expected :::include TYPE:NAME`},
+		{File: "directives.md", Pos: Position{Line: 6, Column: 1}, Severity: SeverityError, Code: CodeListSyntax, Message: "missing item type: expected :::list TYPE"},
+		{File: "directives.md", Pos: Position{Line: 7, Column: 1}, Severity: SeverityError, Code: CodeUnknownDirective, Message: "unknown directive :::inclde (did you mean :::include?)"},
+		{File: "directives.md", Pos: Position{Line: 8, Column: 1}, Severity: SeverityWarning, Code: CodeInvalidOption, Message: "level=9 ignored (expected 1-6)"},
+		{File: "directives.md", Pos: Position{Line: 9, Column: 1}, Severity: SeverityError, Code: CodeUnmatchedEnd, Message: ":::end without an open :::list, :::new or :::if block"},
+		{File: "directives.md", Pos: Position{Line: 11, Column: 1}, Severity: SeverityError, Code: CodeUnterminatedBlock, Message: ":::list rule is never closed with :::end"},
+		{File: "directives.md", Pos: Position{Line: 13, Column: 1}, Severity: SeverityError, Code: CodeListEntry, Message: `directive ":::include rule:go" inside :::list rule (expected item names or :::end)`},
+		{File: "directives.md", Pos: Position{Line: 14, Column: 1}, Severity: SeverityError, Code: CodeUnresolvedRef, Message: "rule:missing not found in registry"},
+		{File: itemPath, Pos: Position{Line: 3, Column: 1}, Severity: SeverityError, Code: CodeUnknownDirective, Message: "unknown directive :::inclde (did you mean :::include?)"},
+	}
+
+	if len(diags) != len(want) {
+		for _, d := range diags {
+			t.Log(d)
+		}
+		t.Fatalf("Expected %d diagnostics, got %d", len(want), len(diags))
+	}
+	for i := range want {
+		if diags[i] != want[i] {
+			t.Errorf("Diagnostic %d:\n  want %s\n  got  %s", i, want[i], diags[i])
+		}
+	}
+}
+
+func TestCheckClean(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "go", "Use gofmt.\n")
+
+	input := []byte("# Project\n\n::: note\nNot a directive.\n\n:::list rule\ngo\n:::end\n\n```\n:::inclde inside code\n```\n")
+	if diags := Check(input, Options{RegistryPath: registryPath}); len(diags) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", diags)
+	}
+}
+
+func TestCheckInvalidMeta(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "go", "---\nversion: latest\n---\nUse gofmt.\n")
+	writeRegistryItem(t, registryPath, "rule", "style", "Use tabs.\n")
+
+	for _, input := range []string{":::include rule:go\n", ":::list rule\n*\n:::end\n"} {
+		diags := Check([]byte(input), Options{RegistryPath: registryPath})
+		want := Diagnostic{
+			File:     filepath.Join(registryPath, "rule", "go.md"),
+			Severity: SeverityError,
+			Code:     CodeInvalidMeta,
+			Message:  `invalid frontmatter: version: "latest" is not a version like 1.2.0`,
+		}
+		if len(diags) != 1 || diags[0] != want {
+			t.Errorf("Check(%q) = %v, want [%s]", input, diags, want)
+		}
+	}
+}
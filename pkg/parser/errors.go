@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// Position is a 1-based line and column in the parsed document
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// UnresolvedRef is a directive reference that could not be found in the registry
+type UnresolvedRef struct {
+	Type string
+	Name string
+	File string // File containing the directive ("" for the top-level input)
+	Pos  Position
+}
+
+// String formats the reference as type:name
+func (r UnresolvedRef) String() string {
+	return r.Type + ":" + r.Name
+}
+
+// UnresolvedError reports every unresolved reference found during expansion
+type UnresolvedError struct {
+	Refs []UnresolvedRef
+}
+
+// Error implements error with one line per unresolved reference
+func (e *UnresolvedError) Error() string {
+	var b strings.Builder
+	if len(e.Refs) == 1 {
+		b.WriteString("1 unresolved reference:")
+	} else {
+		fmt.Fprintf(&b, "%d unresolved references:", len(e.Refs))
+	}
+	for _, ref := range e.Refs {
+		fmt.Fprintf(&b, "\n  %s:%d:%d: %s not found in registry", ref.File, ref.Pos.Line, ref.Pos.Column, ref)
+	}
+	return b.String()
+}
+
+// CycleError reports an item that (transitively) includes itself
+type CycleError struct {
+	Chain []string // type:name of each item, ending with the repeated one
+}
+
+// Error implements error
+func (e *CycleError) Error() string {
+	return "include cycle: " + strings.Join(e.Chain, " → ")
+}
+
+// DepthError reports an include chain nested deeper than the configured maximum
+type DepthError struct {
+	Chain    []string // type:name of each item, ending with the one not expanded
+	MaxDepth int
+}
+
+// Error implements error
+func (e *DepthError) Error() string {
+	return fmt.Sprintf("include depth exceeds %d: %s", e.MaxDepth, strings.Join(e.Chain, " → "))
+}
+
+// ParamError reports a required item parameter that the directive did not supply
+type ParamError struct {
+	Item  string // type:name of the included item
+	Param string
+	File  string // File containing the directive
+	Pos   Position
+}
+
+// Error implements error
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s: missing required parameter %q", e.File, e.Pos.Line, e.Pos.Column, e.Item, e.Param)
+}
+
+// locate sets the file of an error raised in the top-level input or an item
+func (e *ParamError) locate(file string, lineOffset int) {
+	if e.File == "" {
+		e.File = file
+		e.Pos.Line += lineOffset
+	}
+}
+
+// FileError reports a :::file directive whose file cannot be included
+type FileError struct {
+	Path string // Path as written in the directive
+	File string // File containing the directive
+	Pos  Position
+	Err  error
+}
+
+// Error implements error
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: :::file %s: %v", e.File, e.Pos.Line, e.Pos.Column, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// locate sets the file of an error raised in the top-level input or an item
+func (e *FileError) locate(file string, lineOffset int) {
+	if e.File == "" {
+		e.File = file
+		e.Pos.Line += lineOffset
+	}
+}
+
+// locatedError is an expansion error that points at a directive position
+type locatedError interface {
+	error
+	locate(file string, lineOffset int)
+}
+
+var (
+	unresolvedKey   = parser.NewContextKey()
+	expandErrorsKey = parser.NewContextKey()
+)
+
+// addUnresolved records an unresolved reference in the parser context
+func addUnresolved(pc parser.Context, ref UnresolvedRef) {
+	refs, _ := pc.Get(unresolvedKey).([]UnresolvedRef)
+	pc.Set(unresolvedKey, append(refs, ref))
+}
+
+// UnresolvedRefs returns the references the transformer could not resolve
+func UnresolvedRefs(pc parser.Context) []UnresolvedRef {
+	refs, _ := pc.Get(unresolvedKey).([]UnresolvedRef)
+	return refs
+}
+
+// addExpandError records a non-recoverable expansion error in the parser context
+func addExpandError(pc parser.Context, err error) {
+	errs, _ := pc.Get(expandErrorsKey).([]error)
+	pc.Set(expandErrorsKey, append(errs, err))
+}
+
+// ExpandErrors returns the errors (cycles, depth limits) hit during expansion
+func ExpandErrors(pc parser.Context) []error {
+	errs, _ := pc.Get(expandErrorsKey).([]error)
+	return errs
+}
+
+// positionOf converts a byte offset in source into a line and column
+func positionOf(source []byte, offset int) Position {
+	pos := Position{Line: 1, Column: 1}
+	for i := 0; i < offset && i < len(source); i++ {
+		if source[i] == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
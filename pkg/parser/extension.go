@@ -2,13 +2,24 @@ package parser
 
 import (
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
 )
 
+// DefaultMaxDepth is the include depth used when none is configured
+const DefaultMaxDepth = 10
+
 // DirectiveExtension is a Goldmark extension for directive parsing
 type DirectiveExtension struct {
 	RegistryPath string
+	Layers       []string          // Registry layers searched in order (default: RegistryPath)
+	MaxDepth     int               // Maximum include nesting (0 = DefaultMaxDepth)
+	Vars         map[string]string // Project-wide values for {{placeholders}} and :::if
+	Target       string            // Output target that :::if target=... is tested against
+	ProjectRoot  string            // Directory :::file paths are resolved against
+	Dependencies DependencyPolicy  // What to do with the requires: of included items
 }
 
 // NewDirectiveExtension creates a new directive extension
@@ -20,12 +31,75 @@ func NewDirectiveExtension(registryPath string) *DirectiveExtension {
 
 // Extend extends the Goldmark parser with directive support
 func (e *DirectiveExtension) Extend(m goldmark.Markdown) {
+	transformer := &DirectiveTransformer{
+		RegistryPath: e.RegistryPath,
+		Layers:       e.Layers,
+		MaxDepth:     e.MaxDepth,
+		Vars:         e.Vars,
+		Target:       e.Target,
+		ProjectRoot:  e.ProjectRoot,
+		Dependencies: e.Dependencies,
+	}
 	m.Parser().AddOptions(
 		parser.WithBlockParsers(
 			util.Prioritized(NewDirectiveParser(), 100),
+			// Ahead of goldmark's own (200)
+			util.Prioritized(thematicBreakParser{parser.NewThematicBreakParser()}, 199),
+		),
+		parser.WithParagraphTransformers(
+			// Ahead of goldmark's own (100), which drops the definitions
+			util.Prioritized(linkReferenceKeeper{}, 99),
 		),
 		parser.WithASTTransformers(
-			util.Prioritized(NewDirectiveTransformer(e.RegistryPath), 100),
+			util.Prioritized(transformer, 100),
 		),
 	)
 }
+
+// linkReferenceKeeper extracts the link reference definitions at the start of
+// a paragraph like goldmark does, and keeps their lines in a
+// LinkReferenceDefinitions node in front of it
+type linkReferenceKeeper struct{}
+
+// Transform implements parser.ParagraphTransformer
+func (linkReferenceKeeper) Transform(node *ast.Paragraph, reader text.Reader, pc parser.Context) {
+	parent, next := node.Parent(), node.NextSibling()
+	orig := append([]text.Segment(nil), node.Lines().Sliced(0, node.Lines().Len())...)
+	parser.LinkReferenceParagraphTransformer.Transform(node, reader, pc)
+	left := node.Lines().Len()
+	if left == len(orig) {
+		return
+	}
+
+	defs := NewLinkReferenceDefinitions(left > 0)
+	defs.SetBlankPreviousLines(node.HasBlankPreviousLines())
+	for _, seg := range orig[:len(orig)-left] {
+		defs.Lines().Append(seg)
+	}
+	if node.Parent() == nil {
+		// Only definitions: goldmark left an empty text block in its place
+		replaced := parent.LastChild()
+		if next != nil {
+			replaced = next.PreviousSibling()
+		}
+		parent.ReplaceChild(parent, replaced, defs)
+		return
+	}
+	parent.InsertBefore(parent, node, defs)
+}
+
+// thematicBreakParser is goldmark's thematic break parser that also keeps the
+// line of the break, so that ***, ___ and - - - are written back as they were
+type thematicBreakParser struct {
+	parser.BlockParser
+}
+
+// Open implements parser.BlockParser
+func (p thematicBreakParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	_, segment := reader.PeekLine()
+	node, state := p.BlockParser.Open(parent, reader, pc)
+	if node != nil {
+		node.Lines().Append(segment)
+	}
+	return node, state
+}
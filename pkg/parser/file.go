@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"agmd/pkg/registry"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// ErrOutsideProject is returned for :::file paths that leave the project root
+var ErrOutsideProject = errors.New("path escapes the project root")
+
+// expandFileBlock inlines the project file referenced by a :::file directive
+func (t *DirectiveTransformer) expandFileBlock(block *FileBlock, pc parser.Context) {
+	state := getIncludeState(pc)
+	ref := "file:" + block.Path
+	chain := append(slices.Clone(state.chain), ref)
+
+	if slices.Contains(state.chain, ref) {
+		addExpandError(pc, &CycleError{Chain: chain})
+		return
+	}
+	if maxDepth := t.maxDepth(); len(chain) > maxDepth {
+		addExpandError(pc, &DepthError{Chain: chain, MaxDepth: maxDepth})
+		return
+	}
+
+	file, err := t.loadProjectFile(block)
+	if err != nil {
+		addExpandError(pc, &FileError{Path: block.Path, Pos: block.Pos, Err: err})
+		return
+	}
+
+	// Files are not deduplicated: each :::file may select a different part
+	name := block.Path
+	if block.Anchor != "" {
+		name += "#" + block.Anchor
+	}
+	item := t.expandItem(pc, "file", name, file, file.Body, &includeState{chain: chain, seen: state.seen})
+	item.Params = block.Params
+	item.HeadingLevel = block.HeadingLevel
+	item.Flatten = block.Flatten
+	block.AppendChild(block, item)
+}
+
+// loadProjectFile reads the file of a :::file directive and selects the part
+// given by its #anchor or lines=START-END, fencing it when lang= is set
+func (t *DirectiveTransformer) loadProjectFile(block *FileBlock) (*itemFile, error) {
+	path, err := resolveProjectPath(t.ProjectRoot, block.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &itemFile{Path: path, Body: data}
+
+	lines, hasLines := block.Params["lines"]
+	switch {
+	case hasLines && block.Anchor != "":
+		return nil, fmt.Errorf("cannot combine #%s with lines=%s", block.Anchor, lines)
+	case hasLines:
+		if err := file.selectLines(lines); err != nil {
+			return nil, err
+		}
+	case block.Anchor != "":
+		if err := file.narrow(block.Anchor); err != nil {
+			return nil, fmt.Errorf("no heading #%s", block.Anchor)
+		}
+	}
+
+	if lang, ok := block.Params["lang"]; ok {
+		file.Body = fenceCode(bytes.TrimRight(file.Body, " \t\r\n"), lang)
+		return file, nil
+	}
+
+	skipped := len(file.Body) - len(bytes.TrimLeft(file.Body, " \t\r\n"))
+	file.LineOffset += bytes.Count(file.Body[:skipped], []byte("\n"))
+	file.Body = bytes.TrimSpace(file.Body)
+	return file, nil
+}
+
+// selectLines restricts the body to a 1-based inclusive range: "10-20",
+// "10-" (to the end) or "10" (a single line)
+func (f *itemFile) selectLines(spec string) error {
+	startText, endText, isRange := strings.Cut(spec, "-")
+	start, err := strconv.Atoi(startText)
+	if err != nil || start < 1 {
+		return fmt.Errorf("invalid lines=%s", spec)
+	}
+
+	lines := strings.SplitAfter(string(f.Body), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	end := start
+	if isRange {
+		end = len(lines)
+		if endText != "" {
+			if end, err = strconv.Atoi(endText); err != nil || end < start {
+				return fmt.Errorf("invalid lines=%s", spec)
+			}
+		}
+	}
+	if start > len(lines) {
+		return fmt.Errorf("lines=%s is past the end of the file (%d lines)", spec, len(lines))
+	}
+	end = min(end, len(lines))
+
+	f.Body = []byte(strings.Join(lines[start-1:end], ""))
+	f.LineOffset += start - 1
+	return nil
+}
+
+// fenceCode wraps content in a fenced code block, using a fence longer than
+// any backtick run inside it
+func fenceCode(content []byte, lang string) []byte {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	var b bytes.Buffer
+	b.WriteString(fence + lang + "\n")
+	b.Write(content)
+	b.WriteString("\n" + fence + "\n")
+	return b.Bytes()
+}
+
+// resolveProjectPath joins a :::file path to the project root, rejecting
+// absolute paths and paths (or symlinks) that lead outside the root
+func resolveProjectPath(root, rel string) (string, error) {
+	if root == "" {
+		return "", errors.New("no project root to resolve against")
+	}
+	if filepath.IsAbs(rel) {
+		return "", ErrOutsideProject
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if _, ok := registry.Within(root, path); !ok {
+		return "", ErrOutsideProject
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := registry.Within(realRoot, realPath); !ok {
+		return "", ErrOutsideProject
+	}
+	return path, nil
+}
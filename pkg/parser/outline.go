@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// Heading is a top-level heading of a markdown document
+type Heading struct {
+	Level int
+	Title string
+	Slug  string // Anchor used by :::include type:name#slug
+	Start int    // Byte offset of the heading's first line
+	End   int    // Byte offset where the heading's subtree ends
+}
+
+// Outline returns the top-level headings of content with their anchors.
+// Slugs follow GitHub's rules, numbering repeated titles (-1, -2, ...).
+func Outline(content []byte) []Heading {
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+	doc := md.Parser().Parse(text.NewReader(content))
+
+	var headings []Heading
+	used := map[string]int{}
+	for c := doc.FirstChild(); c != nil; c = c.NextSibling() {
+		heading, ok := c.(*ast.Heading)
+		if !ok || heading.Lines().Len() == 0 {
+			continue
+		}
+
+		title := plainText(content, heading)
+		slug := Slugify(title)
+		if n, ok := used[slug]; ok {
+			used[slug] = n + 1
+			slug += "-" + strconv.Itoa(n+1)
+		} else {
+			used[slug] = 0
+		}
+
+		headings = append(headings, Heading{
+			Level: heading.Level,
+			Title: title,
+			Slug:  slug,
+			Start: lineStart(content, heading.Lines().At(0).Start),
+			End:   len(content),
+		})
+	}
+
+	// A subtree ends at the next heading of the same or a higher level
+	for i := range headings {
+		for _, next := range headings[i+1:] {
+			if next.Level <= headings[i].Level {
+				headings[i].End = next.Start
+				break
+			}
+		}
+	}
+	return headings
+}
+
+// Section returns the subtree of the heading whose slug matches anchor, and
+// the number of lines preceding it in content
+func Section(content []byte, anchor string) ([]byte, int, bool) {
+	for _, heading := range Outline(content) {
+		if heading.Slug == anchor {
+			section := bytes.TrimSpace(content[heading.Start:heading.End])
+			return section, bytes.Count(content[:heading.Start], []byte("\n")), true
+		}
+	}
+	return nil, 0, false
+}
+
+// Slugify converts a heading title to its anchor: lowercase, punctuation
+// dropped and spaces turned into hyphens
+func Slugify(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// plainText returns the text of an inline container without markup
+func plainText(source []byte, node ast.Node) string {
+	var b strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			seg := n.Segment
+			b.Write(seg.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
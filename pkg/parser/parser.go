@@ -2,7 +2,11 @@ package parser
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
@@ -18,8 +22,35 @@ func NewDirectiveParser() parser.BlockParser {
 	return defaultDirectiveParser
 }
 
+// directiveData tracks the open directive blocks that are closed by :::end
 type directiveData struct {
-	node ast.Node
+	nodes  []ast.Node            // Innermost last
+	opened map[ast.Node]Position // Where each block was opened
+	ended  map[ast.Node]bool     // Blocks closed by their :::end
+}
+
+// push records a block that needs a matching :::end
+func (d *directiveData) push(node ast.Node, pos Position) {
+	d.nodes = append(d.nodes, node)
+	d.opened[node] = pos
+}
+
+// innermost returns the most recently opened block still waiting for :::end
+func (d *directiveData) innermost() ast.Node {
+	if len(d.nodes) == 0 {
+		return nil
+	}
+	return d.nodes[len(d.nodes)-1]
+}
+
+// getDirectiveData returns the open-block stack of a parse
+func getDirectiveData(pc parser.Context) *directiveData {
+	if data, ok := pc.Get(directiveDataKey).(*directiveData); ok {
+		return data
+	}
+	data := &directiveData{opened: map[ast.Node]Position{}, ended: map[ast.Node]bool{}}
+	pc.Set(directiveDataKey, data)
+	return data
 }
 
 var directiveDataKey = parser.NewContextKey()
@@ -36,41 +67,45 @@ func (b *directiveParser) Open(parent ast.Node, reader text.Reader, pc parser.Co
 		return nil, parser.NoChildren
 	}
 
-	// Match :::include TYPE:NAME (treat as having children to force Continue to be called)
-	// Example: :::include rule:typescript
-	includeRe := regexp.MustCompile(`^:::include\s+([a-z0-9-]+):([a-z0-9/_-]+)`)
-	if match := includeRe.FindSubmatch(line); match != nil {
-		itemType := string(match[1]) // "rule", "workflow"
-		name := string(match[2])      // "typescript"
+	// Match :::include [SOURCE/]TYPE:NAME[#ANCHOR] (treat as having children to force Continue to be called)
+	// Example: :::include rule:typescript, :::include guide:handbook#testing, :::include team/rule:security
+	includeRe := regexp.MustCompile(`^:::include\s+((?:[a-z0-9_-]+/)?[a-z0-9-]+):([a-z0-9/_-]+(?:#\S+)?)`)
+	if match := includeRe.FindSubmatchIndex(line); match != nil {
+		itemType := string(line[match[2]:match[3]]) // "rule", "workflow"
+		name := string(line[match[4]:match[5]])     // "typescript"
 
 		// Create a single-item list block
 		node := NewListBlock(itemType)
 		node.Names = []string{name}
+		node.NamePositions = []Position{positionOf(reader.Source(), segment.Start+match[2])}
+		node.Params = parseDirectiveArgs(string(line[match[1]:]))
+		node.HeadingLevel, node.Flatten = takeIncludeOptions(node.Params, positionOf(reader.Source(), segment.Start), pc)
 		node.IsSingleItem = true
 
-		pc.Set(directiveDataKey, &directiveData{node})
-
 		// Advance past the entire line
 		newline := 1
 		if len(line) > 0 && line[len(line)-1] != '\n' {
 			newline = 0
 		}
 		reader.Advance(segment.Stop - segment.Start - newline + segment.Padding)
-		
+
 		// Return NoChildren with Continue - this might help
 		return node, parser.NoChildren | parser.Continue
 	}
 
-	// Match :::list TYPE (multi-line, needs :::end)
-	// Example: :::list rule
-	listRe := regexp.MustCompile(`^:::list\s+([a-z0-9-]+)`)
-	if match := listRe.FindSubmatch(line); match != nil {
-		itemType := string(match[1]) // "rule", "workflow"
+	// Match :::list [SOURCE/]TYPE (multi-line, needs :::end)
+	// Example: :::list rule, :::list team/rule
+	listRe := regexp.MustCompile(`^:::list\s+((?:[a-z0-9_-]+/)?[a-z0-9-]+)`)
+	if match := listRe.FindSubmatchIndex(line); match != nil {
+		itemType := string(line[match[2]:match[3]]) // "rule", "workflow"
 
+		pos := positionOf(reader.Source(), segment.Start)
 		node := NewListBlock(itemType)
+		node.Params = parseDirectiveArgs(string(line[match[1]:]))
+		node.HeadingLevel, node.Flatten = takeIncludeOptions(node.Params, pos, pc)
 		node.IsSingleItem = false
 
-		pc.Set(directiveDataKey, &directiveData{node})
+		getDirectiveData(pc).push(node, pos)
 
 		// Advance past the :::list TYPE line
 		newline := 1
@@ -81,16 +116,37 @@ func (b *directiveParser) Open(parent ast.Node, reader text.Reader, pc parser.Co
 		return node, parser.NoChildren
 	}
 
+	// Match :::file PATH[#ANCHOR] (single line, like :::include)
+	// Example: :::file docs/architecture.md#overview, :::file Makefile lang=make
+	fileRe := regexp.MustCompile(`^:::file\s+(\S+)`)
+	if match := fileRe.FindSubmatchIndex(line); match != nil {
+		path, anchor, _ := strings.Cut(string(line[match[2]:match[3]]), "#")
+
+		node := NewFileBlock(path)
+		node.Anchor = anchor
+		node.Pos = positionOf(reader.Source(), segment.Start+match[2])
+		node.Params = parseDirectiveArgs(string(line[match[1]:]))
+		node.HeadingLevel, node.Flatten = takeIncludeOptions(node.Params, positionOf(reader.Source(), segment.Start), pc)
+
+		// Advance past the entire line
+		newline := 1
+		if len(line) > 0 && line[len(line)-1] != '\n' {
+			newline = 0
+		}
+		reader.Advance(segment.Stop - segment.Start - newline + segment.Padding)
+		return node, parser.NoChildren | parser.Continue
+	}
+
 	// Match :::new TYPE:NAME (inline definition, needs :::end)
 	// Example: :::new rule:my-auth-rule
 	newRe := regexp.MustCompile(`^:::new\s+([a-z0-9-]+):([a-z0-9/_-]+)`)
 	if match := newRe.FindSubmatch(line); match != nil {
 		itemType := string(match[1]) // "rule", "workflow"
-		name := string(match[2])      // "my-auth-rule"
+		name := string(match[2])     // "my-auth-rule"
 
 		node := NewNewItemBlock(itemType, name)
 
-		pc.Set(directiveDataKey, &directiveData{node})
+		getDirectiveData(pc).push(node, positionOf(reader.Source(), segment.Start))
 
 		// Advance past the :::new:TYPE line
 		newline := 1
@@ -101,6 +157,37 @@ func (b *directiveParser) Open(parent ast.Node, reader text.Reader, pc parser.Co
 		return node, parser.HasChildren
 	}
 
+	// Match :::if CONDITIONS (needs :::end, optional :::else)
+	// Example: :::if target=claude env!=ci
+	ifRe := regexp.MustCompile(`^:::if\s+(\S.*)`)
+	if match := ifRe.FindSubmatch(line); match != nil {
+		node := NewConditionalBlock(parseConditions(string(match[1])))
+
+		getDirectiveData(pc).push(node, positionOf(reader.Source(), segment.Start))
+
+		// Advance past the :::if line
+		newline := 1
+		if len(line) > 0 && line[len(line)-1] != '\n' {
+			newline = 0
+		}
+		reader.Advance(segment.Stop - segment.Start - newline + segment.Padding)
+		return node, parser.HasChildren
+	}
+
+	// Match :::else directly inside a :::if block
+	if bytes.Equal(bytes.TrimSpace(line), []byte(":::else")) {
+		if _, ok := getDirectiveData(pc).innermost().(*ConditionalBlock); ok {
+			newline := 1
+			if len(line) > 0 && line[len(line)-1] != '\n' {
+				newline = 0
+			}
+			reader.Advance(segment.Stop - segment.Start - newline + segment.Padding)
+			return NewElseMarker(), parser.NoChildren | parser.Continue
+		}
+	}
+
+	// Not a valid directive: explain why instead of silently treating it as text
+	diagnoseDirectiveLine(line, positionOf(reader.Source(), segment.Start), pc)
 	return nil, parser.NoChildren
 }
 
@@ -108,13 +195,26 @@ func (b *directiveParser) Continue(node ast.Node, reader text.Reader, pc parser.
 	line, segment := reader.PeekLine()
 	trimmed := bytes.TrimSpace(line)
 
-	// For single-item includes, close immediately
+	// For single-item includes, :::file and :::else markers, close immediately
 	if listBlock, ok := node.(*ListBlock); ok && listBlock.IsSingleItem {
 		return parser.Close
 	}
+	if _, ok := node.(*ElseMarker); ok {
+		return parser.Close
+	}
+	if _, ok := node.(*FileBlock); ok {
+		return parser.Close
+	}
+
+	// A nested directive block owns this line (including its :::end)
+	if getDirectiveData(pc).innermost() != node {
+		return parser.Continue | parser.HasChildren
+	}
 
 	// Check for :::end
 	if bytes.Equal(trimmed, []byte(":::end")) {
+		getDirectiveData(pc).ended[node] = true
+
 		// Advance past the :::end line
 		newline := 1
 		if len(line) > 0 && line[len(line)-1] != '\n' {
@@ -127,8 +227,17 @@ func (b *directiveParser) Continue(node ast.Node, reader text.Reader, pc parser.
 	// Handle ListBlock - collect item names
 	if listBlock, ok := node.(*ListBlock); ok {
 		name := string(trimmed)
-		if name != "" && !bytes.HasPrefix(trimmed, []byte(":::")) {
+		indent := bytes.Index(line, trimmed)
+		if bytes.HasPrefix(trimmed, []byte(":::")) {
+			addDiagnostic(pc, Diagnostic{
+				Pos:      positionOf(reader.Source(), segment.Start+indent),
+				Severity: SeverityError,
+				Code:     CodeListEntry,
+				Message:  fmt.Sprintf("directive %q inside :::list %s (expected item names or :::end)", name, listBlock.ItemType),
+			})
+		} else if name != "" {
 			listBlock.Names = append(listBlock.Names, name)
+			listBlock.NamePositions = append(listBlock.NamePositions, positionOf(reader.Source(), segment.Start+indent))
 		}
 		// Advance to next line
 		newline := 1
@@ -139,17 +248,25 @@ func (b *directiveParser) Continue(node ast.Node, reader text.Reader, pc parser.
 		return parser.Continue | parser.NoChildren
 	}
 
-	// Handle NewItemBlock - let Goldmark parse content as children
+	// Handle NewItemBlock and ConditionalBlock - let Goldmark parse content as children
 	// Don't advance here - let child parsers handle it
 	return parser.Continue | parser.HasChildren
 }
 
 func (b *directiveParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
-	data := pc.Get(directiveDataKey)
-	if data != nil {
-		ddata := data.(*directiveData)
-		if ddata.node == node {
-			pc.Set(directiveDataKey, nil)
+	data := getDirectiveData(pc)
+	if pos, ok := data.opened[node]; ok && !data.ended[node] {
+		addDiagnostic(pc, Diagnostic{
+			Pos:      pos,
+			Severity: SeverityError,
+			Code:     CodeUnterminatedBlock,
+			Message:  fmt.Sprintf("%s is never closed with :::end", blockName(node)),
+		})
+	}
+	for i, open := range data.nodes {
+		if open == node {
+			data.nodes = append(data.nodes[:i], data.nodes[i+1:]...)
+			break
 		}
 	}
 }
@@ -161,3 +278,96 @@ func (b *directiveParser) CanInterruptParagraph() bool {
 func (b *directiveParser) CanAcceptIndentedLine() bool {
 	return false
 }
+
+// parseDirectiveArgs parses the key=value arguments that follow a directive's
+// reference, e.g. `env=staging branch="release 2"`. Bare words map to "".
+func parseDirectiveArgs(rest string) map[string]string {
+	args := map[string]string{}
+
+	var field strings.Builder
+	inQuotes := false
+	flush := func() {
+		if field.Len() > 0 {
+			key, value, _ := strings.Cut(field.String(), "=")
+			args[key] = value
+			field.Reset()
+		}
+	}
+
+	for _, r := range strings.TrimSpace(rest) {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case (r == ' ' || r == '\t') && !inQuotes:
+			flush()
+		default:
+			field.WriteRune(r)
+		}
+	}
+	flush()
+
+	return args
+}
+
+// blockName describes an open directive block for diagnostics
+func blockName(node ast.Node) string {
+	switch n := node.(type) {
+	case *ListBlock:
+		return ":::list " + n.ItemType
+	case *NewItemBlock:
+		return ":::new " + n.ItemType + ":" + n.Name
+	default:
+		return ":::if"
+	}
+}
+
+// takeIncludeOptions removes the reserved level=N and flatten arguments from
+// the directive parameters and returns them
+func takeIncludeOptions(params map[string]string, pos Position, pc parser.Context) (level int, flatten bool) {
+	if value, ok := params["level"]; ok {
+		if n, err := strconv.Atoi(value); err == nil && n >= 1 && n <= 6 {
+			level = n
+		} else {
+			addDiagnostic(pc, Diagnostic{
+				Pos:      pos,
+				Severity: SeverityWarning,
+				Code:     CodeInvalidOption,
+				Message:  fmt.Sprintf("level=%s ignored (expected 1-6)", value),
+			})
+		}
+		delete(params, "level")
+	}
+	if _, ok := params["flatten"]; ok {
+		flatten = true
+		delete(params, "flatten")
+	}
+	return level, flatten
+}
+
+// parseConditions parses the conditions of a :::if line. Each argument is
+// key=value, key!=value (values may be comma-separated alternatives) or a
+// bare key that must be set to a non-empty, non-false value.
+func parseConditions(rest string) []Condition {
+	args := parseDirectiveArgs(rest)
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	conditions := make([]Condition, 0, len(keys))
+	for _, key := range keys {
+		value := args[key]
+		cond := Condition{Key: key}
+		if strings.HasSuffix(key, "!") {
+			cond.Key = strings.TrimSuffix(key, "!")
+			cond.Negate = true
+		}
+		if value != "" {
+			cond.Values = strings.Split(value, ",")
+		}
+		conditions = append(conditions, cond)
+	}
+	return conditions
+}
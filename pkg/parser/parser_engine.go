@@ -2,32 +2,213 @@ package parser
 
 import (
 	"bytes"
+	"errors"
+	"sort"
 
 	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
 )
 
+// Options configures ParseAndExpandWithOptions
+type Options struct {
+	RegistryPath string // Registry root, e.g. ~/.agmd
+	// Layers are the registry directories searched for each item, highest
+	// priority first; when empty only RegistryPath is searched
+	Layers       []string
+	Filename     string // File name used in error reports (default "<input>")
+	LineOffset   int    // Lines removed before input (e.g. stripped frontmatter)
+	AllowMissing bool   // Skip unresolved references instead of failing
+	MaxDepth     int    // Maximum include nesting (0 = DefaultMaxDepth)
+
+	// Vars supplies project-wide values for {{placeholders}} in registry items
+	// and for :::if conditions
+	Vars map[string]string
+
+	// Target is the output being generated (e.g. "agents"), available to
+	// :::if conditions as the "target" variable
+	Target string
+
+	// ProjectRoot is the directory :::file paths are relative to; files
+	// outside it cannot be included
+	ProjectRoot string
+
+	// Provenance wraps each expanded item in <!-- agmd:begin/end --> markers
+	// recording its reference and a hash of its content
+	Provenance bool
+
+	// Dependencies says whether items listed in the requires: of included
+	// items are added to the document or only warned about (default: added)
+	Dependencies DependencyPolicy
+}
+
 // ParseAndExpand reads markdown with directives, expands them from registry, and returns expanded markdown
 func ParseAndExpand(input []byte, registryPath string) ([]byte, error) {
-	// Create Goldmark with GFM + our directive extension
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			NewDirectiveExtension(registryPath),
-		),
-	)
+	return ParseAndExpandWithOptions(input, Options{RegistryPath: registryPath})
+}
 
-	// Parse the markdown
-	reader := text.NewReader(input)
-	doc := md.Parser().Parse(reader)
+// ParseAndExpandWithOptions is ParseAndExpand with control over error reporting.
+// Unless AllowMissing is set, any :::include or :::list reference missing from
+// the registry makes it return an *UnresolvedError listing all of them.
+// Registry items are expanded recursively; include cycles and chains deeper
+// than MaxDepth are returned as *CycleError and *DepthError; broken requires:
+// and conflicts_with: rules as *DependencyError and *registry.RequireCycleError.
+func ParseAndExpandWithOptions(input []byte, opts Options) ([]byte, error) {
+	expansion, err := ExpandDocument(input, opts)
+	if err != nil {
+		return nil, err
+	}
+	return expansion.Output, nil
+}
+
+// ExpandDocument is ParseAndExpandWithOptions that also reports the registry
+// items the output was built from, e.g. to pin them in a lockfile
+func ExpandDocument(input []byte, opts Options) (*Expansion, error) {
+	doc, pc := parse(input, opts)
+
+	if opts.Filename == "" {
+		opts.Filename = "<input>"
+	}
+
+	depErrs, warnings := checkDependencies(ResolvedItems(pc), opts)
+	for _, err := range depErrs {
+		addExpandError(pc, err)
+	}
+
+	if errs := ExpandErrors(pc); len(errs) > 0 {
+		for _, err := range errs {
+			if located, ok := err.(locatedError); ok {
+				located.locate(opts.Filename, opts.LineOffset)
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	if refs := UnresolvedRefs(pc); len(refs) > 0 && !opts.AllowMissing {
+		for i := range refs {
+			if refs[i].File == "" {
+				refs[i].File = opts.Filename
+				refs[i].Pos.Line += opts.LineOffset
+			}
+		}
+		return nil, &UnresolvedError{Refs: refs}
+	}
 
 	// Render back to markdown
 	var buf bytes.Buffer
-	renderer := NewMarkdownRenderer()
+	renderer := &MarkdownRenderer{Provenance: opts.Provenance}
 	if err := renderer.Render(&buf, input, doc); err != nil {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	// Malformed directives were kept as text, which the caller should know
+	for _, d := range syntaxDiagnostics(pc, opts) {
+		d.Severity = SeverityWarning
+		warnings = append(warnings, d)
+	}
+
+	return &Expansion{Output: buf.Bytes(), Items: ResolvedItems(pc), Warnings: warnings}, nil
+}
+
+// syntaxDiagnostics returns the syntax diagnostics recorded while parsing,
+// located in opts.Filename when they were found in the input itself
+func syntaxDiagnostics(pc parser.Context, opts Options) []Diagnostic {
+	var diags []Diagnostic
+	for _, d := range Diagnostics(pc) {
+		if d.File == "" {
+			d.File = opts.Filename
+			d.Pos.Line += opts.LineOffset
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// Check parses and expands input like ParseAndExpandWithOptions, without
+// rendering, and returns every problem found as a diagnostic sorted by
+// position: malformed directives, unresolved references (warnings when
+// AllowMissing is set), include cycles, missing parameters, unreadable files
+// and broken requires: or conflicts_with: rules.
+func Check(input []byte, opts Options) []Diagnostic {
+	_, pc := parse(input, opts)
+
+	if opts.Filename == "" {
+		opts.Filename = "<input>"
+	}
+
+	diags := syntaxDiagnostics(pc, opts)
+
+	severity := SeverityError
+	if opts.AllowMissing {
+		severity = SeverityWarning
+	}
+	for _, ref := range UnresolvedRefs(pc) {
+		if ref.File == "" {
+			ref.File = opts.Filename
+			ref.Pos.Line += opts.LineOffset
+		}
+		diags = append(diags, Diagnostic{
+			File:     ref.File,
+			Pos:      ref.Pos,
+			Severity: severity,
+			Code:     CodeUnresolvedRef,
+			Message:  ref.String() + " not found in registry",
+		})
+	}
+
+	for _, err := range ExpandErrors(pc) {
+		if located, ok := err.(locatedError); ok {
+			located.locate(opts.Filename, opts.LineOffset)
+		}
+		diags = append(diags, errorDiagnostic(err, opts.Filename))
+	}
+
+	depErrs, warnings := checkDependencies(ResolvedItems(pc), opts)
+	for _, err := range depErrs {
+		diags = append(diags, errorDiagnostic(err, opts.Filename))
+	}
+	diags = append(diags, warnings...)
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.File != b.File {
+			// The input file first, then registry items and project files
+			return a.File == opts.Filename || (b.File != opts.Filename && a.File < b.File)
+		}
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line < b.Pos.Line
+		}
+		return a.Pos.Column < b.Pos.Column
+	})
+	return diags
+}
+
+// parse runs input through the directive pipeline, expanding directives
+func parse(input []byte, opts Options) (ast.Node, parser.Context) {
+	// Create Goldmark with GFM + our directive extension
+	md := newMarkdown(&DirectiveExtension{
+		RegistryPath: opts.RegistryPath,
+		Layers:       opts.Layers,
+		MaxDepth:     opts.MaxDepth,
+		Vars:         opts.Vars,
+		Target:       opts.Target,
+		ProjectRoot:  opts.ProjectRoot,
+		Dependencies: opts.Dependencies,
+	})
+
+	pc := parser.NewContext()
+	doc := md.Parser().Parse(text.NewReader(input), parser.WithContext(pc))
+	return doc, pc
+}
+
+// newMarkdown creates the goldmark instance used for directives.md and registry items
+func newMarkdown(ext *DirectiveExtension) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			ext,
+		),
+	)
 }
@@ -0,0 +1,252 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provenance markers wrap each expanded item in generated output:
+//
+//	<!-- agmd:begin rule:typescript env=ci sha256=HEX -->
+//	...item content...
+//	<!-- agmd:end -->
+//
+// The hash covers the text between the markers as it was generated, so a
+// region whose content no longer matches it has been edited by hand.
+const (
+	beginMarkerPrefix = "<!-- agmd:begin "
+	markerSuffix      = " -->"
+	endMarker         = "<!-- agmd:end -->"
+)
+
+// Region is the span of one expanded item in generated output
+type Region struct {
+	Type     string            // Item type, or "file" for :::file
+	Name     string            // Item name or file path, with #anchor for section includes
+	Params   map[string]string // Directive arguments the item was expanded with
+	Hash     string            // sha256 recorded in the begin marker
+	Content  string            // Text between the markers
+	Line     int               // Line of the begin marker (1-based)
+	EndLine  int               // Line of the end marker
+	Children []*Region         // Items expanded inside this one
+
+	lines []string // Content split into lines
+}
+
+// Ref returns the TYPE:NAME reference of the region's item
+func (r *Region) Ref() string {
+	return r.Type + ":" + r.Name
+}
+
+// Edited reports whether the region's content differs from what was generated
+func (r *Region) Edited() bool {
+	return ContentHash(r.Content) != r.Hash
+}
+
+// Directive returns the directive line that expands to this region
+func (r *Region) Directive() string {
+	if r.Type == "file" {
+		return ":::file " + r.Name + formatArgs(r.Params)
+	}
+	return ":::include " + r.Ref() + formatArgs(r.Params)
+}
+
+// Source returns the region's content with each nested region replaced by
+// the directive that produced it, i.e. the item as written in the registry
+// (apart from heading levels and substituted parameters)
+func (r *Region) Source() string {
+	var out []string
+	children := r.Children
+	for i := 0; i < len(r.lines); i++ {
+		line := r.Line + 1 + i
+		if len(children) > 0 && children[0].Line == line {
+			out = append(out, children[0].Directive())
+			i += children[0].EndLine - children[0].Line
+			children = children[1:]
+			continue
+		}
+		out = append(out, r.lines[i])
+	}
+	return strings.Join(out, "\n")
+}
+
+// ContentHash returns the hex sha256 recorded in provenance markers
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// beginMarker returns the marker opening an item's region
+func beginMarker(itemType, name string, params map[string]string, content string) string {
+	return beginMarkerPrefix + itemType + ":" + name + formatArgs(params) + " sha256=" + ContentHash(content) + markerSuffix
+}
+
+// formatArgs renders directive arguments as " key=value ...", sorted by key
+// and quoted where needed so parseDirectiveArgs reads them back
+func formatArgs(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		value := params[key]
+		b.WriteString(" " + key)
+		if value == "" {
+			continue
+		}
+		if strings.ContainsAny(value, " \t") {
+			value = `"` + value + `"`
+		}
+		b.WriteString("=" + value)
+	}
+	return b.String()
+}
+
+// ParseRegions finds the provenance markers in generated output and returns
+// the top-level regions, with nested items as their Children. Output without
+// markers yields no regions; unbalanced markers are an error.
+func ParseRegions(content string) ([]*Region, error) {
+	lines := strings.Split(content, "\n")
+
+	var top []*Region
+	var open []*Region
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, beginMarkerPrefix) && strings.HasSuffix(trimmed, markerSuffix):
+			region, err := parseBeginMarker(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			region.Line = i + 1
+			open = append(open, region)
+
+		case trimmed == endMarker:
+			if len(open) == 0 {
+				return nil, fmt.Errorf("line %d: agmd:end without agmd:begin", i+1)
+			}
+			region := open[len(open)-1]
+			open = open[:len(open)-1]
+			region.EndLine = i + 1
+			region.lines = lines[region.Line:i]
+			region.Content = strings.Join(region.lines, "\n")
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.Children = append(parent.Children, region)
+			} else {
+				top = append(top, region)
+			}
+		}
+	}
+
+	if len(open) > 0 {
+		region := open[len(open)-1]
+		return nil, fmt.Errorf("line %d: agmd:begin %s without agmd:end", region.Line, region.Ref())
+	}
+	return top, nil
+}
+
+// parseBeginMarker reads the reference, arguments and hash of a begin marker
+func parseBeginMarker(marker string) (*Region, error) {
+	body := strings.TrimSuffix(strings.TrimPrefix(marker, beginMarkerPrefix), markerSuffix)
+	ref, rest, _ := strings.Cut(strings.TrimSpace(body), " ")
+
+	itemType, name, ok := strings.Cut(ref, ":")
+	if !ok || itemType == "" || name == "" {
+		return nil, fmt.Errorf("invalid agmd:begin reference %q", ref)
+	}
+
+	params := parseDirectiveArgs(rest)
+	hash := params["sha256"]
+	delete(params, "sha256")
+	if hash == "" {
+		return nil, fmt.Errorf("agmd:begin %s has no sha256", ref)
+	}
+
+	return &Region{Type: itemType, Name: name, Params: params, Hash: hash}, nil
+}
+
+// AllRegions returns regions and all their nested regions in document order
+func AllRegions(regions []*Region) []*Region {
+	var all []*Region
+	for _, region := range regions {
+		all = append(all, region)
+		all = append(all, AllRegions(region.Children)...)
+	}
+	return all
+}
+
+// EditedRegions returns the innermost regions whose content no longer matches
+// their hash. An edit inside a nested item also changes the content of the
+// items around it, so those are only reported when no nested item was edited.
+func EditedRegions(regions []*Region) []*Region {
+	var edited []*Region
+	for _, region := range regions {
+		if !region.Edited() {
+			continue
+		}
+		if nested := EditedRegions(region.Children); len(nested) > 0 {
+			edited = append(edited, nested...)
+		} else {
+			edited = append(edited, region)
+		}
+	}
+	return edited
+}
+
+// StripMarkers removes the provenance markers from generated output, leaving
+// the output as rendered without them
+func StripMarkers(content string) string {
+	stripped, _ := WithoutRegions(content, nil)
+	return stripped
+}
+
+// WithoutRegions returns generated output without its provenance markers and
+// without the top-level regions for which drop returns true, e.g. to split
+// items out into files of their own
+func WithoutRegions(content string, drop func(*Region) bool) (string, error) {
+	regions, err := ParseRegions(content)
+	if err != nil {
+		return "", err
+	}
+	dropped := map[int]int{} // Begin line → end line of dropped regions
+	for _, region := range regions {
+		if drop != nil && drop(region) {
+			dropped[region.Line] = region.EndLine
+		}
+	}
+
+	lines := strings.Split(content, "\n")
+	var out []string
+	removed := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if end, ok := dropped[i+1]; ok {
+			i = end - 1
+			removed = true
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == endMarker || (strings.HasPrefix(trimmed, beginMarkerPrefix) && strings.HasSuffix(trimmed, markerSuffix)) {
+			removed = true
+			continue
+		}
+		if trimmed == "" {
+			// Blocks are separated by one blank line; keep it that way
+			// where markers or regions were taken out
+			if removed && (len(out) == 0 || strings.TrimSpace(out[len(out)-1]) == "") {
+				continue
+			}
+		} else {
+			removed = false
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n"), nil
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProvenanceMarkers(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "bundle", "go", "## Go\n\n:::include rule:errors\n\nKeep it simple.\n")
+	writeRegistryItem(t, registryPath, "rule", "errors", "---\nname: errors\nparams:\n  style: wrap\n---\n\nUse {{style}}.\n")
+
+	input := []byte("# Project\n\n:::include bundle:go\n\n:::include rule:errors style=\"wrap with %w\"\n")
+
+	output, err := ParseAndExpandWithOptions(input, Options{RegistryPath: registryPath, Provenance: true})
+	if err != nil {
+		t.Fatalf("ParseAndExpandWithOptions failed: %v", err)
+	}
+
+	regions, err := ParseRegions(string(output))
+	if err != nil {
+		t.Fatalf("ParseRegions failed: %v\n%s", err, output)
+	}
+	if len(regions) != 2 {
+		t.Fatalf("Expected 2 top-level regions, got %d:\n%s", len(regions), output)
+	}
+
+	bundle, errs := regions[0], regions[1]
+	if bundle.Ref() != "bundle:go" || len(bundle.Children) != 1 || bundle.Children[0].Ref() != "rule:errors" {
+		t.Errorf("Unexpected region tree: %s with %d children", bundle.Ref(), len(bundle.Children))
+	}
+	if errs.Params["style"] != "wrap with %w" || errs.Content != "Use wrap with %w." {
+		t.Errorf("Unexpected region %+v", errs)
+	}
+	if got := errs.Directive(); got != `:::include rule:errors style="wrap with %w"` {
+		t.Errorf("Unexpected directive %q", got)
+	}
+	if got, want := bundle.Source(), "## Go\n\n:::include rule:errors\n\nKeep it simple."; got != want {
+		t.Errorf("Source mismatch\n--- want ---\n%s\n--- got ---\n%s", want, got)
+	}
+	if edited := EditedRegions(regions); len(edited) != 0 {
+		t.Errorf("Expected no edited regions, got %d", len(edited))
+	}
+
+	// A hand edit in the nested item is attributed to that item only
+	edited := strings.Replace(string(output), "Use wrap.", "Use wrapping.", 1)
+	regions, err = ParseRegions(edited)
+	if err != nil {
+		t.Fatalf("ParseRegions failed: %v", err)
+	}
+	changed := EditedRegions(regions)
+	if len(changed) != 1 || changed[0] != regions[0].Children[0] {
+		t.Errorf("Expected only the nested rule:errors to be edited, got %d regions", len(changed))
+	}
+}
+
+func TestParseRegionsUnbalanced(t *testing.T) {
+	for _, input := range []string{
+		"<!-- agmd:begin rule:a sha256=00 -->\ntext\n",
+		"text\n<!-- agmd:end -->\n",
+		"<!-- agmd:begin rule:a -->\n<!-- agmd:end -->\n",
+	} {
+		if _, err := ParseRegions(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestWithoutRegions(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "bundle", "go", "## Go\n\n:::include rule:errors\n\nKeep it simple.\n")
+	writeRegistryItem(t, registryPath, "rule", "errors", "Wrap errors.\n")
+	writeRegistryItem(t, registryPath, "rule", "empty", "")
+
+	input := []byte("# Project\n\n:::include bundle:go\n\n:::include rule:empty\n\nOwn text.\n")
+	plain, err := ParseAndExpand(input, registryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marked, err := ParseAndExpandWithOptions(input, Options{RegistryPath: registryPath, Provenance: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := StripMarkers(string(marked)); got != string(plain) {
+		t.Errorf("StripMarkers mismatch\n--- want ---\n%s\n--- got ---\n%s", plain, got)
+	}
+
+	rest, err := WithoutRegions(string(marked), func(region *Region) bool { return region.Ref() == "bundle:go" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Project\n\nOwn text.\n"; rest != want {
+		t.Errorf("WithoutRegions mismatch\n--- want ---\n%q\n--- got ---\n%q", want, rest)
+	}
+}
@@ -1,14 +1,28 @@
 package parser
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
 	"github.com/yuin/goldmark/renderer"
 )
 
 // MarkdownRenderer renders AST back to clean Markdown
-type MarkdownRenderer struct{}
+//
+// Every CommonMark and GFM node kind is written back in its Markdown form:
+// blocks are separated by a single blank line, list markers and ordered-list
+// start numbers are kept, and code blocks, HTML and inline markup are copied
+// from the source where the AST does not carry enough detail on its own.
+type MarkdownRenderer struct {
+	// Provenance wraps each included item in <!-- agmd:begin/end --> markers
+	Provenance bool
+}
 
 // NewMarkdownRenderer creates a new MarkdownRenderer
 func NewMarkdownRenderer() renderer.Renderer {
@@ -17,106 +31,697 @@ func NewMarkdownRenderer() renderer.Renderer {
 
 // Render renders the AST to clean Markdown
 func (r *MarkdownRenderer) Render(w io.Writer, source []byte, node ast.Node) error {
-	return ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
-		return r.renderNode(w, source, n, entering)
-	})
+	out := r.renderBlock(source, node)
+	if out != "" {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, out)
+	return err
 }
 
-// renderNode renders a single node
-func (r *MarkdownRenderer) renderNode(w io.Writer, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+// AddOptions adds options to the renderer
+func (r *MarkdownRenderer) AddOptions(...renderer.Option) {}
+
+// renderBlock renders a block node without its trailing newline
+func (r *MarkdownRenderer) renderBlock(source []byte, node ast.Node) string {
 	switch n := node.(type) {
 	case *ast.Document:
-		// Just process children
-		return ast.WalkContinue, nil
+		return r.renderChildren(source, n, "\n\n")
 
 	case *ListBlock:
 		// ListBlock has been expanded, just render its children
-		return ast.WalkContinue, nil
+		return r.renderChildren(source, n, "\n\n")
 
-	case *NewItemBlock:
-		if entering {
-			// Render new item block content
-			w.Write([]byte("\n"))
-			return ast.WalkContinue, nil
+	case *FileBlock:
+		return r.renderChildren(source, n, "\n\n")
+
+	case *IncludedItem:
+		// Item content is parsed from its own file
+		content := r.renderChildren(n.Source, n, "\n\n")
+		if !r.Provenance {
+			return content
+		}
+		begin := beginMarker(n.ItemType, n.Name, n.Params, content)
+		if content == "" {
+			return begin + "\n" + endMarker
 		}
-		w.Write([]byte("\n"))
-		return ast.WalkContinue, nil
+		return begin + "\n" + content + "\n" + endMarker
+
+	case *NewItemBlock:
+		return r.renderChildren(source, n, "\n\n")
+
+	case *ConditionalBlock:
+		// Only the branch taken is left after transformation
+		return r.renderChildren(source, n, "\n\n")
+
+	case *ElseMarker:
+		return ""
 
 	case *ast.Heading:
-		if entering {
-			for i := 0; i < n.Level; i++ {
-				w.Write([]byte{'#'})
+		return r.renderHeading(source, n)
+
+	case *ast.Paragraph, *ast.TextBlock:
+		return r.renderInlines(source, n)
+
+	case *ast.ThematicBreak:
+		// The line is kept by thematicBreakParser: ***, ___ and - - - stay as written
+		if lines := n.Lines(); lines.Len() > 0 {
+			segment := lines.At(0)
+			return strings.TrimSpace(string(segment.Value(source)))
+		}
+		return "---"
+
+	case *ast.CodeBlock:
+		var b strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			line := seg.Value(source)
+			if len(bytes.TrimSpace(line)) > 0 {
+				b.WriteString("    ")
 			}
-			w.Write([]byte{' '})
-		} else {
-			w.Write([]byte("\n\n"))
+			b.Write(line)
+		}
+		return strings.TrimRight(b.String(), "\n")
+
+	case *ast.FencedCodeBlock:
+		return r.renderFencedCodeBlock(source, n)
+
+	case *ast.HTMLBlock:
+		var b strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			b.Write(seg.Value(source))
+		}
+		if n.HasClosure() {
+			b.Write(n.ClosureLine.Value(source))
 		}
-		return ast.WalkContinue, nil
+		return strings.TrimRight(b.String(), "\n")
 
-	case *ast.Paragraph:
-		if !entering {
-			w.Write([]byte("\n\n"))
+	case *LinkReferenceDefinitions:
+		var b strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			b.Write(seg.Value(source))
 		}
-		return ast.WalkContinue, nil
+		return strings.TrimRight(b.String(), "\n")
+
+	case *ast.Blockquote:
+		return prefixLines(r.renderChildren(source, n, "\n\n"), "> ", "> ")
 
 	case *ast.List:
-		if !entering {
-			w.Write([]byte("\n"))
-		}
-		return ast.WalkContinue, nil
+		return r.renderList(source, n)
 
 	case *ast.ListItem:
-		if entering {
-			w.Write([]byte("- "))
+		// List items are rendered by their parent list
+		return r.renderChildren(source, n, "\n\n")
+
+	case *east.Table:
+		return r.renderTable(source, n)
+
+	default:
+		if node.Type() == ast.TypeInline {
+			return r.renderInline(source, node)
+		}
+		return r.renderChildren(source, node, "\n\n")
+	}
+}
+
+// renderChildren renders each child block and joins the non-empty results;
+// link reference definitions stay on the line above the paragraph they opened
+func (r *MarkdownRenderer) renderChildren(source []byte, node ast.Node, sep string) string {
+	var b strings.Builder
+	join := ""
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		out := r.renderBlock(source, c)
+		if out == "" {
+			continue
+		}
+		b.WriteString(join + out)
+		join = sep
+		if defs, ok := c.(*LinkReferenceDefinitions); ok && defs.Tight {
+			join = "\n"
+		}
+	}
+	return b.String()
+}
+
+// renderHeading renders ATX headings, and setext headings when the source used one
+func (r *MarkdownRenderer) renderHeading(source []byte, n *ast.Heading) string {
+	text := r.renderInlines(source, n)
+	if underline := setextUnderline(source, n); underline != "" {
+		return text + "\n" + underline
+	}
+	if text == "" {
+		return strings.Repeat("#", n.Level)
+	}
+	return strings.Repeat("#", n.Level) + " " + text + atxClosing(source, n)
+}
+
+// atxClosing returns the optional closing #s of an ATX heading, with the
+// spaces before them, as written in the source
+func atxClosing(source []byte, n *ast.Heading) string {
+	lines := n.Lines()
+	if lines.Len() == 0 {
+		return ""
+	}
+	stop := lines.At(lines.Len() - 1).Stop
+	rest := source[stop:]
+	if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	closing := strings.TrimRight(string(rest), " \t\r")
+	if strings.Trim(closing, " \t") == "" || strings.Trim(closing, " \t#") != "" {
+		return ""
+	}
+	return closing
+}
+
+// setextUnderline returns the original ===/--- line of a setext heading, or ""
+func setextUnderline(source []byte, n *ast.Heading) string {
+	lines := n.Lines()
+	if n.Level > 2 || lines.Len() == 0 {
+		return ""
+	}
+	// ATX headings start with '#' on their first line
+	start := lineStart(source, lines.At(0).Start)
+	if bytes.HasPrefix(bytes.TrimLeft(source[start:lines.At(0).Start], " "), []byte("#")) {
+		return ""
+	}
+	next := bytes.IndexByte(source[lines.At(lines.Len()-1).Start:], '\n')
+	if next < 0 {
+		return ""
+	}
+	rest := source[lines.At(lines.Len()-1).Start+next+1:]
+	if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	underline := strings.TrimSpace(string(rest))
+	// The level may have been changed since parsing (e.g. included items)
+	char := "="
+	if n.Level == 2 {
+		char = "-"
+	}
+	if underline == "" || strings.Trim(underline, char) != "" {
+		return ""
+	}
+	return underline
+}
+
+// renderFencedCodeBlock renders a fenced code block using its original fence
+func (r *MarkdownRenderer) renderFencedCodeBlock(source []byte, n *ast.FencedCodeBlock) string {
+	fence := codeFence(source, n)
+
+	var b strings.Builder
+	b.WriteString(fence)
+	if n.Info != nil {
+		b.Write(n.Info.Segment.Value(source))
+	}
+	b.WriteString("\n")
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.Write(seg.Value(source))
+	}
+	b.WriteString(fence)
+	return b.String()
+}
+
+// codeFence recovers the ``` or ~~~ run that opened a fenced code block
+func codeFence(source []byte, n *ast.FencedCodeBlock) string {
+	var line []byte
+	switch {
+	case n.Info != nil:
+		start := lineStart(source, n.Info.Segment.Start)
+		line = source[start:n.Info.Segment.Start]
+	case n.Lines().Len() > 0:
+		// The fence is the line just above the first content line
+		end := lineStart(source, n.Lines().At(0).Start)
+		if end > 0 {
+			line = source[lineStart(source, end-1) : end-1]
+		}
+	}
+
+	line = bytes.TrimSpace(line)
+	if len(line) >= 3 && (line[0] == '`' || line[0] == '~') {
+		i := 0
+		for i < len(line) && line[i] == line[0] {
+			i++
+		}
+		return string(line[:i])
+	}
+	return "```"
+}
+
+// renderList renders bullet and ordered lists with correct item indentation
+func (r *MarkdownRenderer) renderList(source []byte, n *ast.List) string {
+	itemSep := "\n"
+	blockSep := "\n"
+	if !n.IsTight {
+		itemSep = "\n\n"
+		blockSep = "\n\n"
+	}
+
+	var items []string
+	number := n.Start
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		marker := string(n.Marker)
+		if n.IsOrdered() {
+			// Keep the numbers of the source (e.g. 1. on every item)
+			if written, ok := itemNumber(source, c); ok {
+				number = written
+			}
+			marker = strconv.Itoa(number) + string(n.Marker)
+			number++
+		}
+
+		body := r.renderChildren(source, c, blockSep)
+		if body == "" {
+			items = append(items, marker)
+			continue
+		}
+		indent := strings.Repeat(" ", len(marker)+1)
+		items = append(items, prefixLines(body, marker+" ", indent))
+	}
+	return strings.Join(items, itemSep)
+}
+
+// listNumberRe matches the number of an ordered list marker ending a prefix
+var listNumberRe = regexp.MustCompile(`(\d{1,9})[.)][ \t]*$`)
+
+// itemNumber returns the number written before an ordered list item
+func itemNumber(source []byte, item ast.Node) (int, bool) {
+	child := item.FirstChild()
+	if child == nil || child.Type() != ast.TypeBlock || child.Lines().Len() == 0 {
+		return 0, false
+	}
+	start := child.Lines().At(0).Start
+	m := listNumberRe.FindSubmatch(source[lineStart(source, start):start])
+	if m == nil {
+		return 0, false
+	}
+	number, err := strconv.Atoi(string(m[1]))
+	return number, err == nil
+}
+
+// rowStart returns the offset of a table row in the source, past the prefix
+// of its container, or -1 when it cannot be found
+func rowStart(source []byte, row ast.Node) int {
+	cell := row.FirstChild()
+	if cell == nil || cell.Lines().Len() == 0 {
+		return -1
+	}
+	start := cell.Lines().At(0).Start
+	i := start - 1
+	for i >= 0 && (source[i] == ' ' || source[i] == '\t') {
+		i--
+	}
+	if i >= 0 && source[i] == '|' {
+		return i
+	}
+	return start
+}
+
+// sourceLine returns the rest of the line at offset pos, without trailing spaces
+func sourceLine(source []byte, pos int) string {
+	line := source[pos:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	return strings.TrimRight(string(line), " \t\r")
+}
+
+// delimiterRow returns the delimiter row of a table as written in the
+// source, or "" when it cannot be found
+func delimiterRow(source []byte, n *east.Table) string {
+	header := n.FirstChild()
+	if header == nil {
+		return ""
+	}
+	start := rowStart(source, header)
+	if start < 0 {
+		return ""
+	}
+	eol := bytes.IndexByte(source[start:], '\n')
+	if eol < 0 {
+		return ""
+	}
+	line := sourceLine(source, start+eol+1)
+	// Skip the prefix of the container (> of a blockquote, indentation)
+	first := strings.IndexAny(line, "|:-")
+	if first < 0 || strings.Trim(line[first:], "|:- \t") != "" {
+		return ""
+	}
+	return line[first:]
+}
+
+// renderTable renders a GFM table with its rows as written in the source,
+// or else normalized ones
+func (r *MarkdownRenderer) renderTable(source []byte, n *east.Table) string {
+	var rows []string
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		if start := rowStart(source, row); start >= 0 {
+			rows = append(rows, sourceLine(source, start))
 		} else {
-			w.Write([]byte("\n"))
+			var cells []string
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				cells = append(cells, r.renderInlines(source, cell))
+			}
+			rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
 		}
-		return ast.WalkContinue, nil
 
+		if _, ok := row.(*east.TableHeader); ok {
+			if delims := delimiterRow(source, n); delims != "" {
+				rows = append(rows, delims)
+				continue
+			}
+			delims := make([]string, len(n.Alignments))
+			for i, align := range n.Alignments {
+				switch align {
+				case east.AlignLeft:
+					delims[i] = ":---"
+				case east.AlignRight:
+					delims[i] = "---:"
+				case east.AlignCenter:
+					delims[i] = ":---:"
+				default:
+					delims[i] = "---"
+				}
+			}
+			rows = append(rows, "| "+strings.Join(delims, " | ")+" |")
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+// renderInlines renders the inline children of a node
+func (r *MarkdownRenderer) renderInlines(source []byte, node ast.Node) string {
+	var b strings.Builder
+	for c := node.FirstChild(); c != nil; c = c.NextSibling() {
+		b.WriteString(r.renderInline(source, c))
+	}
+	return b.String()
+}
+
+// renderInline renders a single inline node and its children
+func (r *MarkdownRenderer) renderInline(source []byte, node ast.Node) string {
+	switch n := node.(type) {
 	case *ast.Text:
-		if entering {
-			w.Write(n.Segment.Value(source))
-			if n.SoftLineBreak() {
-				w.Write([]byte{'\n'})
+		var b strings.Builder
+		b.Write(n.Segment.Value(source))
+		switch {
+		case n.HardLineBreak():
+			// Keep the backslash or two-space form used in the source
+			if n.Segment.Stop < len(source) && source[n.Segment.Stop] == '\\' {
+				b.WriteString("\\\n")
+			} else {
+				b.WriteString("  \n")
 			}
+		case n.SoftLineBreak():
+			b.WriteString("\n")
 		}
-		return ast.WalkContinue, nil
+		return b.String()
 
 	case *ast.String:
-		if entering {
-			w.Write(n.Value)
-		}
-		return ast.WalkContinue, nil
+		return string(n.Value)
 
 	case *ast.Emphasis:
-		if entering {
-			if n.Level == 1 {
-				w.Write([]byte{'*'})
-			} else {
-				w.Write([]byte("**"))
+		delim := strings.Repeat(string(emphasisChar(source, n)), n.Level)
+		return delim + r.renderInlines(source, n) + delim
+
+	case *ast.CodeSpan:
+		return renderCodeSpan(r.renderInlines(source, n))
+
+	case *ast.Link:
+		if label, ok := referenceLabel(source, n); ok {
+			return "[" + r.renderInlines(source, n) + "]" + label
+		}
+		return "[" + r.renderInlines(source, n) + "]" + inlineDestination(source, n, n.Destination, n.Title)
+
+	case *ast.Image:
+		if label, ok := referenceLabel(source, n); ok {
+			return "![" + r.renderInlines(source, n) + "]" + label
+		}
+		return "![" + r.renderInlines(source, n) + "]" + inlineDestination(source, n, n.Destination, n.Title)
+
+	case *ast.AutoLink:
+		label := string(n.Label(source))
+		if prev, ok := n.PreviousSibling().(*ast.Text); ok && prev.Segment.Stop < len(source) && source[prev.Segment.Stop] == '<' {
+			return "<" + label + ">"
+		}
+		if n.PreviousSibling() == nil && startsWithAngle(source, n) {
+			return "<" + label + ">"
+		}
+		return label
+
+	case *ast.RawHTML:
+		var b strings.Builder
+		for i := 0; i < n.Segments.Len(); i++ {
+			seg := n.Segments.At(i)
+			b.Write(seg.Value(source))
+		}
+		return b.String()
+
+	case *east.Strikethrough:
+		delim := "~~"
+		if first, ok := n.FirstChild().(*ast.Text); ok && first.Segment.Start >= 2 && source[first.Segment.Start-2] != '~' {
+			delim = "~"
+		}
+		return delim + r.renderInlines(source, n) + delim
+
+	case *east.TaskCheckBox:
+		if n.IsChecked {
+			return "[x] "
+		}
+		return "[ ] "
+
+	default:
+		return r.renderInlines(source, node)
+	}
+}
+
+// emphasisChar returns '*' or '_' depending on the delimiter used in the source
+func emphasisChar(source []byte, n *ast.Emphasis) byte {
+	var first ast.Node = n
+	for first.FirstChild() != nil {
+		first = first.FirstChild()
+	}
+	if t, ok := first.(*ast.Text); ok && t.Segment.Start > 0 && source[t.Segment.Start-1] == '_' {
+		return '_'
+	}
+	return '*'
+}
+
+// renderCodeSpan wraps code in enough backticks to contain any backticks inside it
+func renderCodeSpan(code string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(code); i++ {
+		if code[i] == '`' {
+			run++
+			if run > longest {
+				longest = run
 			}
 		} else {
-			if n.Level == 1 {
-				w.Write([]byte{'*'})
-			} else {
-				w.Write([]byte("**"))
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") ||
+		(len(code) > 1 && strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") && strings.TrimSpace(code) != "") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// inlineDestination returns the (destination "title") of an inline link or
+// image as written in the source, or else rendered from its parts
+func inlineDestination(source []byte, n ast.Node, destination, title []byte) string {
+	if pos := closingBracket(source, n); pos >= 0 && pos+1 < len(source) && source[pos+1] == '(' {
+		// Spread over lines it would carry the prefix of its container
+		if end := linkTail(source, pos+1); end >= 0 && bytes.IndexByte(source[pos+1:end], '\n') < 0 {
+			return string(source[pos+1 : end])
+		}
+	}
+	return "(" + linkTarget(destination, title) + ")"
+}
+
+// linkTail returns the offset just past the ) closing the destination and
+// title of an inline link that open (at source[open] == '(') starts, or -1
+func linkTail(source []byte, open int) int {
+	i := open + 1
+	skipSpace := func() {
+		for i < len(source) && (source[i] == ' ' || source[i] == '\t' || source[i] == '\n') {
+			i++
+		}
+	}
+	skipSpace()
+	if i < len(source) && source[i] == '<' {
+		for i < len(source) && source[i] != '>' {
+			if source[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		i++
+	} else {
+		for depth := 0; i < len(source); i++ {
+			c := source[i]
+			if c == '\\' {
+				i++
+				continue
+			}
+			if c == ' ' || c == '\t' || c == '\n' || (c == ')' && depth == 0) {
+				break
+			}
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+			}
+		}
+	}
+	skipSpace()
+	if i < len(source) && strings.IndexByte(`"'(`, source[i]) >= 0 {
+		closer := source[i]
+		if closer == '(' {
+			closer = ')'
+		}
+		for i++; i < len(source) && source[i] != closer; i++ {
+			if source[i] == '\\' {
+				i++
 			}
 		}
-		return ast.WalkContinue, nil
+		i++
+		skipSpace()
+	}
+	if i >= len(source) || source[i] != ')' {
+		return -1
+	}
+	return i + 1
+}
 
-	case *ast.CodeSpan:
-		if entering {
-			w.Write([]byte{'`'})
-			w.Write(n.Text(source))
-			w.Write([]byte{'`'})
+// linkTarget renders the (destination "title") part of a link or image
+func linkTarget(destination, title []byte) string {
+	dest := string(destination)
+	if dest == "" || strings.ContainsAny(dest, " <>") {
+		dest = "<" + dest + ">"
+	}
+	if len(title) > 0 {
+		dest += fmt.Sprintf(` "%s"`, strings.ReplaceAll(string(title), `"`, `\"`))
+	}
+	return dest
+}
+
+// referenceLabel returns the label written after the text of a reference
+// link or image: "[label]", "[]" when collapsed or "" for a shortcut. ok is
+// false for inline links, and when the source does not tell.
+func referenceLabel(source []byte, n ast.Node) (label string, ok bool) {
+	pos := closingBracket(source, n)
+	if pos < 0 || (pos+1 < len(source) && source[pos+1] == '(') {
+		return "", false
+	}
+	if pos+1 < len(source) && source[pos+1] == '[' {
+		end := bytes.IndexByte(source[pos+1:], ']')
+		if end < 0 {
+			return "", false
 		}
-		return ast.WalkSkipChildren, nil
+		return string(source[pos+1 : pos+end+2]), true
+	}
+	return "", true
+}
+
+// closingBracket returns the offset of the ] closing the text of a link or
+// image, or -1
+func closingBracket(source []byte, n ast.Node) int {
+	pos := inlineEnd(source, n.LastChild())
+	if pos < 0 {
+		return -1
+	}
+	// Step over the closing delimiters of emphasis, code and strikethrough
+	for pos < len(source) && strings.IndexByte("*_~`", source[pos]) >= 0 {
+		pos++
+	}
+	if pos >= len(source) || source[pos] != ']' {
+		return -1
+	}
+	return pos
+}
 
+// inlineEnd returns the source offset just past the last text of an inline
+// node, or -1
+func inlineEnd(source []byte, n ast.Node) int {
+	switch n := n.(type) {
+	case nil:
+		return -1
+	case *ast.Text:
+		return n.Segment.Stop
+	case *ast.Link, *ast.Image:
+		// An image inside a link text: step over its own destination or label
+		pos := closingBracket(source, n)
+		if pos < 0 || pos+1 >= len(source) {
+			return pos
+		}
+		switch source[pos+1] {
+		case '(':
+			return linkTail(source, pos+1)
+		case '[':
+			if end := bytes.IndexByte(source[pos+1:], ']'); end >= 0 {
+				return pos + end + 2
+			}
+			return -1
+		}
+		return pos + 1
 	default:
-		// Skip other node types for now
-		return ast.WalkContinue, nil
+		return inlineEnd(source, n.LastChild())
 	}
 }
 
-// AddOptions adds options to the renderer
-func (r *MarkdownRenderer) AddOptions(...renderer.Option) {}
+// inlineParentText returns the raw text of the block containing an inline node
+func inlineParentText(source []byte, n ast.Node) []byte {
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Type() == ast.TypeBlock {
+			var b bytes.Buffer
+			lines := p.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				seg := lines.At(i)
+				b.Write(seg.Value(source))
+			}
+			return b.Bytes()
+		}
+	}
+	return nil
+}
+
+// startsWithAngle reports whether the block containing n starts with '<'
+func startsWithAngle(source []byte, n ast.Node) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(inlineParentText(source, n), " "), []byte("<"))
+}
+
+// lineStart returns the offset of the first byte of the line containing pos
+func lineStart(source []byte, pos int) int {
+	if pos > len(source) {
+		pos = len(source)
+	}
+	if i := bytes.LastIndexByte(source[:pos], '\n'); i >= 0 {
+		return i + 1
+	}
+	return 0
+}
+
+// prefixLines prefixes the first line with first and the remaining non-empty lines with rest
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRoundTrip checks that markdown without directives is reproduced byte-for-byte
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.md"))
+	if err != nil {
+		t.Fatalf("Failed to list golden files: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("No golden files found in testdata/roundtrip")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			input, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", file, err)
+			}
+
+			output, err := ParseAndExpand(input, t.TempDir())
+			if err != nil {
+				t.Fatalf("ParseAndExpand failed: %v", err)
+			}
+
+			if string(output) != string(input) {
+				t.Errorf("Round-trip mismatch for %s\n--- want ---\n%s\n--- got ---\n%s", file, input, output)
+			}
+		})
+	}
+}
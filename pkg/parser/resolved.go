@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"github.com/yuin/goldmark/parser"
+)
+
+// ResolvedItem is a registry item read while expanding a document
+type ResolvedItem struct {
+	Type  string
+	Name  string // Item name without #anchor
+	Path  string // Item file
+	Layer string // Registry directory the item was found in
+	Hash  string // sha256 of the item file
+}
+
+// Ref returns the TYPE:NAME reference of the item
+func (r ResolvedItem) Ref() string {
+	return r.Type + ":" + r.Name
+}
+
+// Expansion is the result of ExpandDocument
+type Expansion struct {
+	Output   []byte
+	Items    []ResolvedItem // Registry items used, in first-use order without repeats
+	Warnings []Diagnostic   // Problems that did not stop the expansion
+}
+
+var resolvedKey = parser.NewContextKey()
+
+// addResolved records a registry item read during expansion, once per item
+func addResolved(pc parser.Context, item ResolvedItem) {
+	items, _ := pc.Get(resolvedKey).([]ResolvedItem)
+	for _, existing := range items {
+		if existing.Ref() == item.Ref() {
+			return
+		}
+	}
+	pc.Set(resolvedKey, append(items, item))
+}
+
+// ResolvedItems returns the registry items read during expansion
+func ResolvedItems(pc parser.Context) []ResolvedItem {
+	items, _ := pc.Get(resolvedKey).([]ResolvedItem)
+	return items
+}
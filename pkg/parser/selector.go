@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"agmd/pkg/registry"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// isSelector reports whether a :::list entry selects items by glob, tag or
+// exclusion rather than naming a single item
+func isSelector(entry string) bool {
+	return strings.HasPrefix(entry, "!") ||
+		strings.HasPrefix(entry, "tag:") ||
+		strings.ContainsAny(entry, "*?[")
+}
+
+// expandSelectors replaces the glob (go/*, **), tag (tag:security) and
+// exclusion (!go/legacy) entries of a :::list block with the registry items
+// they match. Literal names keep their place; the items matched by a selector
+// are added in sorted order at the selector's position. Exclusions apply to
+// the whole block, wherever they appear. Items with invalid frontmatter are
+// reported instead of silently left out.
+func (t *DirectiveTransformer) expandSelectors(listBlock *ListBlock, pc parser.Context) {
+	if !slices.ContainsFunc(listBlock.Names, isSelector) {
+		return
+	}
+
+	reg := &registry.Registry{BasePath: t.RegistryPath, Layers: t.Layers}
+	items, err := reg.ListItems(listBlock.ItemType)
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			addExpandError(pc, err)
+		}
+	} else if err != nil {
+		addExpandError(pc, err)
+	}
+
+	var names, excluded []string
+	var positions []Position
+	add := func(name string, pos Position) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+			positions = append(positions, pos)
+		}
+	}
+
+	for i, entry := range listBlock.Names {
+		var pos Position
+		if i < len(listBlock.NamePositions) {
+			pos = listBlock.NamePositions[i]
+		}
+
+		if pattern, ok := strings.CutPrefix(entry, "!"); ok {
+			excluded = append(excluded, matchItems(items, pattern)...)
+			continue
+		}
+		if !isSelector(entry) {
+			add(entry, pos)
+			continue
+		}
+		for _, name := range matchItems(items, entry) {
+			add(name, pos)
+		}
+	}
+
+	listBlock.Names = nil
+	listBlock.NamePositions = nil
+	for i, name := range names {
+		if !slices.Contains(excluded, name) {
+			listBlock.Names = append(listBlock.Names, name)
+			listBlock.NamePositions = append(listBlock.NamePositions, positions[i])
+		}
+	}
+}
+
+// matchItems returns the names of the items selected by a single entry
+func matchItems(items []registry.Item, selector string) []string {
+	var names []string
+
+	if tag, ok := strings.CutPrefix(selector, "tag:"); ok {
+		for _, item := range items {
+			if slices.Contains(item.Tags, tag) {
+				names = append(names, item.Name)
+			}
+		}
+		return names
+	}
+
+	if !strings.ContainsAny(selector, "*?[") {
+		return []string{selector}
+	}
+
+	re, err := globToRegexp(selector)
+	if err != nil {
+		return nil
+	}
+	for _, item := range items {
+		if re.MatchString(item.Name) {
+			names = append(names, item.Name)
+		}
+	}
+	return names
+}
+
+// globToRegexp converts an item glob to a regular expression: * and ? stay
+// within one directory level, ** crosses levels and [...] is a character class
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(glob[i:]))
+				i = len(glob)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -1,26 +1,31 @@
 package parser
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
+	"agmd/pkg/registry"
+
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
-	"gopkg.in/yaml.v3"
 )
 
-// ItemMeta represents frontmatter metadata
-type ItemMeta struct {
-	Name     string `yaml:"name"`
-	Category string `yaml:"category"`
-	Severity string `yaml:"severity"`
-}
-
 // DirectiveTransformer expands directive blocks
 type DirectiveTransformer struct {
 	RegistryPath string
+	Layers       []string          // Registry layers searched in order (default: RegistryPath)
+	MaxDepth     int               // Maximum include nesting (0 = DefaultMaxDepth)
+	Vars         map[string]string // Project-wide values for {{placeholders}} and :::if
+	Target       string            // Output target that :::if target=... is tested against
+	ProjectRoot  string            // Directory :::file paths are resolved against
+	Dependencies DependencyPolicy  // What to do with the requires: of included items
 }
 
 // NewDirectiveTransformer creates a new transformer
@@ -30,6 +35,24 @@ func NewDirectiveTransformer(registryPath string) parser.ASTTransformer {
 	}
 }
 
+// includeState tracks the include chain and rendered items across nested parses
+type includeState struct {
+	chain []string        // type:name of the items being expanded, outermost first
+	seen  map[string]bool // Items already rendered anywhere in the document
+}
+
+var includeStateKey = parser.NewContextKey()
+
+// getIncludeState returns the include state of a parse, creating it for the top-level document
+func getIncludeState(pc parser.Context) *includeState {
+	if state, ok := pc.Get(includeStateKey).(*includeState); ok {
+		return state
+	}
+	state := &includeState{seen: map[string]bool{}}
+	pc.Set(includeStateKey, state)
+	return state
+}
+
 // Transform expands directives in the AST
 func (t *DirectiveTransformer) Transform(node *ast.Document, reader text.Reader, pc parser.Context) {
 	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
@@ -39,77 +62,404 @@ func (t *DirectiveTransformer) Transform(node *ast.Document, reader text.Reader,
 
 		switch block := n.(type) {
 		case *ListBlock:
-			t.expandListBlock(block, node, reader)
+			t.expandListBlock(block, pc)
+			// Nested directives were already expanded while parsing each item
+			return ast.WalkSkipChildren, nil
+		case *FileBlock:
+			t.expandFileBlock(block, pc)
+			return ast.WalkSkipChildren, nil
+		case *ConditionalBlock:
+			// Drop the branch not taken before its directives are expanded
+			t.pruneConditional(block)
 		case *NewItemBlock:
 			// Keep as-is, content already parsed as children
 		}
 
 		return ast.WalkContinue, nil
 	})
+
+	// Heading levels depend on where items end up in the whole document
+	if len(getIncludeState(pc).chain) == 0 {
+		normalizeHeadings(node)
+	}
+}
+
+// pruneConditional keeps only the branch of a :::if block selected by the
+// variables; a target variable set explicitly wins over the output target
+func (t *DirectiveTransformer) pruneConditional(block *ConditionalBlock) {
+	vars := make(map[string]string, len(t.Vars)+1)
+	for key, value := range t.Vars {
+		vars[key] = value
+	}
+	if _, set := vars["target"]; !set && t.Target != "" {
+		vars["target"] = t.Target
+	}
+
+	taken := block.Evaluate(vars)
+	inElse := false
+	for c := block.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		if _, ok := c.(*ElseMarker); ok {
+			inElse = true
+			block.RemoveChild(block, c)
+		} else if inElse == taken {
+			block.RemoveChild(block, c)
+		}
+		c = next
+	}
 }
 
 // expandListBlock expands a :::list block by loading registry files
-func (t *DirectiveTransformer) expandListBlock(listBlock *ListBlock, doc *ast.Document, reader text.Reader) {
-	// Use the ItemType to determine which registry folder to use
-	registryPath := filepath.Join(t.RegistryPath, listBlock.ItemType)
+func (t *DirectiveTransformer) expandListBlock(listBlock *ListBlock, pc parser.Context) {
+	state := getIncludeState(pc)
+	t.expandSelectors(listBlock, pc)
 
 	// Load each item file and insert content
-	for _, itemName := range listBlock.Names {
-		content, err := t.loadItemContent(registryPath, itemName)
-		if err != nil {
-			// Silently skip missing items - validation can catch this later
+	for i, itemName := range listBlock.Names {
+		var pos Position
+		if i < len(listBlock.NamePositions) {
+			pos = listBlock.NamePositions[i]
+		}
+		t.expandEntry(pc, listBlock, listBlock.ItemType, itemName, listBlock.Params, pos, state, t.pullRequires())
+	}
+}
+
+// expandEntry loads one item and appends it to listBlock. With pullRequires,
+// the items it requires that are not rendered yet are appended before it.
+func (t *DirectiveTransformer) expandEntry(pc parser.Context, listBlock *ListBlock, itemType, itemName string, params map[string]string, pos Position, state *includeState, pullRequires bool) {
+	ref := itemType + ":" + itemName
+	chain := append(slices.Clone(state.chain), ref)
+
+	if slices.Contains(state.chain, ref) {
+		addExpandError(pc, &CycleError{Chain: chain})
+		return
+	}
+	// An item reached through several includes is rendered only once
+	// (per distinct set of parameters)
+	seenKey := ref + paramsKey(params)
+	if state.seen[seenKey] {
+		return
+	}
+	if maxDepth := t.maxDepth(); len(chain) > maxDepth {
+		addExpandError(pc, &DepthError{Chain: chain, MaxDepth: maxDepth})
+		return
+	}
+
+	// name#anchor includes only the subtree of one heading
+	fileName, anchor, _ := strings.Cut(itemName, "#")
+	file, layer, err := t.loadItemContent(itemType, fileName)
+	if err == nil && anchor != "" {
+		err = file.narrow(anchor)
+	}
+	var metaErr *registry.MetaError
+	if errors.As(err, &metaErr) {
+		addExpandError(pc, err)
+		return
+	}
+	if err != nil {
+		// Record the miss so the caller can report or ignore it
+		addUnresolved(pc, UnresolvedRef{Type: itemType, Name: itemName, Pos: pos})
+		return
+	}
+
+	if pullRequires && len(file.Meta.Requires) > 0 {
+		t.expandRequires(pc, listBlock, itemType+":"+fileName, pos, state)
+	}
+
+	addResolved(pc, ResolvedItem{
+		Type:  itemType,
+		Name:  fileName,
+		Path:  file.Path,
+		Layer: layer,
+		Hash:  file.Hash,
+	})
+
+	content, missing := substituteParams(file.Body, file.Meta.Params, params, t.Vars)
+	if len(missing) > 0 {
+		for _, param := range missing {
+			addExpandError(pc, &ParamError{Item: ref, Param: param, Pos: pos})
+		}
+		return
+	}
+
+	state.seen[seenKey] = true
+	item := t.expandItem(pc, itemType, itemName, file, content, &includeState{chain: chain, seen: state.seen})
+	item.Params = params
+	item.HeadingLevel = listBlock.HeadingLevel
+	item.Flatten = listBlock.Flatten
+	listBlock.AppendChild(listBlock, item)
+}
+
+// expandRequires appends the items ref requires, directly or transitively,
+// that are not rendered yet, each after its own requirements. Cycles and
+// requirements missing from the registry are left to checkDependencies.
+func (t *DirectiveTransformer) expandRequires(pc parser.Context, listBlock *ListBlock, ref string, pos Position, state *includeState) {
+	reg := &registry.Registry{BasePath: t.RegistryPath, Layers: t.Layers}
+	deps, err := reg.ResolveDependencies(ref)
+	if err != nil {
+		return
+	}
+	for _, required := range deps.Order {
+		if required == ref {
 			continue
 		}
+		itemType, name, _ := registry.SplitRef(required)
+		t.expandEntry(pc, listBlock, itemType, name, nil, pos, state, false)
+	}
+}
+
+// pullRequires reports whether required items are added to the document
+func (t *DirectiveTransformer) pullRequires() bool {
+	return t.Dependencies != DependenciesWarn
+}
+
+// normalizeHeadings shifts the headings of each included item so the item
+// nests under the section it is included in. Items are visited in document
+// order, so nested items nest under their parent item's shifted headings,
+// while an item's headings never become the section of the items after it.
+func normalizeHeadings(doc ast.Node) {
+	current := 0
+	var outer []int
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch node := n.(type) {
+		case *IncludedItem:
+			if entering {
+				shiftItemHeadings(node, current)
+				outer = append(outer, current)
+			} else {
+				current = outer[len(outer)-1]
+				outer = outer[:len(outer)-1]
+			}
+		case *ast.Heading:
+			if entering {
+				current = node.Level
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
 
-		// Add the content directly without a heading
-		// (user can include their own heading in the item content)
-		para := ast.NewParagraph()
-		para.AppendChild(para, ast.NewString([]byte(content)))
-		listBlock.AppendChild(listBlock, para)
+// shiftItemHeadings moves an item's own headings so its top heading sits one
+// level below sectionLevel, at the level requested with level=N, or flattens them
+func shiftItemHeadings(item *IncludedItem, sectionLevel int) {
+	var headings []*ast.Heading
+	ast.Walk(item, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if nested, ok := n.(*IncludedItem); ok && nested != item {
+			// Nested items are shifted when the walk reaches them
+			return ast.WalkSkipChildren, nil
+		}
+		if heading, ok := n.(*ast.Heading); ok {
+			headings = append(headings, heading)
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(headings) == 0 {
+		return
+	}
+
+	if item.Flatten {
+		for _, heading := range headings {
+			strong := ast.NewEmphasis(2)
+			for c := heading.FirstChild(); c != nil; {
+				next := c.NextSibling()
+				strong.AppendChild(strong, c)
+				c = next
+			}
+			para := ast.NewParagraph()
+			para.AppendChild(para, strong)
+			heading.Parent().ReplaceChild(heading.Parent(), heading, para)
+		}
+		return
+	}
+
+	target := item.HeadingLevel
+	if target == 0 {
+		if sectionLevel == 0 {
+			// Not inside any section: keep the item's own levels
+			return
+		}
+		target = sectionLevel + 1
+	}
+
+	top := headings[0].Level
+	for _, heading := range headings {
+		top = min(top, heading.Level)
+	}
+	for _, heading := range headings {
+		heading.Level = max(1, min(6, heading.Level+target-top))
 	}
 }
 
-// loadItemContent loads an item file from the registry
-func (t *DirectiveTransformer) loadItemContent(registryPath, name string) (string, error) {
-	itemPath := filepath.Join(registryPath, name+".md")
+// expandItem parses an item's content and passes the unresolved references and
+// errors of its own directives up to pc, located in the item's file
+func (t *DirectiveTransformer) expandItem(pc parser.Context, itemType, name string, file *itemFile, content []byte, state *includeState) *IncludedItem {
+	item, ipc := t.parseItem(itemType, name, content, state)
+	for _, nested := range UnresolvedRefs(ipc) {
+		if nested.File == "" {
+			nested.File = file.Path
+			nested.Pos.Line += file.LineOffset
+		}
+		addUnresolved(pc, nested)
+	}
+	for _, err := range ExpandErrors(ipc) {
+		if located, ok := err.(locatedError); ok {
+			located.locate(file.Path, file.LineOffset)
+		}
+		addExpandError(pc, err)
+	}
+	for _, resolved := range ResolvedItems(ipc) {
+		addResolved(pc, resolved)
+	}
+	for _, d := range Diagnostics(ipc) {
+		if d.File == "" {
+			d.File = file.Path
+			d.Pos.Line += file.LineOffset
+		}
+		addDiagnostic(pc, d)
+	}
+	return item
+}
+
+// parseItem runs an item through the same goldmark pipeline so its own directives are expanded
+func (t *DirectiveTransformer) parseItem(itemType, name string, content []byte, state *includeState) (*IncludedItem, parser.Context) {
+	ipc := parser.NewContext()
+	ipc.Set(includeStateKey, state)
 
+	md := newMarkdown(&DirectiveExtension{
+		RegistryPath: t.RegistryPath,
+		Layers:       t.Layers,
+		MaxDepth:     t.MaxDepth,
+		Vars:         t.Vars,
+		Target:       t.Target,
+		ProjectRoot:  t.ProjectRoot,
+		Dependencies: t.Dependencies,
+	})
+	doc := md.Parser().Parse(text.NewReader(content), parser.WithContext(ipc))
+
+	node := NewIncludedItem(itemType, name, content)
+	for c := doc.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		node.AppendChild(node, c)
+		c = next
+	}
+	return node, ipc
+}
+
+// maxDepth returns the configured include depth limit
+func (t *DirectiveTransformer) maxDepth() int {
+	if t.MaxDepth > 0 {
+		return t.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// itemFile is a registry item read from disk
+type itemFile struct {
+	Path       string
+	Meta       registry.ItemMeta
+	Body       []byte // Content below the frontmatter, trimmed
+	LineOffset int    // Lines preceding Body in the file
+	Hash       string // sha256 of the whole file
+}
+
+// loadItemContent loads an item file from the first registry layer that has
+// it and returns the layer it came from
+func (t *DirectiveTransformer) loadItemContent(itemType, name string) (*itemFile, string, error) {
+	reg := &registry.Registry{BasePath: t.RegistryPath, Layers: t.Layers}
+	paths := reg.Which(itemType, name)
+	if len(paths) == 0 {
+		return nil, "", os.ErrNotExist
+	}
+	itemPath := paths[0]
 	data, err := os.ReadFile(itemPath)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
+	layer := reg.LayerOf(itemPath)
 
 	// Extract frontmatter and content
-	_, content := extractFrontmatter(data)
-	return strings.TrimSpace(string(content)), nil
+	meta, content, err := registry.ParseItemFile(data)
+	if err != nil {
+		if metaErr, ok := err.(*registry.MetaError); ok {
+			metaErr.Path = itemPath
+		}
+		return nil, "", err
+	}
+	file := &itemFile{
+		Path: itemPath,
+		Meta: *meta,
+		Body: bytes.TrimSpace(content),
+		Hash: ContentHash(string(data)),
+	}
+	skipped := len(data) - len(bytes.TrimLeft(content, " \t\r\n"))
+	file.LineOffset = bytes.Count(data[:skipped], []byte("\n"))
+	return file, layer, nil
 }
 
-// extractFrontmatter separates YAML frontmatter from markdown content
-func extractFrontmatter(data []byte) (*ItemMeta, []byte) {
-	lines := strings.Split(string(data), "\n")
-
-	if len(lines) < 3 || lines[0] != "---" {
-		return nil, data
+// narrow restricts the item body to the heading subtree matching anchor
+func (f *itemFile) narrow(anchor string) error {
+	section, lines, ok := Section(f.Body, anchor)
+	if !ok {
+		return fmt.Errorf("%s: no heading #%s", f.Path, anchor)
 	}
+	f.Body = section
+	f.LineOffset += lines
+	return nil
+}
 
-	// Find closing ---
-	var endIdx int
-	for i := 1; i < len(lines); i++ {
-		if lines[i] == "---" {
-			endIdx = i
-			break
+var placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// substituteParams replaces {{name}} placeholders in an item body.
+//
+// Values come from the directive's arguments, then project variables, then
+// the defaults declared in the item's frontmatter. Declared params without a
+// value are returned as missing; undeclared placeholders without a value are
+// left untouched so literal template syntax in items survives.
+func substituteParams(body []byte, declared map[string]registry.Param, args, vars map[string]string) ([]byte, []string) {
+	values := map[string]string{}
+	for name, param := range declared {
+		if param.Default != nil {
+			values[name] = *param.Default
 		}
 	}
+	for name, value := range vars {
+		values[name] = value
+	}
+	for name, value := range args {
+		values[name] = value
+	}
 
-	if endIdx == 0 {
-		return nil, data
+	var missing []string
+	for name, param := range declared {
+		if _, ok := values[name]; !ok && param.Required() {
+			missing = append(missing, name)
+		}
 	}
+	sort.Strings(missing)
+
+	return placeholderRe.ReplaceAllFunc(body, func(match []byte) []byte {
+		name := string(placeholderRe.FindSubmatch(match)[1])
+		if value, ok := values[name]; ok {
+			return []byte(value)
+		}
+		return match
+	}), missing
+}
 
-	// Parse frontmatter
-	frontmatterYAML := strings.Join(lines[1:endIdx], "\n")
-	var meta ItemMeta
-	yaml.Unmarshal([]byte(frontmatterYAML), &meta)
+// paramsKey returns a stable suffix identifying a set of directive arguments
+func paramsKey(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	// Return content after frontmatter
-	content := strings.Join(lines[endIdx+1:], "\n")
-	return &meta, []byte(content)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(" " + key + "=" + params[key])
+	}
+	return b.String()
 }
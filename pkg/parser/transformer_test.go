@@ -0,0 +1,587 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/pkg/registry"
+)
+
+// writeRegistryItem creates TYPE/NAME.md under a temporary registry
+func writeRegistryItem(t *testing.T, registryPath, itemType, name, content string) {
+	t.Helper()
+	path := filepath.Join(registryPath, itemType, name+".md")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create registry dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write registry item: %v", err)
+	}
+}
+
+func TestUnresolvedReferences(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "typescript", "---\nname: typescript\n---\n\nUse strict mode.\n")
+
+	input := []byte("# Rules\n\n:::include rule:typscript\n\n:::list rule\ntypescript\n  eslint\n:::end\n")
+
+	_, err := ParseAndExpandWithOptions(input, Options{
+		RegistryPath: registryPath,
+		Filename:     "directives.md",
+		LineOffset:   3,
+	})
+
+	var unresolved *UnresolvedError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("Expected *UnresolvedError, got %v", err)
+	}
+
+	want := []UnresolvedRef{
+		{Type: "rule", Name: "typscript", File: "directives.md", Pos: Position{Line: 6, Column: 12}},
+		{Type: "rule", Name: "eslint", File: "directives.md", Pos: Position{Line: 10, Column: 3}},
+	}
+	if len(unresolved.Refs) != len(want) {
+		t.Fatalf("Expected %d unresolved refs, got %d: %v", len(want), len(unresolved.Refs), unresolved.Refs)
+	}
+	for i, ref := range want {
+		if unresolved.Refs[i] != ref {
+			t.Errorf("Ref %d: expected %+v, got %+v", i, ref, unresolved.Refs[i])
+		}
+	}
+
+	if !strings.Contains(err.Error(), "directives.md:6:12: rule:typscript not found") {
+		t.Errorf("Error report missing position: %s", err.Error())
+	}
+}
+
+func TestAllowMissing(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "typescript", "---\nname: typescript\n---\n\nUse strict mode.\n")
+
+	input := []byte(":::list rule\ntypescript\nmissing\n:::end\n")
+
+	output, err := ParseAndExpandWithOptions(input, Options{RegistryPath: registryPath, AllowMissing: true})
+	if err != nil {
+		t.Fatalf("Expected no error with AllowMissing, got %v", err)
+	}
+	if string(output) != "Use strict mode.\n" {
+		t.Errorf("Unexpected output: %q", output)
+	}
+}
+
+func TestTransitiveIncludes(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "bundle", "go-backend", "---\nname: go-backend\n---\n\n## Go Backend\n\n:::include rule:errors\n\n:::list rule\ntesting\nerrors\n:::end\n")
+	writeRegistryItem(t, registryPath, "rule", "errors", "---\nname: errors\n---\n\n### Errors\n\nWrap errors with `%w`.\n")
+	writeRegistryItem(t, registryPath, "rule", "testing", "### Testing\n\n:::include rule:errors\n\nUse table-driven tests.\n")
+
+	input := []byte("# Project\n\n:::include bundle:go-backend\n\n:::include rule:testing\n")
+
+	output, err := ParseAndExpand(input, registryPath)
+	if err != nil {
+		t.Fatalf("ParseAndExpand failed: %v", err)
+	}
+
+	want := "# Project\n\n## Go Backend\n\n### Errors\n\nWrap errors with `%w`.\n\n### Testing\n\nUse table-driven tests.\n"
+	if string(output) != want {
+		t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", want, output)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "a", ":::include bundle:b\n")
+	writeRegistryItem(t, registryPath, "bundle", "b", ":::include rule:c\n")
+	writeRegistryItem(t, registryPath, "rule", "c", ":::include rule:a\n")
+
+	_, err := ParseAndExpand([]byte(":::include rule:a\n"), registryPath)
+
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("Expected *CycleError, got %v", err)
+	}
+	if got := strings.Join(cycle.Chain, " "); got != "rule:a bundle:b rule:c rule:a" {
+		t.Errorf("Unexpected cycle chain: %s", got)
+	}
+}
+
+func TestIncludeMaxDepth(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "one", ":::include rule:two\n")
+	writeRegistryItem(t, registryPath, "rule", "two", ":::include rule:three\n")
+	writeRegistryItem(t, registryPath, "rule", "three", "Deep content.\n")
+
+	if _, err := ParseAndExpandWithOptions([]byte(":::include rule:one\n"), Options{RegistryPath: registryPath, MaxDepth: 3}); err != nil {
+		t.Fatalf("Expected depth 3 to succeed, got %v", err)
+	}
+
+	_, err := ParseAndExpandWithOptions([]byte(":::include rule:one\n"), Options{RegistryPath: registryPath, MaxDepth: 2})
+	var depth *DepthError
+	if !errors.As(err, &depth) {
+		t.Fatalf("Expected *DepthError, got %v", err)
+	}
+	if depth.MaxDepth != 2 || len(depth.Chain) != 3 {
+		t.Errorf("Unexpected depth error: %v", depth)
+	}
+}
+
+func TestNestedUnresolvedReference(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "bundle", "web", "---\nname: web\n---\n\n# Web\n\n:::include rule:missing\n")
+
+	_, err := ParseAndExpand([]byte(":::include bundle:web\n"), registryPath)
+
+	var unresolved *UnresolvedError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("Expected *UnresolvedError, got %v", err)
+	}
+	ref := unresolved.Refs[0]
+	if ref.File != filepath.Join(registryPath, "bundle", "web.md") || ref.Pos != (Position{Line: 7, Column: 12}) {
+		t.Errorf("Unexpected nested ref location: %s:%d:%d", ref.File, ref.Pos.Line, ref.Pos.Column)
+	}
+}
+
+func TestParameterizedIncludes(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "workflow", "deploy", `---
+name: deploy
+params:
+  env: staging
+  branch:
+    description: Branch to deploy
+  region:
+---
+
+Deploy {{branch}} to {{ env }} in {{region}}. Keep {{ .Literal }} and {{unknown}}.
+`)
+
+	input := []byte(":::include workflow:deploy branch=main\n\n:::include workflow:deploy env=production branch=\"release 2\"\n")
+
+	output, err := ParseAndExpandWithOptions(input, Options{
+		RegistryPath: registryPath,
+		Vars:         map[string]string{"region": "eu-west-1", "env": "qa"},
+	})
+	if err != nil {
+		t.Fatalf("ParseAndExpand failed: %v", err)
+	}
+
+	want := "Deploy main to qa in eu-west-1. Keep {{ .Literal }} and {{unknown}}.\n\n" +
+		"Deploy release 2 to production in eu-west-1. Keep {{ .Literal }} and {{unknown}}.\n"
+	if string(output) != want {
+		t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", want, output)
+	}
+}
+
+func TestMissingRequiredParam(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "workflow", "deploy", "---\nname: deploy\nparams:\n  branch:\n---\n\nDeploy {{branch}}.\n")
+
+	_, err := ParseAndExpandWithOptions([]byte("# Deploy\n\n:::include workflow:deploy env=ci\n"), Options{
+		RegistryPath: registryPath,
+		Filename:     "directives.md",
+	})
+
+	var paramErr *ParamError
+	if !errors.As(err, &paramErr) {
+		t.Fatalf("Expected *ParamError, got %v", err)
+	}
+	if paramErr.Param != "branch" || paramErr.Item != "workflow:deploy" || paramErr.File != "directives.md" || paramErr.Pos.Line != 3 {
+		t.Errorf("Unexpected param error: %v", paramErr)
+	}
+}
+
+func TestConditionalBlocks(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "ci", "Run in CI mode.\n")
+
+	input := []byte(`# Instructions
+
+:::if target=claude
+Claude only.
+:::else
+Other agents.
+:::end
+
+:::if env=ci
+:::include rule:ci
+
+:::if target!=cursor
+Nested, not cursor.
+:::end
+:::else
+:::include rule:missing
+:::end
+
+:::if debug
+Debugging.
+:::end
+
+After.
+`)
+
+	tests := []struct {
+		name   string
+		target string
+		vars   map[string]string
+		want   string
+	}{
+		{
+			name:   "claude in ci",
+			target: "claude",
+			vars:   map[string]string{"env": "ci"},
+			want:   "# Instructions\n\nClaude only.\n\nRun in CI mode.\n\nNested, not cursor.\n\nAfter.\n",
+		},
+		{
+			name:   "cursor in ci with debug",
+			target: "cursor",
+			vars:   map[string]string{"env": "ci", "debug": "true"},
+			want:   "# Instructions\n\nOther agents.\n\nRun in CI mode.\n\nDebugging.\n\nAfter.\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := ParseAndExpandWithOptions(input, Options{
+				RegistryPath: registryPath,
+				Vars:         tc.vars,
+				Target:       tc.target,
+			})
+			if err != nil {
+				t.Fatalf("ParseAndExpand failed: %v", err)
+			}
+			if string(output) != tc.want {
+				t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", tc.want, output)
+			}
+		})
+	}
+
+	// The untaken branch is pruned before expansion, so its missing item only
+	// fails when that branch is selected
+	_, err := ParseAndExpandWithOptions(input, Options{RegistryPath: registryPath})
+	var unresolved *UnresolvedError
+	if !errors.As(err, &unresolved) || unresolved.Refs[0].Name != "missing" {
+		t.Errorf("Expected rule:missing to be unresolved outside CI, got %v", err)
+	}
+}
+
+func TestHeadingNormalization(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "go", "# Go\n\nUse gofmt.\n\n## Errors\n\nWrap errors.\n")
+	writeRegistryItem(t, registryPath, "rule", "setext", "Setext\n======\n\nBody.\n")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "nests under enclosing section",
+			input: "# Project\n\n## Rules\n\n:::include rule:go\n",
+			want:  "# Project\n\n## Rules\n\n### Go\n\nUse gofmt.\n\n#### Errors\n\nWrap errors.\n",
+		},
+		{
+			name:  "no enclosing section keeps levels",
+			input: ":::include rule:go\n",
+			want:  "# Go\n\nUse gofmt.\n\n## Errors\n\nWrap errors.\n",
+		},
+		{
+			name:  "explicit level",
+			input: "# Project\n\n:::include rule:go level=3\n",
+			want:  "# Project\n\n### Go\n\nUse gofmt.\n\n#### Errors\n\nWrap errors.\n",
+		},
+		{
+			name:  "list with level",
+			input: "# Project\n\n:::list rule level=4\ngo\n:::end\n",
+			want:  "# Project\n\n#### Go\n\nUse gofmt.\n\n##### Errors\n\nWrap errors.\n",
+		},
+		{
+			name:  "clamped at six",
+			input: "##### Deep\n\n:::include rule:go\n",
+			want:  "##### Deep\n\n###### Go\n\nUse gofmt.\n\n###### Errors\n\nWrap errors.\n",
+		},
+		{
+			name:  "flatten",
+			input: "## Rules\n\n:::include rule:go flatten\n",
+			want:  "## Rules\n\n**Go**\n\nUse gofmt.\n\n**Errors**\n\nWrap errors.\n",
+		},
+		{
+			name:  "shifted setext heading",
+			input: "# Project\n\n:::include rule:setext\n",
+			want:  "# Project\n\n## Setext\n\nBody.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := ParseAndExpand([]byte(tt.input), registryPath)
+			if err != nil {
+				t.Fatalf("ParseAndExpand failed: %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", tt.want, output)
+			}
+		})
+	}
+}
+
+func TestListSelectors(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "go/errors", "Go errors.\n")
+	writeRegistryItem(t, registryPath, "rule", "go/legacy", "Go legacy.\n")
+	writeRegistryItem(t, registryPath, "rule", "go/testing", "---\nname: testing\ntags: [quality]\n---\n\nGo testing.\n")
+	writeRegistryItem(t, registryPath, "rule", "go/db/sql", "Go SQL.\n")
+	writeRegistryItem(t, registryPath, "rule", "secrets", "---\nname: secrets\ntags: [security, quality]\n---\n\nNo secrets.\n")
+	writeRegistryItem(t, registryPath, "rule", "style", "Style.\n")
+
+	tests := []struct {
+		name    string
+		entries string
+		want    []string
+	}{
+		{name: "single level glob", entries: "go/*", want: []string{"Go errors.", "Go legacy.", "Go testing."}},
+		{name: "recursive glob", entries: "go/**", want: []string{"Go SQL.", "Go errors.", "Go legacy.", "Go testing."}},
+		{name: "everything", entries: "**", want: []string{"Go SQL.", "Go errors.", "Go legacy.", "Go testing.", "No secrets.", "Style."}},
+		{name: "tag", entries: "tag:security", want: []string{"No secrets."}},
+		{name: "exclusion", entries: "go/*\n!go/legacy", want: []string{"Go errors.", "Go testing."}},
+		{name: "excluded tag", entries: "**\n!tag:quality\n!go/db/*", want: []string{"Go errors.", "Go legacy.", "Style."}},
+		{name: "literals keep order", entries: "style\ntag:quality\nsecrets", want: []string{"Style.", "Go testing.", "No secrets."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := ":::list rule\n" + tt.entries + "\n:::end\n"
+			output, err := ParseAndExpand([]byte(input), registryPath)
+			if err != nil {
+				t.Fatalf("ParseAndExpand failed: %v", err)
+			}
+			want := strings.Join(tt.want, "\n\n") + "\n"
+			if string(output) != want {
+				t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", want, output)
+			}
+		})
+	}
+}
+
+func TestSectionInclude(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "guide", "handbook", `---
+name: handbook
+---
+
+# Handbook
+
+Intro.
+
+## Testing
+
+Write tests.
+
+### Fixtures
+
+Use testdata.
+
+## Releases
+
+Tag releases.
+`)
+
+	output, err := ParseAndExpand([]byte("# Project\n\n:::include guide:handbook#testing\n"), registryPath)
+	if err != nil {
+		t.Fatalf("ParseAndExpand failed: %v", err)
+	}
+	want := "# Project\n\n## Testing\n\nWrite tests.\n\n### Fixtures\n\nUse testdata.\n"
+	if string(output) != want {
+		t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", want, output)
+	}
+
+	_, err = ParseAndExpand([]byte(":::include guide:handbook#deploying\n"), registryPath)
+	var unresolved *UnresolvedError
+	if !errors.As(err, &unresolved) || unresolved.Refs[0].String() != "guide:handbook#deploying" {
+		t.Errorf("Expected unresolved guide:handbook#deploying, got %v", err)
+	}
+}
+
+func TestOutline(t *testing.T) {
+	content := []byte("# Guide: Go & Rust\n\nText.\n\nSetup\n-----\n\n## `go test` Usage\n\n## Setup\n")
+
+	var got []string
+	for _, heading := range Outline(content) {
+		got = append(got, strings.Repeat("#", heading.Level)+" "+heading.Slug)
+	}
+	want := []string{"# guide-go--rust", "## setup", "## go-test-usage", "## setup-1"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Unexpected outline: %v", got)
+	}
+}
+
+func TestFileDirective(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"docs/architecture.md": "# Architecture\n\nOverview.\n\n## Storage\n\nSQLite.\n\n## API\n\nREST.\n",
+		"Makefile":             "build:\n\tgo build ./...\n\ntest:\n\tgo test ./...\n",
+		"notes.md":             "Line 1\nLine 2\nLine 3\nLine 4\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(t.TempDir(), "secret.md")
+	if err := os.WriteFile(outside, []byte("Secret.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "whole file nested under section",
+			input: "# Project\n\n:::file docs/architecture.md\n",
+			want:  "# Project\n\n## Architecture\n\nOverview.\n\n### Storage\n\nSQLite.\n\n### API\n\nREST.\n",
+		},
+		{
+			name:  "anchor",
+			input: "## Docs\n\n:::file docs/architecture.md#storage\n",
+			want:  "## Docs\n\n### Storage\n\nSQLite.\n",
+		},
+		{
+			name:  "line range",
+			input: ":::file notes.md lines=2-3\n",
+			want:  "Line 2\nLine 3\n",
+		},
+		{
+			name:  "fenced",
+			input: ":::file Makefile lang=make lines=1-2\n",
+			want:  "```make\nbuild:\n\tgo build ./...\n```\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := ParseAndExpandWithOptions([]byte(tt.input), Options{ProjectRoot: root})
+			if err != nil {
+				t.Fatalf("ParseAndExpand failed: %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", tt.want, output)
+			}
+		})
+	}
+
+	for _, path := range []string{"../secret.md", outside, "link.md"} {
+		_, err := ParseAndExpandWithOptions([]byte(":::file "+path+"\n"), Options{ProjectRoot: root})
+		if !errors.Is(err, ErrOutsideProject) {
+			t.Errorf("%s: expected ErrOutsideProject, got %v", path, err)
+		}
+	}
+
+	_, err := ParseAndExpandWithOptions([]byte("Text.\n\n:::file docs/missing.md\n"), Options{ProjectRoot: root, Filename: "directives.md"})
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || fileErr.File != "directives.md" || fileErr.Pos != (Position{Line: 3, Column: 9}) {
+		t.Errorf("Expected located *FileError, got %v", err)
+	}
+}
+
+func TestExpandDocumentItems(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "outer", "## Outer\n\n:::include rule:inner\n")
+	writeRegistryItem(t, registryPath, "rule", "inner", "Inner.\n")
+	writeRegistryItem(t, registryPath, "guide", "handbook", "## Testing\n\nTest.\n")
+
+	input := []byte(":::include rule:outer\n\n:::include rule:inner\n\n:::include guide:handbook#testing\n\n:::include rule:missing\n")
+
+	expansion, err := ExpandDocument(input, Options{RegistryPath: registryPath, AllowMissing: true})
+	if err != nil {
+		t.Fatalf("ExpandDocument failed: %v", err)
+	}
+
+	var refs []string
+	for _, item := range expansion.Items {
+		refs = append(refs, item.Ref())
+		if item.Layer != registryPath || item.Hash == "" {
+			t.Errorf("Incomplete resolved item %+v", item)
+		}
+	}
+	if want := []string{"rule:outer", "rule:inner", "guide:handbook"}; strings.Join(refs, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected items %v, got %v", want, refs)
+	}
+}
+
+func TestRequires(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "base", "Be consistent.\n")
+	writeRegistryItem(t, registryPath, "rule", "typescript", "---\nrequires: [rule:base]\n---\nUse strict mode.\n")
+	writeRegistryItem(t, registryPath, "rule", "react-hooks", "---\nrequires: [rule:typescript]\n---\nName hooks useX.\n")
+
+	input := []byte(":::include rule:react-hooks\n\n:::include rule:base\n")
+
+	// Requirements are pulled in before the items that need them, once
+	expansion, err := ExpandDocument(input, Options{RegistryPath: registryPath})
+	if err != nil {
+		t.Fatalf("ExpandDocument failed: %v", err)
+	}
+	if want := "Be consistent.\n\nUse strict mode.\n\nName hooks useX.\n"; string(expansion.Output) != want {
+		t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", want, expansion.Output)
+	}
+	var refs []string
+	for _, item := range expansion.Items {
+		refs = append(refs, item.Ref())
+	}
+	if got := strings.Join(refs, " "); got != "rule:base rule:typescript rule:react-hooks" {
+		t.Errorf("Resolved items: %s", got)
+	}
+
+	// With DependenciesWarn they are only reported
+	expansion, err = ExpandDocument(input, Options{RegistryPath: registryPath, Filename: "directives.md", Dependencies: DependenciesWarn})
+	if err != nil {
+		t.Fatalf("ExpandDocument failed: %v", err)
+	}
+	if want := "Name hooks useX.\n\nBe consistent.\n"; string(expansion.Output) != want {
+		t.Errorf("Unexpected output\n--- want ---\n%s\n--- got ---\n%s", want, expansion.Output)
+	}
+	want := Diagnostic{File: "directives.md", Severity: SeverityWarning, Code: CodeMissingRequire, Message: "rule:react-hooks requires rule:typescript, which is not included"}
+	if len(expansion.Warnings) != 1 || expansion.Warnings[0] != want {
+		t.Errorf("Warnings = %v, want [%s]", expansion.Warnings, want)
+	}
+}
+
+func TestRequiresErrors(t *testing.T) {
+	registryPath := t.TempDir()
+	writeRegistryItem(t, registryPath, "rule", "a", "---\nrequires: [rule:b]\n---\nA.\n")
+	writeRegistryItem(t, registryPath, "rule", "b", "---\nrequires: [rule:a]\n---\nB.\n")
+	writeRegistryItem(t, registryPath, "rule", "orphan", "---\nrequires: [rule:missing]\n---\nOrphan.\n")
+	writeRegistryItem(t, registryPath, "rule", "tabs", "---\nconflicts_with: [rule:spaces]\n---\nTabs.\n")
+	writeRegistryItem(t, registryPath, "rule", "spaces", "Spaces.\n")
+
+	_, err := ParseAndExpand([]byte(":::include rule:a\n"), registryPath)
+	var cycle *registry.RequireCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("Expected *RequireCycleError, got %v", err)
+	}
+	if got := strings.Join(cycle.Chain, " "); got != "rule:a rule:b rule:a" {
+		t.Errorf("Unexpected cycle chain: %s", got)
+	}
+
+	_, err = ParseAndExpand([]byte(":::include rule:orphan\n"), registryPath)
+	var dep *DependencyError
+	if !errors.As(err, &dep) || dep.Conflict || dep.Other != "rule:missing" {
+		t.Errorf("Expected missing requirement rule:missing, got %v", err)
+	}
+
+	_, err = ParseAndExpand([]byte(":::list rule\ntabs\nspaces\n:::end\n"), registryPath)
+	if !errors.As(err, &dep) || !dep.Conflict || dep.Item != "rule:tabs" || dep.Other != "rule:spaces" {
+		t.Errorf("Expected rule:tabs to conflict with rule:spaces, got %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+// Package pullback maps hand edits in a generated AGENTS.md back to the
+// registry items and directives.md it was expanded from
+package pullback
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"agmd/pkg/diff"
+	"agmd/pkg/parser"
+	"agmd/pkg/registry"
+)
+
+// ErrNoProvenance is returned for output generated without provenance markers
+var ErrNoProvenance = errors.New("no provenance markers found")
+
+// Change is a rewrite of one source file
+type Change struct {
+	Ref  string // TYPE:NAME of the edited item, or "" for directives.md
+	Path string // File to write
+	Line int    // Line of the edited region in AGENTS.md (0 for directives.md)
+	Old  string // Current file content
+	New  string // File content with the hand edits applied
+}
+
+// Skip is a hand edit that cannot be written back automatically
+type Skip struct {
+	Ref    string
+	Line   int
+	Reason string
+}
+
+// Result lists the changes to write and the edits left alone
+type Result struct {
+	Changes []Change
+	Skipped []Skip
+}
+
+// Plan compares the hand-edited output agents with expected, the output
+// freshly expanded (with provenance markers) from directivesPath and the
+// registry layers, and returns the source changes reproducing the edits.
+//
+// Edits inside a marked item go to the item's registry file, keeping its
+// frontmatter; edits outside any item go to directives.md.
+func Plan(agents, expected, directivesPath string, reg *registry.Registry) (*Result, error) {
+	current, err := parser.ParseRegions(agents)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance markers: %w", err)
+	}
+	if len(current) == 0 {
+		return nil, ErrNoProvenance
+	}
+	fresh, err := parser.ParseRegions(expected)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance markers in expanded output: %w", err)
+	}
+
+	result := &Result{}
+	matches := matchRegions(parser.AllRegions(current), parser.AllRegions(fresh))
+	changed := map[string]bool{}
+	for _, region := range parser.AllRegions(current) {
+		if !region.Edited() {
+			continue
+		}
+		generated, ok := matches[region]
+		if !ok {
+			result.skip(region, "is no longer expanded from directives.md")
+			continue
+		}
+		// Edits inside nested items are handled with those items
+		if region.Source() == generated.Source() {
+			continue
+		}
+		if generated.Hash != region.Hash {
+			result.skip(region, "changed in the registry since the last sync; run 'agmd sync' and redo the edit")
+			continue
+		}
+		if region.Type == "file" {
+			result.skip(region, "is a project file; edit it directly")
+			continue
+		}
+		if strings.Contains(region.Name, "#") {
+			result.skip(region, "is a section of a registry item; edit the item directly")
+			continue
+		}
+
+		// Write to the layer the item was expanded from
+		paths := reg.Which(region.Type, region.Name)
+		if len(paths) == 0 {
+			result.skip(region, "is no longer in the registry")
+			continue
+		}
+		path := paths[0]
+		if source := reg.SourceOf(path); source != "" {
+			result.skip(region, fmt.Sprintf("comes from the read-only source %q; override it in your registry instead", source))
+			continue
+		}
+		if changed[path] {
+			result.skip(region, "was edited in more than one place")
+			continue
+		}
+		change, err := itemChange(region, generated, path)
+		if err != nil {
+			result.skip(region, fmt.Sprintf("could not be mapped onto %s (%v); edit it directly", path, err))
+			continue
+		}
+		if change.New != change.Old {
+			changed[path] = true
+			result.Changes = append(result.Changes, *change)
+		}
+	}
+
+	if err := result.directivesChange(agents, current, expected, fresh, directivesPath); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Unexpand maps the item regions of agents, output with provenance markers,
+// back to the items as written in the registry. The expansion (heading
+// shift, substituted parameters) is undone as for pull-back, by applying
+// the differences between each region and its counterpart in expected to
+// the item's registry file. The result is keyed by the line of each
+// region's begin marker; regions of items the registry lacks are left out.
+func Unexpand(agents, expected string, reg *registry.Registry) (map[int]string, error) {
+	current, err := parser.ParseRegions(agents)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance markers: %w", err)
+	}
+	fresh, err := parser.ParseRegions(expected)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance markers in expanded output: %w", err)
+	}
+
+	items := map[int]string{}
+	matches := matchRegions(parser.AllRegions(current), parser.AllRegions(fresh))
+	for _, region := range parser.AllRegions(current) {
+		generated, ok := matches[region]
+		if !ok || region.Type == "file" {
+			continue
+		}
+		paths := reg.Which(region.Type, region.Name)
+		if len(paths) == 0 {
+			continue
+		}
+		data, err := os.ReadFile(paths[0])
+		if err != nil {
+			continue
+		}
+		_, body := splitItemFile(string(data))
+		if item, err := mapEdit(body, generated.Source(), strings.TrimSpace(region.Source())); err == nil {
+			items[region.Line] = item
+		}
+	}
+	return items, nil
+}
+
+// skip records an edit that is left alone
+func (r *Result) skip(region *parser.Region, reason string) {
+	r.Skipped = append(r.Skipped, Skip{Ref: region.Ref(), Line: region.Line, Reason: reason})
+}
+
+// matchRegions pairs each region of the edited output with the region
+// generated by the same directive, counting repeated directives in order
+func matchRegions(current, fresh []*parser.Region) map[*parser.Region]*parser.Region {
+	byDirective := map[string][]*parser.Region{}
+	for _, region := range fresh {
+		key := region.Directive()
+		byDirective[key] = append(byDirective[key], region)
+	}
+
+	matches := map[*parser.Region]*parser.Region{}
+	for _, region := range current {
+		key := region.Directive()
+		if candidates := byDirective[key]; len(candidates) > 0 {
+			matches[region] = candidates[0]
+			byDirective[key] = candidates[1:]
+		}
+	}
+	return matches
+}
+
+// itemChange applies the edits of one region to its registry file
+func itemChange(region, generated *parser.Region, path string) (*Change, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	header, body := splitItemFile(string(data))
+
+	newBody, err := mapEdit(body, generated.Source(), strings.TrimSpace(region.Source()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Change{
+		Ref:  region.Ref(),
+		Path: path,
+		Line: region.Line,
+		Old:  string(data),
+		New:  header + newBody + "\n",
+	}, nil
+}
+
+// mapEdit turns an item's generated text into edited text and applies the
+// difference to the item body, undoing the heading shift of the expansion
+func mapEdit(body, generated, edited string) (string, error) {
+	if top, genTop := topHeading(body), topHeading(generated); top > 0 && genTop > 0 {
+		generated = shiftHeadings(generated, top-genTop)
+		edited = shiftHeadings(edited, top-genTop)
+	}
+	if generated == body {
+		return edited, nil
+	}
+	return diff.Patch(body, generated, edited, 3)
+}
+
+// splitItemFile separates the frontmatter (with the blank lines after it)
+// from the trimmed body of a registry item file
+func splitItemFile(data string) (header, body string) {
+	if strings.HasPrefix(data, "---\n") {
+		if end := strings.Index(data, "\n---\n"); end >= 0 {
+			header = data[:end+len("\n---\n")]
+		}
+	}
+
+	rest := data[len(header):]
+	trimmed := strings.TrimLeft(rest, "\r\n")
+	return header + rest[:len(rest)-len(trimmed)], strings.TrimSpace(trimmed)
+}
+
+var headingRe = regexp.MustCompile(`^(#{1,6})(\s|$)`)
+
+// topHeading returns the smallest ATX heading level outside code fences, or 0
+func topHeading(content string) int {
+	top := 0
+	eachHeading(content, func(level int) int {
+		if top == 0 || level < top {
+			top = level
+		}
+		return level
+	})
+	return top
+}
+
+// shiftHeadings moves every ATX heading outside code fences by delta levels
+func shiftHeadings(content string, delta int) string {
+	if delta == 0 {
+		return content
+	}
+	return eachHeading(content, func(level int) int {
+		return max(1, min(6, level+delta))
+	})
+}
+
+// eachHeading calls fn with the level of each ATX heading outside code
+// fences and rewrites the heading to the level fn returns
+func eachHeading(content string, fn func(level int) int) string {
+	lines := strings.Split(content, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if match := headingRe.FindStringSubmatch(line); match != nil {
+			level := fn(len(match[1]))
+			lines[i] = strings.Repeat("#", level) + line[len(match[1]):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// directivesChange maps edits outside the top-level item regions onto
+// directives.md, where each region stands for the directive that produced it
+func (r *Result) directivesChange(agents string, current []*parser.Region, expected string, fresh []*parser.Region, directivesPath string) error {
+	edited, generated := skeleton(agents, current), skeleton(expected, fresh)
+	if edited == generated {
+		return nil
+	}
+
+	data, err := os.ReadFile(directivesPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", directivesPath, err)
+	}
+
+	patched, err := diff.Patch(string(data), generated, edited, 3)
+	if err == nil && strings.Contains(patched, regionPlaceholder) {
+		err = errors.New("items were added, moved or removed")
+	}
+	if err != nil {
+		r.Skipped = append(r.Skipped, Skip{
+			Ref:    filepath.Base(directivesPath),
+			Reason: fmt.Sprintf("edits outside items could not be mapped (%v); edit it directly", err),
+		})
+		return nil
+	}
+
+	r.Changes = append(r.Changes, Change{Path: directivesPath, Old: string(data), New: patched})
+	return nil
+}
+
+// regionPlaceholder starts the line standing for an item region in a skeleton
+const regionPlaceholder = "\x00agmd:region "
+
+// skeleton replaces each top-level region of content, markers included, by
+// a placeholder line naming its directive
+func skeleton(content string, regions []*parser.Region) string {
+	lines := strings.Split(content, "\n")
+	var out []string
+	next := 0
+	for _, region := range regions {
+		out = append(out, lines[next:region.Line-1]...)
+		out = append(out, regionPlaceholder+region.Directive())
+		next = region.EndLine
+	}
+	out = append(out, lines[next:]...)
+	return strings.Join(out, "\n")
+}
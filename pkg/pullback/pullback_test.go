@@ -0,0 +1,131 @@
+package pullback
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agmd/pkg/parser"
+	"agmd/pkg/registry"
+)
+
+// writeFile creates a file with its parent directories
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	registryPath, projectPath := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(registryPath, "bundle", "go.md"), "---\nname: go\n---\n\n# Go\n\n:::include rule:errors\n\nKeep it simple.\n")
+	writeFile(t, filepath.Join(registryPath, "rule", "errors.md"), "---\nname: errors\ndescription: Error handling\n---\n\n# Errors\n\nWrap errors.\n")
+	writeFile(t, filepath.Join(registryPath, "rule", "style.md"), "Use gofmt.\n")
+
+	directivesPath := filepath.Join(projectPath, "directives.md")
+	directives := "# Project\n\nIntro.\n\n## Go\n\n:::include bundle:go\n\n:::include rule:style\n\nOutro.\n"
+	writeFile(t, directivesPath, directives)
+
+	expanded, err := parser.ParseAndExpandWithOptions([]byte(directives), parser.Options{RegistryPath: registryPath, Provenance: true})
+	if err != nil {
+		t.Fatalf("Expansion failed: %v", err)
+	}
+	expected := string(expanded)
+
+	agents := strings.NewReplacer(
+		"Wrap errors.", "Wrap errors with %w.",
+		"Keep it simple.", "Keep it simple and small.",
+		"Outro.", "Outro, edited.",
+	).Replace(expected)
+
+	result, err := Plan(agents, expected, directivesPath, &registry.Registry{BasePath: registryPath})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(result.Skipped) != 0 {
+		t.Errorf("Unexpected skips: %+v", result.Skipped)
+	}
+
+	want := map[string]string{
+		filepath.Join(registryPath, "bundle", "go.md"):   "---\nname: go\n---\n\n# Go\n\n:::include rule:errors\n\nKeep it simple and small.\n",
+		filepath.Join(registryPath, "rule", "errors.md"): "---\nname: errors\ndescription: Error handling\n---\n\n# Errors\n\nWrap errors with %w.\n",
+		directivesPath: strings.Replace(directives, "Outro.", "Outro, edited.", 1),
+	}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("Expected %d changes, got %d: %+v", len(want), len(result.Changes), result.Changes)
+	}
+	for _, change := range result.Changes {
+		if change.New != want[change.Path] {
+			t.Errorf("Change to %s\n--- want ---\n%s\n--- got ---\n%s", change.Path, want[change.Path], change.New)
+		}
+	}
+}
+
+func TestPlanConflicts(t *testing.T) {
+	registryPath, projectPath := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(registryPath, "rule", "style.md"), "Use gofmt.\n")
+	directivesPath := filepath.Join(projectPath, "directives.md")
+	directives := ":::include rule:style\n"
+	writeFile(t, directivesPath, directives)
+
+	expanded, err := parser.ParseAndExpandWithOptions([]byte(directives), parser.Options{RegistryPath: registryPath, Provenance: true})
+	if err != nil {
+		t.Fatalf("Expansion failed: %v", err)
+	}
+	agents := strings.Replace(string(expanded), "Use gofmt.", "Use gofumpt.", 1)
+
+	// The registry item changed after AGENTS.md was generated
+	writeFile(t, filepath.Join(registryPath, "rule", "style.md"), "Use gofmt and vet.\n")
+	expanded, err = parser.ParseAndExpandWithOptions([]byte(directives), parser.Options{RegistryPath: registryPath, Provenance: true})
+	if err != nil {
+		t.Fatalf("Expansion failed: %v", err)
+	}
+
+	result, err := Plan(agents, string(expanded), directivesPath, &registry.Registry{BasePath: registryPath})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(result.Changes) != 0 || len(result.Skipped) != 1 || result.Skipped[0].Ref != "rule:style" {
+		t.Errorf("Expected rule:style to be skipped, got %+v", result)
+	}
+
+	if _, err := Plan("# No markers\n", string(expanded), directivesPath, &registry.Registry{BasePath: registryPath}); err != ErrNoProvenance {
+		t.Errorf("Expected ErrNoProvenance, got %v", err)
+	}
+}
+
+func TestUnexpand(t *testing.T) {
+	registryPath := t.TempDir()
+	writeFile(t, filepath.Join(registryPath, "rule", "deploy.md"), "---\nname: deploy\n---\n\n# Deploy\n\nDeploy to {{env}}.\n\n## Steps\n\nRun the pipeline.\n")
+	directives := "# Project\n\n:::include rule:deploy env=staging level=3\n\n:::include rule:gone\n"
+
+	opts := parser.Options{RegistryPath: registryPath, Provenance: true, AllowMissing: true}
+	expanded, err := parser.ParseAndExpandWithOptions([]byte(directives), opts)
+	if err != nil {
+		t.Fatalf("Expansion failed: %v", err)
+	}
+	expected := string(expanded)
+	if !strings.Contains(expected, "### Deploy") || !strings.Contains(expected, "Deploy to staging.") {
+		t.Fatalf("Expected a shifted, substituted expansion, got:\n%s", expected)
+	}
+	agents := strings.Replace(expected, "Run the pipeline.", "Run the pipeline twice.", 1)
+
+	items, err := Unexpand(agents, expected, &registry.Registry{BasePath: registryPath})
+	if err != nil {
+		t.Fatalf("Unexpand failed: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Expected the one item of the registry, got %v", items)
+	}
+	want := "# Deploy\n\nDeploy to {{env}}.\n\n## Steps\n\nRun the pipeline twice."
+	for _, got := range items {
+		if got != want {
+			t.Errorf("Unexpanded item\n--- want ---\n%s\n--- got ---\n%s", want, got)
+		}
+	}
+}
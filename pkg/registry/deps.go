@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Dependencies is the requires graph of a set of registry items
+type Dependencies struct {
+	Order     []string            // Every item found, each after the items it requires
+	Requires  map[string][]string // Direct requires of each item found
+	Conflicts map[string][]string // conflicts_with of each item found
+	Missing   []string            // Items required (or asked for) but not in the registry
+}
+
+// RequireCycleError reports items that (transitively) require themselves
+type RequireCycleError struct {
+	Chain []string // TYPE:NAME of each item, ending with the repeated one
+}
+
+// Error implements error
+func (e *RequireCycleError) Error() string {
+	return "requires cycle: " + strings.Join(e.Chain, " → ")
+}
+
+// SplitRef splits a TYPE:NAME reference (TYPE may be source-qualified)
+func SplitRef(ref string) (itemType, name string, ok bool) {
+	itemType, name, ok = strings.Cut(ref, ":")
+	if !ok || itemType == "" || name == "" {
+		return "", "", false
+	}
+	return itemType, name, true
+}
+
+// ResolveDependencies follows the requires: frontmatter of the given TYPE:NAME
+// items through the registry. Order lists requirements before the items that
+// need them, so they can be rendered in that order; a requires cycle is
+// returned as *RequireCycleError.
+func (r *Registry) ResolveDependencies(refs ...string) (*Dependencies, error) {
+	deps := &Dependencies{
+		Requires:  map[string][]string{},
+		Conflicts: map[string][]string{},
+	}
+	done := map[string]bool{}
+
+	var visit func(ref string, chain []string) error
+	visit = func(ref string, chain []string) error {
+		if i := slices.Index(chain, ref); i >= 0 {
+			return &RequireCycleError{Chain: append(slices.Clone(chain[i:]), ref)}
+		}
+		if done[ref] {
+			return nil
+		}
+		done[ref] = true
+
+		itemType, name, ok := SplitRef(ref)
+		if !ok {
+			return fmt.Errorf("invalid reference %q: expected TYPE:NAME", ref)
+		}
+		if len(r.Which(itemType, name)) == 0 {
+			deps.Missing = append(deps.Missing, ref)
+			return nil
+		}
+		item, err := r.GetItem(itemType, name)
+		if err != nil {
+			return err
+		}
+
+		deps.Requires[ref] = item.Meta.Requires
+		deps.Conflicts[ref] = item.Meta.ConflictsWith
+		for _, required := range item.Meta.Requires {
+			if err := visit(required, append(chain, ref)); err != nil {
+				return err
+			}
+		}
+		deps.Order = append(deps.Order, ref)
+		return nil
+	}
+
+	for _, ref := range refs {
+		if err := visit(ref, nil); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
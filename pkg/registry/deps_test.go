@@ -0,0 +1,38 @@
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	reg := &Registry{BasePath: t.TempDir()}
+	writeItem(t, reg.BasePath, "rule", "base", "Base.\n")
+	writeItem(t, reg.BasePath, "rule", "typescript", "---\nrequires: [rule:base]\nconflicts_with: [rule:flow]\n---\nTS.\n")
+	writeItem(t, reg.BasePath, "rule", "react-hooks", "---\nrequires: [rule:typescript, rule:base, rule:missing]\n---\nHooks.\n")
+
+	deps, err := reg.ResolveDependencies("rule:react-hooks")
+	if err != nil {
+		t.Fatalf("ResolveDependencies failed: %v", err)
+	}
+	if want := []string{"rule:base", "rule:typescript", "rule:react-hooks"}; !reflect.DeepEqual(deps.Order, want) {
+		t.Errorf("Order = %v, want %v", deps.Order, want)
+	}
+	if want := []string{"rule:missing"}; !reflect.DeepEqual(deps.Missing, want) {
+		t.Errorf("Missing = %v, want %v", deps.Missing, want)
+	}
+	if want := []string{"rule:flow"}; !reflect.DeepEqual(deps.Conflicts["rule:typescript"], want) {
+		t.Errorf("Conflicts = %v", deps.Conflicts)
+	}
+
+	writeItem(t, reg.BasePath, "rule", "base", "---\nrequires: [rule:react-hooks]\n---\nBase.\n")
+	_, err = reg.ResolveDependencies("rule:react-hooks")
+	var cycle *RequireCycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("Expected *RequireCycleError, got %v", err)
+	}
+	if want := []string{"rule:react-hooks", "rule:typescript", "rule:base", "rule:react-hooks"}; !reflect.DeepEqual(cycle.Chain, want) {
+		t.Errorf("Chain = %v, want %v", cycle.Chain, want)
+	}
+}
@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigFilename is the configuration file inside the personal registry
+const ConfigFilename = "config.toml"
+
+// HomeEnv moves the personal registry away from ~/.agmd
+const HomeEnv = "AGMD_HOME"
+
+// PathEnv lists extra registry layers, separated like PATH
+const PathEnv = "AGMD_PATH"
+
+// ProjectDirname is the project-local registry layer, searched first
+const ProjectDirname = ".agmd"
+
+// Config is the content of ~/.agmd/config.toml
+type Config struct {
+	// Path lists extra registry layers searched after the personal registry,
+	// highest priority first (e.g. a checked-out team repository)
+	Path []string `toml:"path"`
+
+	// AutoCommit commits every change agmd makes to a git-tracked registry
+	AutoCommit bool `toml:"auto_commit,omitempty"`
+
+	// Sources are shared registries cloned with 'agmd source add', searched
+	// after every other layer in the order listed
+	Sources []Source `toml:"source,omitempty"`
+
+	// Tools are AI tools whose files agmd writes next to AGENTS.md, besides
+	// the built-in ones (whose settings they may also override). Only tools
+	// are read from a project's .agmd/config.toml.
+	Tools []ToolTarget `toml:"tool,omitempty"`
+}
+
+// LoadConfig reads config.toml from the personal registry; a missing file
+// yields an empty configuration
+func (r *Registry) LoadConfig() (*Config, error) {
+	var config Config
+	path := filepath.Join(r.BasePath, ConfigFilename)
+	if _, err := toml.DecodeFile(path, &config); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// SaveConfig writes config to config.toml in the personal registry
+func (r *Registry) SaveConfig(config *Config) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(config); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", ConfigFilename, err)
+	}
+	return os.WriteFile(filepath.Join(r.BasePath, ConfigFilename), buf.Bytes(), 0644)
+}
+
+// searchPath returns the registry layers for a personal registry at basePath:
+// the project's .agmd/ directory when present, the personal registry, the
+// layers from AGMD_PATH or, when it is unset, from config.toml, and finally
+// the subscribed sources
+func searchPath(basePath string) ([]string, error) {
+	var layers []string
+	add := func(path string) {
+		path = expandHome(path)
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		for _, layer := range layers {
+			if layer == path {
+				return
+			}
+		}
+		layers = append(layers, path)
+	}
+
+	if info, err := os.Stat(ProjectDirname); err == nil && info.IsDir() {
+		add(ProjectDirname)
+	}
+	add(basePath)
+
+	reg := &Registry{BasePath: basePath}
+	config, err := reg.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if env := os.Getenv(PathEnv); env != "" {
+		for _, path := range filepath.SplitList(env) {
+			if path != "" {
+				add(path)
+			}
+		}
+	} else {
+		for _, path := range config.Path {
+			add(path)
+		}
+	}
+
+	for _, source := range config.Sources {
+		add(reg.SourceDir(source.Name))
+	}
+	return layers, nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// SearchPath returns the layers items are looked up in, highest priority
+// first; a Registry built without layers searches BasePath alone
+func (r *Registry) SearchPath() []string {
+	if len(r.Layers) > 0 {
+		return r.Layers
+	}
+	return []string{r.BasePath}
+}
+
+// Which returns the path of every layer file defining type:name, highest
+// priority first; the first one is the file used. A source-qualified type
+// (team/rule) is only looked up in that source.
+func (r *Registry) Which(itemType, name string) []string {
+	layers, itemType := r.scope(itemType)
+	var paths []string
+	for _, layer := range layers {
+		path := filepath.Join(layer, itemType, name+".md")
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// LayerOf returns the layer a file below one of the registry layers belongs
+// to; for nested layers (sources inside the personal registry) the innermost
+func (r *Registry) LayerOf(path string) string {
+	found := ""
+	for _, layer := range r.SearchPath() {
+		if _, ok := Within(layer, path); ok && len(layer) > len(found) {
+			found = layer
+		}
+	}
+	return found
+}
+
+// Within returns path relative to dir when path is dir or below it
+func Within(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
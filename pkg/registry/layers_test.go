@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeItem creates LAYER/TYPE/NAME.md
+func writeItem(t *testing.T, layer, itemType, name, content string) {
+	t.Helper()
+	path := filepath.Join(layer, itemType, name+".md")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write item: %v", err)
+	}
+}
+
+func TestLayeredLookup(t *testing.T) {
+	personal, team := t.TempDir(), t.TempDir()
+	writeItem(t, personal, "rule", "style", "---\nname: style\n---\n\nPersonal style.\n")
+	writeItem(t, team, "rule", "style", "---\nname: style\n---\n\nTeam style.\n")
+	writeItem(t, team, "rule", "security", "---\nname: security\n---\n\nTeam security.\n")
+	writeItem(t, team, "policy", "access", "Access.\n")
+
+	reg := &Registry{BasePath: personal, Layers: []string{personal, team}}
+
+	item, err := reg.GetItem("rule", "style")
+	if err != nil {
+		t.Fatalf("GetItem failed: %v", err)
+	}
+	if item.Content != "Personal style.\n" || item.Layer != personal {
+		t.Errorf("Expected the personal override, got %q from %s", item.Content, item.Layer)
+	}
+
+	items, err := reg.ListItems("rule")
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.Name+"@"+item.Layer)
+	}
+	if want := []string{"security@" + team, "style@" + personal}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	types, err := reg.ListTypes()
+	if err != nil {
+		t.Fatalf("ListTypes failed: %v", err)
+	}
+	if want := []string{"policy", "rule"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("Expected types %v, got %v", want, types)
+	}
+
+	which := reg.Which("rule", "style")
+	if len(which) != 2 || reg.LayerOf(which[1]) != team {
+		t.Errorf("Expected the team file to be shadowed, got %v", which)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	personal, team, extra := t.TempDir(), t.TempDir(), t.TempDir()
+	project := t.TempDir()
+	if err := os.Mkdir(filepath.Join(project, ProjectDirname), 0755); err != nil {
+		t.Fatalf("Failed to create project layer: %v", err)
+	}
+	t.Chdir(project)
+
+	config := "path = [\"" + filepath.ToSlash(team) + "\"]\n"
+	if err := os.WriteFile(filepath.Join(personal, ConfigFilename), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	t.Setenv(PathEnv, "")
+	layers, err := searchPath(personal)
+	if err != nil {
+		t.Fatalf("searchPath failed: %v", err)
+	}
+	projectLayer, _ := filepath.Abs(ProjectDirname)
+	if want := []string{projectLayer, personal, team}; !reflect.DeepEqual(layers, want) {
+		t.Errorf("Expected %v from config.toml, got %v", want, layers)
+	}
+
+	// AGMD_PATH replaces the configured layers
+	t.Setenv(PathEnv, extra+string(os.PathListSeparator)+personal)
+	layers, err = searchPath(personal)
+	if err != nil {
+		t.Fatalf("searchPath failed: %v", err)
+	}
+	if want := []string{projectLayer, personal, extra}; !reflect.DeepEqual(layers, want) {
+		t.Errorf("Expected %v from AGMD_PATH, got %v", want, layers)
+	}
+}
@@ -10,41 +10,64 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// ItemMeta represents the YAML frontmatter for an item
-type ItemMeta struct {
-	Name        string `yaml:"name"`
-	Description string `yaml:"description,omitempty"`
+// Param declares a {{name}} placeholder accepted by an item.
+//
+// In frontmatter a param is either a plain default value or a mapping:
+//
+//	params:
+//	  env: staging            # default "staging"
+//	  branch:                 # no default: required
+//	    description: Branch to deploy
+type Param struct {
+	Default     *string `yaml:"default,omitempty"`
+	Description string  `yaml:"description,omitempty"`
 }
 
-// loadItem loads a single item from a file
-func loadItem(path string, itemType string) (*Item, error) {
+// Required reports whether the param must be supplied by the include directive
+func (p Param) Required() bool {
+	return p.Default == nil
+}
+
+// UnmarshalYAML accepts both the plain-default and the mapping form
+func (p *Param) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag != "!!null" {
+			value := node.Value
+			p.Default = &value
+		}
+		return nil
+	}
+
+	type plain Param
+	return node.Decode((*plain)(p))
+}
+
+// loadItem loads a single item from a file; name is its path below the type
+// directory without .md (e.g. "go/errors")
+func loadItem(path, itemType, name string) (*Item, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get name from filename
-	name := strings.TrimSuffix(filepath.Base(path), ".md")
-
 	item := &Item{
 		Type:     itemType,
 		Name:     name,
 		FilePath: path,
 	}
 
-	frontmatter, markdown, err := extractFrontmatter(content)
+	meta, markdown, err := ParseItemFile(content)
 	if err != nil {
-		return nil, err
-	}
-
-	if len(frontmatter) > 0 {
-		var meta ItemMeta
-		if err := yaml.Unmarshal(frontmatter, &meta); err != nil {
-			return nil, fmt.Errorf("invalid frontmatter: %w", err)
+		if metaErr, ok := err.(*MetaError); ok {
+			metaErr.Path = path
 		}
-		item.Description = meta.Description
+		return nil, err
 	}
 
+	item.Meta = *meta
+	item.Description = meta.Description
+	item.Tags = meta.Tags
+	item.Params = meta.Params
 	item.Content = string(markdown)
 	return item, nil
 }
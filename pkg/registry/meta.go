@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ItemMeta is the YAML frontmatter of a registry item. It is shared by the
+// registry and the parser, so every command reads items the same way.
+//
+//	---
+//	name: security
+//	description: Security baseline for services
+//	tags: [security, backend]
+//	version: 1.2.0
+//	authors: [platform-team]
+//	applies_to: [go, python]
+//	applies_to_globs: ["**/*.go"]
+//	requires: [rule:logging]
+//	conflicts_with: [rule:legacy-security]
+//	deprecated: true
+//	replaced_by: rule:security-v2
+//	params:
+//	  env: staging
+//	---
+type ItemMeta struct {
+	Name           string           `yaml:"name,omitempty"`
+	Description    string           `yaml:"description,omitempty"`
+	Tags           []string         `yaml:"tags,omitempty"`
+	Version        string           `yaml:"version,omitempty"`
+	Authors        []string         `yaml:"authors,omitempty"`
+	AppliesTo      []string         `yaml:"applies_to,omitempty"`       // Languages and frameworks the item is meant for
+	AppliesToGlobs []string         `yaml:"applies_to_globs,omitempty"` // Files the item is scoped to in tools that support it (Cursor)
+	Requires       []string         `yaml:"requires,omitempty"`         // TYPE:NAME of items this one depends on
+	ConflictsWith  []string         `yaml:"conflicts_with,omitempty"`   // TYPE:NAME of items that must not be used with this one
+	Deprecated     bool             `yaml:"deprecated,omitempty"`
+	ReplacedBy     string           `yaml:"replaced_by,omitempty"` // TYPE:NAME of the item to use instead
+	Params         map[string]Param `yaml:"params,omitempty"`
+
+	// Extra keeps the keys agmd does not know (e.g. category), so they
+	// survive loading and saving the item
+	Extra map[string]any `yaml:",inline"`
+}
+
+// MetaError reports frontmatter that cannot be parsed or breaks the schema
+type MetaError struct {
+	Path     string
+	Problems []string
+}
+
+// Error implements error
+func (e *MetaError) Error() string {
+	msg := "invalid frontmatter: " + strings.Join(e.Problems, "; ")
+	if e.Path == "" {
+		return msg
+	}
+	return e.Path + ": " + msg
+}
+
+var (
+	itemRefRe   = regexp.MustCompile(`^(?:[a-z0-9_-]+/)?[a-z0-9-]+:[a-z0-9/_-]+$`)
+	versionRe   = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+){0,2}([-+][0-9A-Za-z.-]+)?$`)
+	paramNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+)
+
+// Validate checks the metadata against the schema and returns a *MetaError
+// listing every problem
+func (m *ItemMeta) Validate() error {
+	var problems []string
+	addf := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	checkList := func(key string, values []string, valid func(string) bool, expected string) {
+		for _, value := range values {
+			if !valid(value) {
+				addf("%s: %q is not %s", key, value, expected)
+			}
+		}
+	}
+	nonEmpty := func(value string) bool { return strings.TrimSpace(value) != "" }
+
+	checkList("tags", m.Tags, func(tag string) bool { return nonEmpty(tag) && !strings.ContainsAny(tag, " \t") }, "a tag without spaces")
+	checkList("authors", m.Authors, nonEmpty, "a name")
+	checkList("applies_to", m.AppliesTo, nonEmpty, "a language or framework")
+	checkList("applies_to_globs", m.AppliesToGlobs, validGlob, "a file glob like **/*.ts")
+	checkList("requires", m.Requires, itemRefRe.MatchString, "a TYPE:NAME reference")
+	checkList("conflicts_with", m.ConflictsWith, itemRefRe.MatchString, "a TYPE:NAME reference")
+
+	if m.Version != "" && !versionRe.MatchString(m.Version) {
+		addf("version: %q is not a version like 1.2.0", m.Version)
+	}
+	if m.ReplacedBy != "" {
+		if !itemRefRe.MatchString(m.ReplacedBy) {
+			addf("replaced_by: %q is not a TYPE:NAME reference", m.ReplacedBy)
+		}
+		if !m.Deprecated {
+			addf("replaced_by is set but deprecated is not true")
+		}
+	}
+	for _, ref := range m.Requires {
+		for _, conflict := range m.ConflictsWith {
+			if ref == conflict {
+				addf("%s is both required and conflicting", ref)
+			}
+		}
+	}
+	for name := range m.Params {
+		if !paramNameRe.MatchString(name) {
+			addf("params: %q is not a valid {{placeholder}} name", name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &MetaError{Problems: problems}
+	}
+	return nil
+}
+
+// validGlob reports whether glob is a well-formed pattern relative to the
+// project root. ** matches any number of directories.
+func validGlob(glob string) bool {
+	if strings.TrimSpace(glob) == "" || path.IsAbs(glob) {
+		return false
+	}
+	_, err := path.Match(strings.ReplaceAll(glob, "**", "*"), "")
+	return err == nil
+}
+
+// ParseItemFile splits an item file into its validated metadata and the
+// markdown below the frontmatter. Files without frontmatter have empty
+// metadata; malformed frontmatter is a *MetaError.
+func ParseItemFile(data []byte) (*ItemMeta, []byte, error) {
+	frontmatter, markdown, err := extractFrontmatter(data)
+	if err != nil {
+		return nil, nil, &MetaError{Problems: []string{err.Error()}}
+	}
+
+	meta := &ItemMeta{}
+	if len(bytes.TrimSpace(frontmatter)) > 0 {
+		if err := yaml.Unmarshal(frontmatter, meta); err != nil {
+			return nil, nil, &MetaError{Problems: []string{yamlProblem(err)}}
+		}
+	}
+	if err := meta.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return meta, markdown, nil
+}
+
+// yamlProblem turns a YAML error into a problem line, with line numbers
+// counted from the top of the file rather than of the frontmatter
+func yamlProblem(err error) string {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		msg = strings.Join(typeErr.Errors, "; ")
+	}
+	return lineRe.ReplaceAllStringFunc(msg, func(match string) string {
+		var line int
+		fmt.Sscanf(match, "line %d", &line)
+		return fmt.Sprintf("line %d", line+1) // +1 for the opening ---
+	})
+}
+
+var lineRe = regexp.MustCompile(`line [0-9]+`)
+
+// MarshalYAML writes a param in the plain-default form when it has no
+// description, the form most items use
+func (p Param) MarshalYAML() (any, error) {
+	if p.Description == "" && p.Default != nil {
+		return *p.Default, nil
+	}
+	type plain Param
+	return plain(p), nil
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseItemFile(t *testing.T) {
+	data := []byte(`---
+name: security
+description: Security baseline
+tags: [security, backend]
+version: 1.2.0
+authors: [platform-team]
+applies_to: [go]
+requires: [rule:logging, team/rule:secrets]
+conflicts_with: [rule:legacy-security]
+category: compliance
+params:
+  env: staging
+---
+# Security
+`)
+	meta, body, err := ParseItemFile(data)
+	if err != nil {
+		t.Fatalf("ParseItemFile failed: %v", err)
+	}
+	if string(body) != "# Security\n" {
+		t.Errorf("body = %q", body)
+	}
+	if meta.Version != "1.2.0" || !reflect.DeepEqual(meta.Requires, []string{"rule:logging", "team/rule:secrets"}) {
+		t.Errorf("meta = %+v", meta)
+	}
+	if meta.Extra["category"] != "compliance" {
+		t.Errorf("Extra = %v, want category kept", meta.Extra)
+	}
+	if meta.Params["env"].Default == nil || *meta.Params["env"].Default != "staging" {
+		t.Errorf("Params = %v", meta.Params)
+	}
+}
+
+func TestParseItemFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		problem string
+	}{
+		{"unterminated", "---\nname: x\n# Body\n", "frontmatter"},
+		{"malformed yaml", "---\nname: x\ntags: [a, b\n---\nBody\n", "line "},
+		{"wrong type", "---\ntags: security\n---\nBody\n", "line 2"},
+		{"bad tag", "---\ntags: [\"two words\"]\n---\n", `tags: "two words"`},
+		{"bad version", "---\nversion: latest\n---\n", `version: "latest"`},
+		{"bad ref", "---\nrequires: [logging]\n---\n", `requires: "logging"`},
+		{"replaced without deprecated", "---\nreplaced_by: rule:new\n---\n", "deprecated is not true"},
+		{"required and conflicting", "---\nrequires: [rule:a]\nconflicts_with: [rule:a]\n---\n", "both required and conflicting"},
+		{"bad glob", "---\napplies_to_globs: [\"/src/*.ts\", \"[a-\"]\n---\n", `applies_to_globs: "/src/*.ts"`},
+		{"bad param", "---\nparams:\n  two words: x\n---\n", "placeholder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseItemFile([]byte(tt.data))
+			var metaErr *MetaError
+			if !errors.As(err, &metaErr) {
+				t.Fatalf("ParseItemFile() error = %v, want *MetaError", err)
+			}
+			if !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("error %q does not mention %q", err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestSaveItemKeepsUnknownKeys(t *testing.T) {
+	reg := &Registry{BasePath: t.TempDir()}
+	writeItem(t, reg.BasePath, "rule", "security", `---
+name: security
+description: Old
+version: 1.0.0
+deprecated: true
+replaced_by: rule:security-v2
+category: compliance
+---
+Body
+`)
+
+	item, err := reg.GetItem("rule", "security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Description = "New"
+	item.Content = "New body\n"
+	if err := reg.SaveItem(*item); err != nil {
+		t.Fatalf("SaveItem failed: %v", err)
+	}
+
+	saved, err := reg.GetItem("rule", "security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := saved.Meta
+	if saved.Description != "New" || meta.Version != "1.0.0" || !meta.Deprecated || meta.ReplacedBy != "rule:security-v2" {
+		t.Errorf("saved meta = %+v", meta)
+	}
+	if meta.Extra["category"] != "compliance" {
+		t.Errorf("category lost on save: %v", meta.Extra)
+	}
+
+	item.Meta.Version = "latest"
+	if err := reg.SaveItem(*item); err == nil {
+		t.Error("SaveItem accepted an invalid version")
+	}
+}
+
+func TestListItemsReportsInvalid(t *testing.T) {
+	reg := &Registry{BasePath: t.TempDir()}
+	writeItem(t, reg.BasePath, "rule", "good", "Fine.\n")
+	writeItem(t, reg.BasePath, "rule", "bad", "---\ntags: [a\n---\nBroken.\n")
+
+	items, err := reg.ListItems("rule")
+	var metaErr *MetaError
+	if !errors.As(err, &metaErr) {
+		t.Fatalf("ListItems() error = %v, want *MetaError", err)
+	}
+	if want := filepath.Join(reg.BasePath, "rule", "bad.md"); metaErr.Path != want {
+		t.Errorf("MetaError.Path = %q, want %q", metaErr.Path, want)
+	}
+	if len(items) != 1 || items[0].Name != "good" {
+		t.Errorf("ListItems() = %v, want the valid item", items)
+	}
+
+	if _, err := reg.GetItem("rule", "bad"); !errors.As(err, &metaErr) {
+		t.Errorf("GetItem(bad) error = %v, want *MetaError", err)
+	}
+}
@@ -1,25 +1,51 @@
 package registry
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 )
 
-// New creates a new Registry instance
+// New creates a new Registry instance for the personal registry at Home()
 func New() (*Registry, error) {
-	homeDir, err := os.UserHomeDir()
+	basePath, err := Home()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
 	}
 
-	basePath := filepath.Join(homeDir, ".agmd")
+	layers, err := searchPath(basePath)
+	if err != nil {
+		return nil, err
+	}
 	return &Registry{
 		BasePath: basePath,
+		Layers:   layers,
 	}, nil
 }
 
+// Home returns the personal registry directory: $AGMD_HOME when set,
+// otherwise ~/.agmd
+func Home() (string, error) {
+	if env := os.Getenv(HomeEnv); env != "" {
+		path, err := filepath.Abs(expandHome(env))
+		if err != nil {
+			return "", fmt.Errorf("invalid %s: %w", HomeEnv, err)
+		}
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".agmd"), nil
+}
+
 // TypePath returns the path for a given type
 func (r *Registry) TypePath(itemType string) string {
 	return filepath.Join(r.BasePath, itemType)
@@ -34,15 +60,19 @@ func (r *Registry) Exists() bool {
 	return info.IsDir()
 }
 
-// GetItem retrieves an item by type and name
+// GetItem retrieves an item by type and name from the first layer that has it
 func (r *Registry) GetItem(itemType, name string) (*Item, error) {
-	path := filepath.Join(r.BasePath, itemType, name+".md")
-
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	paths := r.Which(itemType, name)
+	if len(paths) == 0 {
 		return nil, fmt.Errorf("%s '%s' not found", itemType, name)
 	}
 
-	return loadItem(path, itemType)
+	item, err := loadItem(paths[0], itemType, name)
+	if err != nil {
+		return nil, err
+	}
+	item.Layer = r.LayerOf(paths[0])
+	return item, nil
 }
 
 // SaveItem saves an item to the registry
@@ -55,13 +85,25 @@ func (r *Registry) SaveItem(item Item) error {
 
 	path := filepath.Join(typeDir, item.Name+".md")
 
-	content := fmt.Sprintf(`---
-name: %s
-description: %s
----
-
-%s`, item.Name, item.Description, item.Content)
+	// Start from the loaded metadata so keys agmd does not know survive
+	meta := item.Meta
+	if meta.Name == "" {
+		meta.Name = item.Name
+	}
+	meta.Description = item.Description
+	meta.Tags = item.Tags
+	meta.Params = item.Params
+	if err := meta.Validate(); err != nil {
+		return err
+	}
 
+	content, err := marshalWithFrontmatter(meta, item.Content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
 	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
@@ -69,55 +111,105 @@ description: %s
 	return nil
 }
 
-// ListTypes returns all type directories in the registry
+// ListTypes returns all type directories across the registry layers, sorted
 func (r *Registry) ListTypes() ([]string, error) {
-	entries, err := os.ReadDir(r.BasePath)
-	if err != nil {
-		return nil, err
-	}
-
 	var types []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			types = append(types, entry.Name())
+	for _, layer := range r.SearchPath() {
+		entries, err := os.ReadDir(layer)
+		if err != nil {
+			if layer != r.BasePath && os.IsNotExist(err) {
+				continue // Extra layers may not be checked out
+			}
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && !slices.Contains(types, entry.Name()) {
+				types = append(types, entry.Name())
+			}
 		}
 	}
+	sort.Strings(types)
 	return types, nil
 }
 
-// ListItems returns all items of a given type
+// ListItems returns all items of a given type, including those in nested
+// subdirectories (e.g. rule/go/errors.md as "go/errors"), sorted by name.
+// An item defined in several layers is listed once, from the first layer; a
+// source-qualified type (team/rule) lists that source's items only. Items
+// with invalid frontmatter are left out and reported in the error, along
+// with the valid items.
 func (r *Registry) ListItems(itemType string) ([]Item, error) {
-	typeDir := filepath.Join(r.BasePath, itemType)
+	layers, itemType := r.scope(itemType)
+	var items []Item
+	var invalid []error
+	seen := map[string]bool{}
+	for _, layer := range layers {
+		typeDir := filepath.Join(layer, itemType)
+		if _, err := os.Stat(typeDir); os.IsNotExist(err) {
+			continue // No items of this type in this layer
+		}
 
-	if _, err := os.Stat(typeDir); os.IsNotExist(err) {
-		return nil, nil // No items of this type
+		layerItems, layerInvalid, err := r.loadItems(typeDir, itemType)
+		if err != nil {
+			return nil, err
+		}
+		invalid = append(invalid, layerInvalid...)
+		for _, item := range layerItems {
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				item.Layer = layer
+				items = append(items, item)
+			}
+		}
 	}
 
-	return r.loadItems(typeDir, itemType)
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, errors.Join(invalid...)
 }
 
-// loadItems loads all items from a directory
-func (r *Registry) loadItems(dir, itemType string) ([]Item, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
+// loadItems loads all items below a directory, returning the files with
+// invalid frontmatter as *MetaError next to the valid items
+func (r *Registry) loadItems(dir, itemType string) ([]Item, []error, error) {
 	var items []Item
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
-			continue
+	var invalid []error
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
 		}
+		if !strings.HasSuffix(entry.Name(), ".md") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ".md"))
 
-		path := filepath.Join(dir, entry.Name())
-		item, err := loadItem(path, itemType)
+		item, err := loadItem(path, itemType, name)
+		var metaErr *MetaError
+		if errors.As(err, &metaErr) {
+			invalid = append(invalid, err)
+			return nil
+		}
 		if err != nil {
-			continue // Skip invalid files
+			return err
 		}
 		items = append(items, *item)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return items, nil
+	return items, invalid, nil
 }
 
 // Profile functions (special case - templates for directives.md)
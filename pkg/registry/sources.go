@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SourcesDirname holds the clones of subscribed sources inside the personal
+// registry; being hidden, it is never taken for an item type
+const SourcesDirname = ".sources"
+
+// Source is a shared registry, such as a team's git repository, cloned into
+// a read-only layer searched after the personal registry
+type Source struct {
+	Name string `toml:"name"`
+	URL  string `toml:"url"` // Git URL, file:// URL or local path
+}
+
+var sourceNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidSourceName reports whether name can prefix item types (team/rule:x)
+func ValidSourceName(name string) bool {
+	return sourceNameRe.MatchString(name)
+}
+
+// SourceDir returns the directory a source is cloned into
+func (r *Registry) SourceDir(name string) string {
+	return filepath.Join(r.BasePath, SourcesDirname, name)
+}
+
+// SourceOf returns the name of the source a file belongs to, or "" for files
+// of writable layers
+func (r *Registry) SourceOf(path string) string {
+	rel, ok := Within(filepath.Join(r.BasePath, SourcesDirname), path)
+	if !ok || rel == "." {
+		return ""
+	}
+	name, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return name
+}
+
+// SplitSource splits a source-qualified item type ("team/rule") into the
+// source and the plain type; ok is false for unqualified types
+func SplitSource(itemType string) (source, plainType string, ok bool) {
+	source, plainType, ok = strings.Cut(itemType, "/")
+	if !ok || source == "" || plainType == "" {
+		return "", itemType, false
+	}
+	return source, plainType, true
+}
+
+// scope returns the layers to search for itemType and the type to look for
+// in them: a source-qualified type (team/rule) only searches that source
+func (r *Registry) scope(itemType string) ([]string, string) {
+	if source, plainType, ok := SplitSource(itemType); ok {
+		return []string{r.SourceDir(source)}, plainType
+	}
+	return r.SearchPath(), itemType
+}
+
+// Sources returns the sources configured in config.toml
+func (r *Registry) Sources() ([]Source, error) {
+	config, err := r.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Sources, nil
+}
+
+// FindSource returns the configured source called name
+func (c *Config) FindSource(name string) (*Source, bool) {
+	for i := range c.Sources {
+		if c.Sources[i].Name == name {
+			return &c.Sources[i], true
+		}
+	}
+	return nil, false
+}
+
+// ignoreSources keeps source clones out of a git-tracked personal registry
+func (r *Registry) ignoreSources() error {
+	path := filepath.Join(r.BasePath, ".gitignore")
+	entry := "/" + SourcesDirname + "/"
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return nil
+		}
+	}
+
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	data = append(data, entry+"\n"...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	return nil
+}
+
+// AddSource records a source in config.toml. The caller clones it into
+// SourceDir(source.Name).
+func (r *Registry) AddSource(source Source) error {
+	if !ValidSourceName(source.Name) {
+		return fmt.Errorf("invalid source name %q (use lowercase letters, digits, - and _)", source.Name)
+	}
+	config, err := r.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.FindSource(source.Name); ok {
+		return fmt.Errorf("source %q already exists", source.Name)
+	}
+	if err := r.ignoreSources(); err != nil {
+		return err
+	}
+	config.Sources = append(config.Sources, source)
+	return r.SaveConfig(config)
+}
+
+// RemoveSource drops a source from config.toml and deletes its clone
+func (r *Registry) RemoveSource(name string) error {
+	config, err := r.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.FindSource(name); !ok {
+		return fmt.Errorf("source %q not found", name)
+	}
+
+	var kept []Source
+	for _, source := range config.Sources {
+		if source.Name != name {
+			kept = append(kept, source)
+		}
+	}
+	config.Sources = kept
+	if err := r.SaveConfig(config); err != nil {
+		return err
+	}
+	return os.RemoveAll(r.SourceDir(name))
+}
@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSourceLookup(t *testing.T) {
+	personal := t.TempDir()
+	reg := &Registry{BasePath: personal}
+	team := reg.SourceDir("team")
+	reg.Layers = []string{personal, team}
+
+	writeItem(t, personal, "rule", "style", "Personal style.\n")
+	writeItem(t, team, "rule", "style", "Team style.\n")
+	writeItem(t, team, "rule", "security", "Team security.\n")
+
+	// Unqualified lookups merge the layers, the personal registry first
+	if got := reg.Which("rule", "style"); len(got) != 2 || reg.LayerOf(got[0]) != personal || reg.LayerOf(got[1]) != team {
+		t.Errorf("Which(rule, style) = %v", got)
+	}
+
+	// Qualified lookups only search the source
+	item, err := reg.GetItem("team/rule", "style")
+	if err != nil {
+		t.Fatalf("GetItem(team/rule, style) failed: %v", err)
+	}
+	if item.Content != "Team style.\n" || item.Layer != team {
+		t.Errorf("Expected the team item, got %q from %s", item.Content, item.Layer)
+	}
+	if got := reg.Which("other/rule", "style"); len(got) != 0 {
+		t.Errorf("Which(other/rule, style) = %v, want none", got)
+	}
+
+	items, err := reg.ListItems("team/rule")
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	if want := []string{"security", "style"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListItems(team/rule) = %v, want %v", names, want)
+	}
+
+	if got := reg.SourceOf(filepath.Join(team, "rule", "style.md")); got != "team" {
+		t.Errorf("SourceOf(team item) = %q", got)
+	}
+	if got := reg.SourceOf(filepath.Join(personal, "rule", "style.md")); got != "" {
+		t.Errorf("SourceOf(personal item) = %q, want \"\"", got)
+	}
+}
+
+func TestAddRemoveSource(t *testing.T) {
+	t.Setenv(PathEnv, "")
+	t.Chdir(t.TempDir())
+	reg := &Registry{BasePath: t.TempDir()}
+
+	if err := reg.AddSource(Source{Name: "Team!", URL: "x"}); err == nil {
+		t.Error("AddSource accepted an invalid name")
+	}
+	for _, name := range []string{"team", "security"} {
+		if err := reg.AddSource(Source{Name: name, URL: "file:///srv/" + name + ".git"}); err != nil {
+			t.Fatalf("AddSource(%s) failed: %v", name, err)
+		}
+	}
+	if err := reg.AddSource(Source{Name: "team", URL: "y"}); err == nil {
+		t.Error("AddSource accepted a duplicate name")
+	}
+
+	// Sources are searched last, in the order they were added
+	layers, err := searchPath(reg.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{reg.BasePath, reg.SourceDir("team"), reg.SourceDir("security")}
+	if !reflect.DeepEqual(layers, want) {
+		t.Errorf("searchPath() = %v, want %v", layers, want)
+	}
+
+	ignore, err := os.ReadFile(filepath.Join(reg.BasePath, ".gitignore"))
+	if err != nil || string(ignore) != "/.sources/\n" {
+		t.Errorf(".gitignore = %q, %v", ignore, err)
+	}
+
+	if err := reg.RemoveSource("team"); err != nil {
+		t.Fatalf("RemoveSource failed: %v", err)
+	}
+	sources, err := reg.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].Name != "security" {
+		t.Errorf("Sources() after remove = %v", sources)
+	}
+	if err := reg.RemoveSource("team"); err == nil {
+		t.Error("RemoveSource of an unknown source should fail")
+	}
+}
@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ToolTarget is an AI tool declared under [[tool]] in config.toml, or one
+// whose built-in settings it overrides
+//
+//	[[tool]]
+//	name = "kiro"
+//	path = ".kiro/steering/agents.md"
+//	mode = "adapter"
+//	header = "---\ninclusion: always\n---"
+type ToolTarget struct {
+	Name   string `toml:"name"`
+	Path   string `toml:"path,omitempty"`   // File the tool reads, relative to the project root
+	Mode   string `toml:"mode,omitempty"`   // symlink (default), copy, hardlink or adapter
+	Header string `toml:"header,omitempty"` // Written above AGENTS.md in adapter mode
+	Footer string `toml:"footer,omitempty"` // Written below AGENTS.md in adapter mode
+}
+
+var toolNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// projectFiles are the files agmd keeps in a project, which a tool writing
+// to the same path would destroy
+var projectFiles = []string{"AGENTS.md", "directives.md", "agmd.lock"}
+
+// Validate checks the name and path of a tool target
+func (t *ToolTarget) Validate() error {
+	if !toolNameRe.MatchString(t.Name) {
+		return fmt.Errorf("invalid tool name %q (use lowercase letters, digits and -)", t.Name)
+	}
+	if t.Path == "" {
+		return nil
+	}
+	path := filepath.Clean(t.Path)
+	if filepath.IsAbs(path) || path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("tool %s: path %q must be a file inside the project", t.Name, t.Path)
+	}
+	// Compared regardless of case, as on macOS and Windows file systems
+	first, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+	if strings.EqualFold(first, ProjectDirname) || slices.ContainsFunc(projectFiles, func(name string) bool { return strings.EqualFold(path, name) }) {
+		return fmt.Errorf("tool %s: path %q is a file agmd generates or reads", t.Name, t.Path)
+	}
+	return nil
+}
+
+// Tools returns the tools declared in config.toml of the personal registry
+// and of the project's .agmd/ directory; a project tool replaces a personal
+// one of the same name
+func (r *Registry) Tools() ([]ToolTarget, error) {
+	config, err := r.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	tools := config.Tools
+
+	var project Config
+	path := filepath.Join(ProjectDirname, ConfigFilename)
+	if _, err := toml.DecodeFile(path, &project); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, tool := range project.Tools {
+		replaced := false
+		for i := range tools {
+			if tools[i].Name == tool.Name {
+				tools[i], replaced = tool, true
+			}
+		}
+		if !replaced {
+			tools = append(tools, tool)
+		}
+	}
+
+	for i := range tools {
+		if err := tools[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return tools, nil
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTools(t *testing.T) {
+	project := t.TempDir()
+	t.Chdir(project)
+	reg := &Registry{BasePath: t.TempDir()}
+
+	config := &Config{Tools: []ToolTarget{
+		{Name: "gemini", Path: "GEMINI.md"},
+		{Name: "zed", Path: ".rules", Mode: "copy"},
+	}}
+	if err := reg.SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(project, ProjectDirname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	override := "[[tool]]\nname = \"zed\"\npath = \".rules\"\n\n[[tool]]\nname = \"claude\"\nmode = \"copy\"\n"
+	if err := os.WriteFile(filepath.Join(project, ProjectDirname, ConfigFilename), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tools, err := reg.Tools()
+	if err != nil {
+		t.Fatalf("Tools failed: %v", err)
+	}
+	want := []ToolTarget{
+		{Name: "gemini", Path: "GEMINI.md"},
+		{Name: "zed", Path: ".rules"},
+		{Name: "claude", Mode: "copy"},
+	}
+	if !reflect.DeepEqual(tools, want) {
+		t.Errorf("Tools() = %+v, want %+v", tools, want)
+	}
+
+	for _, tool := range []ToolTarget{
+		{Name: "Gemini", Path: "GEMINI.md"},
+		{Name: "escape", Path: "../GEMINI.md"},
+		{Name: "absolute", Path: "/etc/GEMINI.md"},
+		{Name: "agents", Path: "AGENTS.md"},
+		{Name: "dot", Path: "./AGENTS.md"},
+		{Name: "lower", Path: "agents.md"},
+		{Name: "directives", Path: "docs/../directives.md"},
+		{Name: "lock", Path: "agmd.lock"},
+		{Name: "config", Path: ".agmd/config.toml"},
+		{Name: "project", Path: ".agmd"},
+	} {
+		if err := tool.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", tool)
+		}
+	}
+}
@@ -3,10 +3,14 @@ package registry
 // Item represents a generic registry item (rule, workflow, guideline, or custom type)
 type Item struct {
 	Type        string // e.g., "rule", "workflow", "framework"
-	Name        string
+	Name        string // Path below the type directory, e.g. "go/errors"
 	Description string
-	Content     string // Markdown content (below frontmatter)
-	FilePath    string // Path to the .md file
+	Tags        []string
+	Content     string           // Markdown content (below frontmatter)
+	FilePath    string           // Path to the .md file
+	Layer       string           // Registry layer the item was found in
+	Params      map[string]Param // {{name}} placeholders declared in frontmatter
+	Meta        ItemMeta         // The whole frontmatter; Description, Tags and Params take precedence when saving
 }
 
 // Profile represents a directives.md template
@@ -17,7 +21,8 @@ type Profile struct {
 	FilePath    string
 }
 
-// Registry manages the ~/.agmd/ directory
+// Registry manages the ~/.agmd/ directory and the layers searched with it
 type Registry struct {
-	BasePath string // ~/.agmd
+	BasePath string   // ~/.agmd, the personal registry new items are written to
+	Layers   []string // Directories searched for items, highest priority first
 }
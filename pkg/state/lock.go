@@ -0,0 +1,110 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LockFilename is the project lockfile written by agmd sync
+const LockFilename = "agmd.lock"
+
+// LockVersion is the format version of agmd.lock
+const LockVersion = 1
+
+// Lock pins the registry items a project's AGENTS.md is built from
+type Lock struct {
+	Version int          `toml:"version"`
+	Sync    SyncSettings `toml:"sync,omitempty"`
+	Items   []LockedItem `toml:"item"`
+}
+
+// SyncSettings are the agmd sync flags AGENTS.md was last generated with,
+// reused by sync --check and agmd symlink to build the same document
+type SyncSettings struct {
+	Vars         map[string]string `toml:"vars,omitempty"` // --set
+	Provenance   bool              `toml:"provenance,omitempty"`
+	AllowMissing bool              `toml:"allow_missing,omitempty"`
+	Dependencies string            `toml:"dependencies,omitempty"`
+}
+
+// LockedItem is the pinned content of one registry item
+type LockedItem struct {
+	Ref    string `toml:"ref"`    // type:name
+	SHA256 string `toml:"sha256"` // Hash of the item file
+	Layer  string `toml:"layer"`  // Registry directory the item was resolved from
+}
+
+// LoadLock reads an agmd.lock file; a missing file is returned as an error
+// satisfying os.IsNotExist
+func LoadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock Lock
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if lock.Version > LockVersion {
+		return nil, fmt.Errorf("%s has version %d, newer than this agmd supports (%d)", path, lock.Version, LockVersion)
+	}
+
+	return &lock, nil
+}
+
+// Save writes the lock to path with items sorted by reference
+func (l *Lock) Save(path string) error {
+	l.Version = LockVersion
+	sort.Slice(l.Items, func(i, j int) bool { return l.Items[i].Ref < l.Items[j].Ref })
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by agmd sync. Refresh pins with 'agmd update'.\n\n")
+	if err := toml.NewEncoder(&buf).Encode(l); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// Find returns the pin for ref, or nil
+func (l *Lock) Find(ref string) *LockedItem {
+	for i := range l.Items {
+		if l.Items[i].Ref == ref {
+			return &l.Items[i]
+		}
+	}
+	return nil
+}
+
+// Pin adds or replaces the pin of an item
+func (l *Lock) Pin(item LockedItem) {
+	if existing := l.Find(item.Ref); existing != nil {
+		*existing = item
+		return
+	}
+	l.Items = append(l.Items, item)
+}
+
+// Check compares resolved items with their pins and describes each one that
+// is not pinned or whose content differs from the pin
+func (l *Lock) Check(items []LockedItem) []string {
+	var problems []string
+	for _, item := range items {
+		pin := l.Find(item.Ref)
+		switch {
+		case pin == nil:
+			problems = append(problems, fmt.Sprintf("%s is not pinned in %s", item.Ref, LockFilename))
+		case pin.SHA256 != item.SHA256:
+			problems = append(problems, fmt.Sprintf("%s differs from its pin in %s (resolved from %s)", item.Ref, LockFilename, item.Layer))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLockRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFilename)
+
+	if _, err := LoadLock(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected a not-exist error for a missing lock, got %v", err)
+	}
+
+	lock := &Lock{}
+	lock.Pin(LockedItem{Ref: "rule:zeta", SHA256: "1", Layer: "~/.agmd"})
+	lock.Pin(LockedItem{Ref: "rule:alpha", SHA256: "2", Layer: "~/.agmd"})
+	lock.Pin(LockedItem{Ref: "rule:zeta", SHA256: "3", Layer: "~/.agmd"})
+	if err := lock.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadLock(path)
+	if err != nil {
+		t.Fatalf("LoadLock failed: %v", err)
+	}
+	want := []LockedItem{
+		{Ref: "rule:alpha", SHA256: "2", Layer: "~/.agmd"},
+		{Ref: "rule:zeta", SHA256: "3", Layer: "~/.agmd"},
+	}
+	if loaded.Version != LockVersion || !reflect.DeepEqual(loaded.Items, want) {
+		t.Errorf("Unexpected lock %+v", loaded)
+	}
+
+	problems := loaded.Check([]LockedItem{
+		{Ref: "rule:alpha", SHA256: "2", Layer: "/elsewhere"},
+		{Ref: "rule:zeta", SHA256: "changed"},
+		{Ref: "rule:new", SHA256: "4"},
+	})
+	if len(problems) != 2 {
+		t.Errorf("Expected 2 problems (changed and unpinned), got %v", problems)
+	}
+}